@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+)
+
+// BackupCommand provides an interface between the CLI and the MediaDbClient backup service.
+type BackupCommand struct {
+	FlagSet *flag.FlagSet
+	File    string
+}
+
+// NewBackupCommand returns a pointer to a new BackupCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewBackupCommand(args []string) (*BackupCommand, error) {
+	backupCmd := &BackupCommand{
+		FlagSet: flag.NewFlagSet("backup", flag.ContinueOnError),
+	}
+
+	backupCmd.FlagSet.StringVar(&backupCmd.File, "o", "", "The archive file to write, for example library.tar.gz")
+
+	err := backupCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if backupCmd.File == "" || backupCmd.FlagSet.NArg() != 0 {
+		return nil, errors.New(GetCommandHelpText(BackupCmdName()))
+	}
+
+	return backupCmd, nil
+}
+
+// Run executes the BackupCommand. It returns a non-nil error if the
+// underlying backup service encounters a problem or the archive cannot
+// be written. An incomplete archive is removed rather than left behind,
+// and a previous archive with the same name is only replaced once the new
+// archive is complete.
+func (b *BackupCommand) Run(ctx context.Context) (err error) {
+	file, err := createOutputFile(b.File)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = file.close(err)
+	}()
+
+	numObjects, err := MediaDbClient.Backup(ctx, file)
+	if err != nil {
+		return err
+	}
+
+	StdoutLogger.Printf("backed up %d objects to %s", numObjects, b.File)
+
+	return nil
+}
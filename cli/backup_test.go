@@ -0,0 +1,33 @@
+package cli
+
+import "testing"
+
+func TestNewBackupCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-1", []string{"backup", "-o", "library.tar.gz"}, false},
+		{"valid-2", []string{"backup", "-o=library.tar.gz"}, false},
+		{"no-file", []string{"backup"}, true},
+		{"empty-file", []string{"backup", "-o="}, true},
+		{"invalid-flags", []string{"backup", "-notaflag", "library.tar.gz"}, true},
+		{"extra-args", []string{"backup", "-o", "library.tar.gz", "movie"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewBackupCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"strings"
 
 	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
 )
 
 // CreateCommand provides an interface between the CLI and the MediaDbClient create service.
@@ -35,6 +37,8 @@ func NewCreateCommand(args []string) (*CreateCommand, error) {
 		createCmd.FlagSet.StringVar(&movie.Director, "director", "", "The director of the movie")
 		createCmd.FlagSet.IntVar(&movie.YearMade, "year", 0, "The year the movie was made")
 		createCmd.FlagSet.StringVar(&dateStr, "date", "", "The date the movie was watched")
+		createCmd.FlagSet.Float64Var(&movie.Rating, "rating", 0, "The rating of the movie out of 5, in steps of 0.5 (optional)")
+		createCmd.FlagSet.BoolVar(&movie.Rewatch, "rewatch", false, "Whether the movie had been watched before (optional)")
 
 		err := createCmd.FlagSet.Parse(args[2:])
 		if err != nil {
@@ -42,15 +46,24 @@ func NewCreateCommand(args []string) (*CreateCommand, error) {
 		}
 
 		expectFlags := 4
-		if gotFlags := createCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+		if gotFlags := createCmd.FlagSet.NFlag() - countSetFlags(createCmd.FlagSet, "rating", "rewatch"); gotFlags != expectFlags {
 			createCmd.FlagSet.Usage()
 			return nil, errors.New("")
 		}
 
-		createCmd.NewMedia, err = schema.NewMovie(movie.Title, movie.Director, movie.YearMade, dateStr)
+		err = schema.ValidateRating(movie.Rating)
+		if err != nil {
+			return nil, err
+		}
+
+		newMovie, err := schema.NewMovie(movie.Title, movie.Director, movie.YearMade, dateStr)
 		if err != nil {
 			return nil, err
 		}
+
+		newMovie.Rating = movie.Rating
+		newMovie.Rewatch = movie.Rewatch
+		createCmd.NewMedia = newMovie
 	case MusicMediaType():
 		createCmd.FlagSet = flag.NewFlagSet("create music", flag.ContinueOnError)
 		music := new(schema.Music)
@@ -84,7 +97,12 @@ func NewCreateCommand(args []string) (*CreateCommand, error) {
 }
 
 // Run executes the CreateCommand. It returns a non-nil error
-// if the underlying create service encounters a problem.
-func (c *CreateCommand) Run() error {
-	return MediaDbClient.Create(c.NewMedia)
+// if the underlying create service encounters a problem. The
+// entry is queued instead if the database cannot be reached.
+func (c *CreateCommand) Run(ctx context.Context) error {
+	if MediaDbClient == nil {
+		return queueChange(service.QueuedCreate, c.NewMedia.Key(), c.NewMedia, "", nil)
+	}
+
+	return MediaDbClient.Create(ctx, c.NewMedia)
 }
@@ -10,6 +10,8 @@ func TestNewCreateCommand(tt *testing.T) {
 	}{
 		{"valid-1", []string{"create", "music", "-title", "title", "-artist", "artist", "-year", "2020", "-date", "2021-01-01"}, false},
 		{"valid-2", []string{"create", "movie", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01"}, false},
+		{"valid-rating", []string{"create", "movie", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01", "-rating", "4.5", "-rewatch"}, false},
+		{"invalid-rating", []string{"create", "movie", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01", "-rating", "4.2"}, true},
 		{"less-than-two-args", []string{"create"}, true},
 		{"invalid-media-type", []string{"create", "invalid"}, true},
 		{"invalid-flags-1", []string{"create", "movie", "-notaflag", "movie"}, true},
@@ -1,18 +1,21 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"strings"
 
 	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
 )
 
 // DeleteCommand provides an interface between the CLI and the MediaDbClient delete service.
 type DeleteCommand struct {
 	FlagSet   *flag.FlagSet
 	ID        string
+	ETag      string
 	MediaType schema.Media
 }
 
@@ -38,6 +41,7 @@ func NewDeleteCommand(args []string) (*DeleteCommand, error) {
 	}
 
 	deleteCmd.FlagSet.StringVar(&deleteCmd.ID, "id", "", "The id in the database to delete")
+	deleteCmd.FlagSet.StringVar(&deleteCmd.ETag, "etag", "", "The etag of the entry the delete is based on (optional)")
 
 	err := deleteCmd.FlagSet.Parse(args[2:])
 	if err != nil {
@@ -45,7 +49,7 @@ func NewDeleteCommand(args []string) (*DeleteCommand, error) {
 	}
 
 	expectFlags := 1
-	if gotFlags := deleteCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+	if gotFlags := deleteCmd.FlagSet.NFlag() - countSetFlags(deleteCmd.FlagSet, "etag"); gotFlags != expectFlags {
 		deleteCmd.FlagSet.Usage()
 		return nil, errors.New("")
 	}
@@ -54,7 +58,13 @@ func NewDeleteCommand(args []string) (*DeleteCommand, error) {
 }
 
 // Run executes the DeleteCommand. It returns a non-nil error
-// if the underlying delete service encounters a problem.
-func (d *DeleteCommand) Run() error {
-	return MediaDbClient.Delete(d.ID, d.MediaType)
+// if the underlying delete service encounters a problem. The
+// delete is queued instead if the database cannot be reached.
+func (d *DeleteCommand) Run(ctx context.Context) error {
+	if MediaDbClient == nil {
+		key := strings.Join([]string{schema.GetBaseKeyFromMediaType(d.MediaType), d.ID}, "/")
+		return queueChange(service.QueuedDelete, key, nil, d.ETag, nil)
+	}
+
+	return conflictHelp(MediaDbClient.Delete(ctx, d.ID, d.MediaType, d.ETag))
 }
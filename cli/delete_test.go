@@ -10,6 +10,8 @@ func TestNewDeleteCommand(tt *testing.T) {
 	}{
 		{"valid-1", []string{"delete", "movie", "-id", "123"}, false},
 		{"valid-2", []string{"delete", "music", "-id", "123"}, false},
+		{"valid-etag", []string{"delete", "movie", "-id", "123", "-etag", "abc"}, false},
+		{"etag-without-id", []string{"delete", "music", "-etag", "abc"}, true},
 		{"less-than-two-args", []string{"delete"}, true},
 		{"invalid-media-type", []string{"delete", "invalid"}, true},
 		{"invalid-flags-1", []string{"delete", "movie", "-notaflag", "movie"}, true},
@@ -1,11 +1,15 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 
 	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/schema"
 	"github.com/alexpcook/media-db/service"
 )
 
@@ -21,38 +25,133 @@ var (
 	StderrLogger *log.Logger = log.New(os.Stderr, "", 0)
 )
 
+// initDb loads the media database configuration and initializes a
+// service client to communicate with the database. It returns a non-nil
+// error if either step fails.
+func initDb() error {
+	var err error
+
+	MediaDbConfig, err = config.LoadMediaDbConfig()
+	if err != nil {
+		return err
+	}
+
+	MediaDbClient, err = service.NewMediaDbClient(MediaDbConfig)
+	return err
+}
+
+// getSetupHelpText returns the error text for a configuration
+// issue, along with how to fix it.
+func getSetupHelpText(err error) string {
+	return fmt.Sprintf(`%s
+		
+run 'media-db setup' to fix the configuration issue`, err.Error())
+}
+
 // InitDb loads the media database configuration and initializes
-// a service client to communicate with the database. It will return
-// a non-nil error if any of these steps fail.
+// a service client to communicate with the database. It exits the
+// program if any of these steps fail.
 func InitDb() {
-	MediaDbConfig, err := config.LoadMediaDbConfig()
+	err := initDb()
 	if err != nil {
-		StderrLogger.Fatal(fmt.Sprintf(`%s
-		
-run 'media-db setup' to fix the configuration issue`, err.Error()))
+		StderrLogger.Fatal(getSetupHelpText(err))
 	}
+}
 
-	MediaDbClient, err = service.NewMediaDbClient(MediaDbConfig)
+// InitDbOrQueue is the same as InitDb for commands that change the
+// database, except that if the configuration has the offline queue
+// enabled and the database cannot be reached, MediaDbClient is left
+// nil, and the command queues its change with queueChange instead.
+// A database that is not configured correctly is reported as by InitDb.
+func InitDbOrQueue() {
+	err := initDb()
+	if errors.Is(err, service.ErrUnreachable) && MediaDbConfig != nil && MediaDbConfig.QueueOffline {
+		MediaDbClient = nil
+		StderrLogger.Printf("media-db: the database cannot be reached: %s", err)
+		return
+	}
 	if err != nil {
-		StderrLogger.Fatal(fmt.Sprintf(`%s
-		
-run 'media-db setup' to fix the configuration issue`, err.Error()))
+		StderrLogger.Fatal(getSetupHelpText(err))
+	}
+}
+
+// queueChange appends a change to the offline queue, to be made in the
+// database by 'media-db push'. The fields in keep keep their stored values
+// when an update is made. It returns a non-nil error if the change cannot
+// be queued.
+func queueChange(op service.QueuedOp, key string, media schema.Media, version string, keep []string) error {
+	queuedOp, err := service.NewQueuedOperation(op, key, media, version)
+	if err != nil {
+		return err
 	}
+	queuedOp.Keep = keep
+
+	queue := service.NewQueue(config.GetQueueFile())
+	err = queue.Append(queuedOp)
+	if err != nil {
+		return err
+	}
+
+	ops, err := queue.Read()
+	if err != nil {
+		return err
+	}
+
+	StdoutLogger.Printf("queued the %s (%d queued changes), run 'media-db %s' to make the queued changes once the database can be reached", op, len(ops), PushCmdName())
+
+	return nil
 }
 
-// Execute is the main entrypoint for callers.
+// cancelOnInterrupt returns a context that is cancelled when the program
+// receives an interrupt, such as from Ctrl-C. Once the context has been
+// cancelled, a second interrupt exits the program straight away.
+func cancelOnInterrupt() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		StderrLogger.Print(GetInterruptingHelpText())
+		cancel()
+	}()
+
+	return ctx
+}
+
+// exitWithError shows err to the user and exits the program with the exit
+// code for err, which is defaultCode unless err is a typed service error.
+func exitWithError(err error, defaultCode int) {
+	StderrLogger.Print(getErrorText(err))
+	os.Exit(getExitCode(err, defaultCode))
+}
+
+// Execute is the main entrypoint for callers. An interrupt while a command
+// runs stops the command from making any more changes to the database. The
+// exit code tells apart a command that was not used correctly, an entry
+// that was not found, a conflict, a field that is not valid, and an
+// interrupt from any other failure.
 func Execute() {
 	if len(os.Args) < 2 {
-		StderrLogger.Fatal(GetCLIHelpText())
+		StderrLogger.Print(GetCLIHelpText())
+		os.Exit(getUsageExitCode())
 	}
 
 	cmd, err := NewMediaDbCommand(os.Args[1:])
 	if err != nil {
-		StderrLogger.Fatal(err)
+		exitWithError(err, getUsageExitCode())
 	}
 
-	err = cmd.Run()
+	ctx := cancelOnInterrupt()
+
+	err = cmd.Run(ctx)
+	if err != nil && ctx.Err() != nil {
+		StderrLogger.Print(GetInterruptedHelpText(os.Args[1], err))
+		os.Exit(getInterruptedExitCode())
+	}
 	if err != nil {
-		StderrLogger.Fatal(err)
+		exitWithError(err, getErrorExitCode())
 	}
 }
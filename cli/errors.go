@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"errors"
+
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
+)
+
+// getErrorExitCode returns the exit code of the CLI
+// when a command fails for any other reason.
+func getErrorExitCode() int {
+	return 1
+}
+
+// getUsageExitCode returns the exit code of the CLI
+// when a command is not used correctly.
+func getUsageExitCode() int {
+	return 2
+}
+
+// getNotFoundExitCode returns the exit code of the CLI when
+// an entry that a command refers to does not exist.
+func getNotFoundExitCode() int {
+	return 3
+}
+
+// getConflictExitCode returns the exit code of the CLI when a
+// command conflicts with a change made by another writer.
+func getConflictExitCode() int {
+	return 4
+}
+
+// getValidationExitCode returns the exit code of the CLI
+// when a field of an entry given to a command is not valid.
+func getValidationExitCode() int {
+	return 5
+}
+
+// getInterruptedExitCode returns the exit code of the CLI
+// when a command is stopped by an interrupt.
+func getInterruptedExitCode() int {
+	return 130
+}
+
+// getExitCode returns the exit code of the CLI for err, which is
+// defaultCode unless err is one of the typed errors of the service.
+func getExitCode(err error, defaultCode int) int {
+	var validationErr *schema.ValidationError
+
+	switch {
+	case errors.As(err, &validationErr):
+		return getValidationExitCode()
+	case errors.Is(err, service.ErrNotFound):
+		return getNotFoundExitCode()
+	case errors.Is(err, service.ErrConflict):
+		return getConflictExitCode()
+	default:
+		return defaultCode
+	}
+}
+
+// helpError is an error whose message is help text for the user,
+// which still wraps the error it explains for errors.Is and errors.As.
+type helpError struct {
+	help string
+	err  error
+}
+
+// Error returns the help text.
+func (e *helpError) Error() string {
+	return e.help
+}
+
+// Unwrap returns the error that the help text explains.
+func (e *helpError) Unwrap() error {
+	return e.err
+}
+
+// withHelp returns an error with the message help that wraps err.
+func withHelp(err error, help string) error {
+	return &helpError{help: help, err: err}
+}
+
+// getErrorText returns the message to show the user for err. A typed
+// error of the service is shown with help text, unless it already has
+// some, and any other error is shown as it is.
+func getErrorText(err error) string {
+	var helpErr *helpError
+	var validationErr *schema.ValidationError
+	var conflictErr *service.ConflictError
+
+	switch {
+	case errors.As(err, &helpErr):
+		return err.Error()
+	case errors.As(err, &validationErr):
+		return GetValidationHelpText(validationErr)
+	case errors.As(err, &conflictErr):
+		return GetConflictHelpText(conflictErr)
+	case errors.Is(err, service.ErrNotFound):
+		return GetNotFoundHelpText(err)
+	default:
+		return err.Error()
+	}
+}
+
+// conflictHelp replaces the message of a *service.ConflictError with help
+// text that shows the current value of the entry. Any other error is
+// returned unchanged.
+func conflictHelp(err error) error {
+	var conflictErr *service.ConflictError
+	if errors.As(err, &conflictErr) {
+		return withHelp(err, GetConflictHelpText(conflictErr))
+	}
+
+	return err
+}
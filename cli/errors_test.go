@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
+)
+
+func TestGetExitCode(tt *testing.T) {
+	_, validationErr := schema.NewMovie("", "director", 2000, "2021-05-01")
+	if validationErr == nil {
+		tt.Fatal("want validation error, got nil")
+	}
+
+	notFoundErr := fmt.Errorf("%w: there is no movie entry with id 123", service.ErrNotFound)
+	conflictErr := &service.ConflictError{ID: "123"}
+
+	testCases := []struct {
+		name     string
+		err      error
+		exitCode int
+		text     string
+	}{
+		{"other", errors.New("media-db: failed"), getErrorExitCode(), "media-db: failed"},
+		{"validation", validationErr, getValidationExitCode(), "media-db: -title cannot be null, got \"\""},
+		{"wrapped-validation", fmt.Errorf("line 2: %w", validationErr), getValidationExitCode(), "media-db: -title cannot be null, got \"\""},
+		{"not-found", notFoundErr, getNotFoundExitCode(), GetNotFoundHelpText(notFoundErr)},
+		{"conflict", conflictErr, getConflictExitCode(), GetConflictHelpText(conflictErr)},
+		{"conflict-help", conflictHelp(conflictErr), getConflictExitCode(), GetConflictHelpText(conflictErr)},
+		{"help", withHelp(notFoundErr, "help"), getNotFoundExitCode(), "help"},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			if exitCode := getExitCode(test.err, getErrorExitCode()); exitCode != test.exitCode {
+				subtt.Fatalf("want exit code %d, got %d", test.exitCode, exitCode)
+			}
+
+			if text := getErrorText(test.err); text != test.text {
+				subtt.Fatalf("want %q, got %q", test.text, text)
+			}
+		})
+	}
+}
+
+func TestGetInterruptedHelpText(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		cmdName string
+		err     error
+		want    string
+	}{
+		{"read", ReadCmdName(), context.Canceled, "media-db: interrupted\n\nthe command does not change the database"},
+		{"update", UpdateCmdName(), context.Canceled, "media-db: interrupted\n\nthe command was interrupted while changing the database, so the change may\nor may not have been made"},
+		{"import", ImportCmdName(), errors.New("media-db: line 3: context canceled"), "media-db: line 3: context canceled\n\nthe command was interrupted part of the way through, so the changes reported\nabove were made"},
+		{"restore", RestoreCmdName(), context.Canceled, "media-db: interrupted\n\nthe command was interrupted part of the way through"},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			if got := GetInterruptedHelpText(test.cmdName, test.err); !strings.HasPrefix(got, test.want) {
+				subtt.Fatalf("want prefix %q, got %q", test.want, got)
+			}
+		})
+	}
+}
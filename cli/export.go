@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexpcook/media-db/mediafile"
+	"github.com/alexpcook/media-db/schema"
+)
+
+// ExportCommand provides an interface between the CLI and the MediaDbClient read service
+// for writing the database to a file.
+type ExportCommand struct {
+	FlagSet   *flag.FlagSet
+	File      string
+	Format    string
+	MediaType schema.Media
+}
+
+// NewExportCommand returns a pointer to a new ExportCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewExportCommand(args []string) (*ExportCommand, error) {
+	exportCmd := &ExportCommand{
+		FlagSet: flag.NewFlagSet("export", flag.ContinueOnError),
+	}
+
+	exportCmd.FlagSet.StringVar(&exportCmd.Format, "format", "", fmt.Sprintf("The format of the file, one of %s (optional, default: from the file extension, or csv)", strings.Join(mediafile.GetFormats(), ", ")))
+	exportCmd.FlagSet.StringVar(&exportCmd.File, "o", "", "The file to write (optional, default: standard output)")
+
+	// The media type may come before or after the flags.
+	positionalArgs := make([]string, 0, 1)
+	flagArgs := args[1:]
+	for {
+		err := exportCmd.FlagSet.Parse(flagArgs)
+		if err != nil {
+			return nil, err
+		}
+		if exportCmd.FlagSet.NArg() == 0 {
+			break
+		}
+		positionalArgs = append(positionalArgs, exportCmd.FlagSet.Arg(0))
+		flagArgs = exportCmd.FlagSet.Args()[1:]
+	}
+
+	switch len(positionalArgs) {
+	case 0:
+	case 1:
+		// Files for other services are given as a subcommand.
+		if positionalArgs[0] == mediafile.LetterboxdFormat() {
+			exportCmd.Format = positionalArgs[0]
+			exportCmd.MediaType = schema.Movie{}
+			return exportCmd, nil
+		}
+
+		mediaType, err := schema.GetMediaTypeFromName(positionalArgs[0])
+		if err != nil {
+			return nil, errors.New(GetInvalidMediaTypeHelpText(ExportCmdName(), positionalArgs[0]))
+		}
+		exportCmd.MediaType = mediaType
+	default:
+		return nil, errors.New(GetCommandHelpText(ExportCmdName()))
+	}
+
+	if exportCmd.Format == "" {
+		exportCmd.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(exportCmd.File)), ".")
+		if !isFormat(exportCmd.Format) {
+			exportCmd.Format = mediafile.CSVFormat()
+		}
+	}
+	if !isFormat(exportCmd.Format) {
+		return nil, fmt.Errorf("media-db: '%s' is an invalid format, want one of '%s'\n\n%s", exportCmd.Format, strings.Join(mediafile.GetFormats(), ", "), GetCommandHelpText(ExportCmdName()))
+	}
+
+	return exportCmd, nil
+}
+
+// Run executes the ExportCommand. It returns a non-nil error if the
+// underlying read service encounters a problem or the file cannot be
+// written. Entries are read and written one page at a time, so that the
+// whole library is never held in memory at once. The file is only replaced
+// once every entry has been written.
+func (e *ExportCommand) Run(ctx context.Context) (err error) {
+	var w io.Writer = os.Stdout
+	if e.File != "" {
+		var file *outputFile
+		file, err = createOutputFile(e.File)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = file.close(err)
+		}()
+		w = file
+	}
+
+	writer, err := mediafile.NewWriter(w, e.Format)
+	if err != nil {
+		return err
+	}
+
+	mediaTypes := schema.GetAllMediaTypes()
+	if e.MediaType != nil {
+		mediaTypes = []schema.Media{e.MediaType}
+	}
+
+	numEntries := 0
+	for _, mediaType := range mediaTypes {
+		token := ""
+		for {
+			page, err := MediaDbClient.ReadPage(ctx, "", mediaType, 0, token)
+			if err != nil {
+				return err
+			}
+
+			for _, media := range page.Media {
+				err = writer.Write(media)
+				if err != nil {
+					return err
+				}
+			}
+			numEntries += len(page.Media)
+
+			if page.NextToken == "" {
+				break
+			}
+			token = page.NextToken
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	// The summary would be mixed into the exported entries on standard output.
+	if e.File != "" {
+		StdoutLogger.Printf("exported %d entries", numEntries)
+	}
+
+	return nil
+}
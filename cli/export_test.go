@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestNewExportCommand(tt *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		file      string
+		format    string
+		mediaType schema.Media
+		isError   bool
+	}{
+		{"valid-stdout", []string{"export"}, "", "csv", nil, false},
+		{"valid-extension", []string{"export", "-o", "library.ndjson"}, "library.ndjson", "ndjson", nil, false},
+		{"valid-unknown-extension", []string{"export", "-o", "library.txt"}, "library.txt", "csv", nil, false},
+		{"valid-type-before-flags", []string{"export", "movie", "--format=json", "-o", "movies"}, "movies", "json", schema.Movie{}, false},
+		{"valid-type-after-flags", []string{"export", "--format=json", "music", "-o", "music.csv"}, "music.csv", "json", schema.Music{}, false},
+		{"valid-letterboxd", []string{"export", "letterboxd", "-o", "diary.csv"}, "diary.csv", "letterboxd", schema.Movie{}, false},
+		{"invalid-format", []string{"export", "-format=xml"}, "", "", nil, true},
+		{"invalid-media-type", []string{"export", "book"}, "", "", nil, true},
+		{"extra-args", []string{"export", "movie", "music"}, "", "", nil, true},
+		{"invalid-flag", []string{"export", "-notaflag"}, "", "", nil, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			exportCmd, err := NewExportCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if exportCmd.File != test.file {
+				subtt.Fatalf("want file %s, got %s", test.file, exportCmd.File)
+			}
+
+			if exportCmd.Format != test.format {
+				subtt.Fatalf("want format %s, got %s", test.format, exportCmd.Format)
+			}
+
+			if !reflect.DeepEqual(exportCmd.MediaType, test.mediaType) {
+				subtt.Fatalf("want media type %T, got %T", test.mediaType, exportCmd.MediaType)
+			}
+		})
+	}
+}
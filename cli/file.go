@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// outputFile is a file that a command writes in full before it replaces
+// the file with its name. It is written under a temporary name in the same
+// directory, so that a command that fails or is interrupted never leaves a
+// partial file behind, or over a previous file with the same name.
+type outputFile struct {
+	*os.File
+	name string
+}
+
+// createOutputFile creates a temporary file to be renamed to name by close.
+func createOutputFile(name string) (*outputFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	// A temporary file is only readable by its owner, unlike a file
+	// created with os.Create.
+	err = file.Chmod(0644)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &outputFile{File: file, name: name}, nil
+}
+
+// close closes the file and, if err is nil, renames it to its name.
+// Otherwise, or if the file cannot be closed or renamed, the temporary
+// file is removed. It returns err, or else the error from closing or
+// renaming the file.
+func (f *outputFile) close(err error) error {
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.File.Name(), f.name)
+	}
+	if err != nil {
+		os.Remove(f.File.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputFile(tt *testing.T) {
+	testCases := []struct {
+		name     string
+		writeErr error
+		want     string
+	}{
+		{"written", nil, "new"},
+		{"failed", errors.New("interrupted"), "old"},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			dir := subtt.TempDir()
+			name := filepath.Join(dir, "library.csv")
+			err := os.WriteFile(name, []byte("old"), 0644)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			file, err := createOutputFile(name)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			_, err = file.WriteString("new")
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			err = file.close(test.writeErr)
+			if !errors.Is(err, test.writeErr) {
+				subtt.Fatalf("want %v, got %v", test.writeErr, err)
+			}
+
+			data, err := os.ReadFile(name)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			if string(data) != test.want {
+				subtt.Fatalf("want %q, got %q", test.want, data)
+			}
+
+			// The temporary file is never left behind.
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			if len(entries) != 1 {
+				subtt.Fatalf("want only %s, got %v", name, entries)
+			}
+		})
+	}
+}
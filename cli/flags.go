@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// countSetFlags returns how many of the named flags were set on the command
+// line. Commands that require an exact number of flags subtract the count
+// of their optional flags from the total so that they can be omitted.
+func countSetFlags(flagSet *flag.FlagSet, names ...string) int {
+	count := 0
+
+	flagSet.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				count++
+			}
+		}
+	})
+
+	return count
+}
+
+// getUnsetFlags returns the named flags that were not set on the command
+// line, in the order they are named.
+func getUnsetFlags(flagSet *flag.FlagSet, names ...string) []string {
+	isSet := make(map[string]bool)
+	flagSet.Visit(func(f *flag.Flag) {
+		isSet[f.Name] = true
+	})
+
+	unset := make([]string, 0, len(names))
+	for _, name := range names {
+		if !isSet[name] {
+			unset = append(unset, name)
+		}
+	}
+
+	return unset
+}
+
+// parseAge parses an age such as "30d" or "12h". In addition to the units
+// accepted by time.ParseDuration, a whole number of days may be given with
+// the "d" suffix.
+func parseAge(age string) (time.Duration, error) {
+	if days := strings.TrimSuffix(age, "d"); days != age {
+		numDays, err := strconv.Atoi(days)
+		if err != nil || numDays < 0 {
+			return 0, fmt.Errorf("%q is not a valid number of days", age)
+		}
+		return time.Duration(numDays) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(age)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("%q is not a valid age, want a value such as 30d or 12h", age)
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
+)
+
+// HistoryCommand provides an interface between the CLI and the MediaDbClient history service.
+type HistoryCommand struct {
+	FlagSet   *flag.FlagSet
+	ID        string
+	MediaType schema.Media
+}
+
+// NewHistoryCommand returns a pointer to a new HistoryCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewHistoryCommand(args []string) (*HistoryCommand, error) {
+	if len(args) < 2 {
+		return nil, errors.New(GetCommandHelpText(HistoryCmdName()))
+	}
+
+	mediaType := args[1]
+	historyCmd := &HistoryCommand{}
+
+	switch mediaType {
+	case MovieMediaType():
+		historyCmd.FlagSet = flag.NewFlagSet("history movie", flag.ContinueOnError)
+		historyCmd.MediaType = schema.Movie{}
+	case MusicMediaType():
+		historyCmd.FlagSet = flag.NewFlagSet("history music", flag.ContinueOnError)
+		historyCmd.MediaType = schema.Music{}
+	default:
+		return nil, errors.New(GetInvalidMediaTypeHelpText(HistoryCmdName(), mediaType))
+	}
+
+	historyCmd.FlagSet.StringVar(&historyCmd.ID, "id", "", "The id in the database to show the history of")
+
+	err := historyCmd.FlagSet.Parse(args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	expectFlags := 1
+	if gotFlags := historyCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+		historyCmd.FlagSet.Usage()
+		return nil, errors.New("")
+	}
+
+	return historyCmd, nil
+}
+
+// Run executes the HistoryCommand. It returns a non-nil error
+// if the underlying history service encounters a problem. Each
+// version is written to standard output, from the most recent
+// to the oldest, with the fields that changed in that version.
+func (h *HistoryCommand) Run(ctx context.Context) error {
+	history, err := MediaDbClient.History(ctx, h.ID, h.MediaType)
+	if err != nil {
+		return err
+	}
+
+	for i, entryVersion := range history {
+		var previous *service.EntryVersion
+		if i+1 < len(history) {
+			previous = &history[i+1]
+		}
+
+		StdoutLogger.Println(getVersionText(entryVersion, previous))
+	}
+
+	return nil
+}
+
+// getVersionText describes a version of an entry by the changes made to
+// its fields since the previous version, which is nil for the oldest
+// version. A version that cannot be read is shown as such, and a version
+// after one that cannot be read is shown with all of its fields.
+func getVersionText(entryVersion service.EntryVersion, previous *service.EntryVersion) string {
+	lines := []string{fmt.Sprintf("version: %s", entryVersion.Version)}
+	if entryVersion.Current {
+		lines[0] += " (current)"
+	}
+	lines = append(lines, fmt.Sprintf("  modified: %s", entryVersion.Modified.Format(time.RFC3339)))
+
+	media := entryVersion.Media
+	switch {
+	case entryVersion.Err != nil:
+		lines = append(lines, "  cannot be read, it is encrypted with a key that is no longer used")
+	case media == nil:
+		lines = append(lines, "  deleted")
+	case previous != nil && previous.Err != nil:
+		for _, change := range schema.DiffFields(nil, media) {
+			lines = append(lines, fmt.Sprintf("  %s: %s", change.Field, change.New))
+		}
+	case previous == nil || previous.Media == nil:
+		lines = append(lines, "  created")
+		for _, change := range schema.DiffFields(nil, media) {
+			lines = append(lines, fmt.Sprintf("  %s: %s", change.Field, change.New))
+		}
+	default:
+		for _, change := range schema.DiffFields(previous.Media, media) {
+			lines = append(lines, fmt.Sprintf("  %s: %q -> %q", change.Field, change.Old, change.New))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
+)
+
+func TestNewHistoryCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-1", []string{"history", "movie", "-id", "123"}, false},
+		{"valid-2", []string{"history", "music", "-id=123"}, false},
+		{"no-media-type", []string{"history"}, true},
+		{"no-id", []string{"history", "movie"}, true},
+		{"invalid-media-type", []string{"history", "invalid", "-id", "123"}, true},
+		{"invalid-flags", []string{"history", "movie", "-notaflag", "123"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewHistoryCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGetVersionText(tt *testing.T) {
+	modified := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	music := schema.Music{ID: "123", Title: "A Title", Artist: "An Artist", YearMade: 1977}
+	updatedMusic := music
+	updatedMusic.Title = "An Updated Title"
+
+	testCases := []struct {
+		name     string
+		current  bool
+		previous *service.EntryVersion
+		media    schema.Media
+		err      error
+		want     string
+	}{
+		{"updated", true, &service.EntryVersion{Media: music}, updatedMusic, nil, `version: 2 (current)
+  modified: 2021-08-01T12:00:00Z
+  title: "A Title" -> "An Updated Title"`},
+		{"created", false, nil, music, nil, `version: 2
+  modified: 2021-08-01T12:00:00Z
+  created
+  id: 123
+  title: A Title
+  artist: An Artist
+  year: 1977
+  date: 1970-01-01`},
+		{"deleted", false, &service.EntryVersion{Media: music}, nil, nil, `version: 2
+  modified: 2021-08-01T12:00:00Z
+  deleted`},
+		{"unreadable", false, &service.EntryVersion{Media: music}, nil, service.ErrDecryption, `version: 2
+  modified: 2021-08-01T12:00:00Z
+  cannot be read, it is encrypted with a key that is no longer used`},
+		{"after-unreadable", false, &service.EntryVersion{Err: service.ErrDecryption}, updatedMusic, nil, `version: 2
+  modified: 2021-08-01T12:00:00Z
+  id: 123
+  title: An Updated Title
+  artist: An Artist
+  year: 1977
+  date: 1970-01-01`},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			entryVersion := service.EntryVersion{Version: "2", Current: test.current, Modified: modified, Media: test.media, Err: test.err}
+			if got := getVersionText(entryVersion, test.previous); test.want != got {
+				subtt.Fatalf("want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/mediafile"
+	"github.com/alexpcook/media-db/schema"
+)
+
+// ImportCommand provides an interface between the CLI and the MediaDbClient batch create service.
+type ImportCommand struct {
+	FlagSet         *flag.FlagSet
+	Files           []string
+	Format          string
+	MediaType       schema.Media
+	MinPlayDuration time.Duration
+}
+
+// NewImportCommand returns a pointer to a new ImportCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewImportCommand(args []string) (*ImportCommand, error) {
+	importCmd := &ImportCommand{
+		FlagSet: flag.NewFlagSet("import", flag.ContinueOnError),
+	}
+
+	// Files from other services have their own import subcommand.
+	if len(args) >= 2 {
+		switch args[1] {
+		case mediafile.LetterboxdFormat():
+			return newServiceImportCommand(importCmd, args[1], args[2:], schema.Movie{})
+		case mediafile.LastfmFormat(), mediafile.SpotifyFormat():
+			return newServiceImportCommand(importCmd, args[1], args[2:], schema.Music{})
+		}
+	}
+
+	var mediaType string
+	importCmd.FlagSet.StringVar(&importCmd.Format, "format", "", fmt.Sprintf("The format of the file, one of %s (optional, default: from the file extension)", strings.Join(mediafile.GetFormats(), ", ")))
+	importCmd.FlagSet.StringVar(&mediaType, "type", "", fmt.Sprintf("The media type of every entry in the file, one of %s (optional, default: from the type field of each entry)", strings.Join(GetMediaTypes(), ", ")))
+
+	err := importCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if importCmd.FlagSet.NArg() != 1 {
+		return nil, errors.New(GetCommandHelpText(ImportCmdName()))
+	}
+	importCmd.Files = importCmd.FlagSet.Args()
+
+	if importCmd.Format == "" {
+		importCmd.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(importCmd.Files[0])), ".")
+	}
+	if !isFormat(importCmd.Format) {
+		return nil, fmt.Errorf("media-db: '%s' is an invalid format, want one of '%s'\n\n%s", importCmd.Format, strings.Join(mediafile.GetFormats(), ", "), GetCommandHelpText(ImportCmdName()))
+	}
+
+	if mediaType != "" {
+		importCmd.MediaType, err = schema.GetMediaTypeFromName(mediaType)
+		if err != nil {
+			return nil, errors.New(GetInvalidMediaTypeHelpText(ImportCmdName(), mediaType))
+		}
+	}
+
+	return importCmd, nil
+}
+
+// newServiceImportCommand completes importCmd for files exported from
+// another service, which are in that service's format. Every entry in
+// the files is of the given media type.
+func newServiceImportCommand(importCmd *ImportCommand, format string, args []string, mediaType schema.Media) (*ImportCommand, error) {
+	importCmd.FlagSet = flag.NewFlagSet("import "+format, flag.ContinueOnError)
+	if isListeningFormat(format) {
+		importCmd.FlagSet.DurationVar(&importCmd.MinPlayDuration, "min-play", mediafile.GetDefaultMinPlayDuration(), "The shortest play of a track that is counted as a listen (optional)")
+	}
+
+	err := importCmd.FlagSet.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if importCmd.FlagSet.NArg() == 0 {
+		return nil, errors.New(GetCommandHelpText(ImportCmdName()))
+	}
+	if importCmd.MinPlayDuration < 0 {
+		return nil, fmt.Errorf("the minimum play duration cannot be negative, got %s", importCmd.MinPlayDuration)
+	}
+
+	importCmd.Files = importCmd.FlagSet.Args()
+	importCmd.Format = format
+	importCmd.MediaType = mediaType
+
+	return importCmd, nil
+}
+
+// isListeningFormat reports whether format is the format of a
+// listening history, which records every play of each track.
+func isListeningFormat(format string) bool {
+	return format == mediafile.LastfmFormat() || format == mediafile.SpotifyFormat()
+}
+
+// isFormat reports whether format is a supported file format.
+func isFormat(format string) bool {
+	for _, validFormat := range mediafile.GetFormats() {
+		if format == validFormat {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run executes the ImportCommand. It returns a non-nil error if a file
+// cannot be read, the underlying batch create service encounters a problem,
+// or any entry cannot be imported. Entries that cannot be imported are
+// reported to standard error with their line number in the file, and
+// every valid entry is still imported.
+func (i *ImportCommand) Run(ctx context.Context) error {
+	if isListeningFormat(i.Format) {
+		return i.runListening(ctx)
+	}
+
+	rows := make([]mediafile.Row, 0)
+	for _, fileName := range i.Files {
+		fileRows, err := readFile(fileName, func(file *os.File) ([]mediafile.Row, error) {
+			return mediafile.Read(file, i.Format, i.MediaType)
+		})
+		if err != nil {
+			return err
+		}
+		rows = append(rows, fileRows...)
+	}
+
+	return importRows(ctx, rows)
+}
+
+// runListening imports the tracks played in listening history files. The
+// plays of each track are combined into a single entry, and the plays of
+// tracks that are already in the database are merged into their entries.
+func (i *ImportCommand) runListening(ctx context.Context) error {
+	plays := make([]mediafile.Play, 0)
+	for _, fileName := range i.Files {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+
+		var filePlays []mediafile.Play
+		if i.Format == mediafile.LastfmFormat() {
+			filePlays, err = mediafile.ReadLastfm(file, fileName)
+		} else {
+			filePlays, err = mediafile.ReadSpotify(file, fileName)
+		}
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+
+		plays = append(plays, filePlays...)
+	}
+
+	existing, err := MediaDbClient.Read(ctx, "", schema.Music{})
+	if err != nil {
+		return err
+	}
+
+	existingMusic := make(map[string]schema.Music, len(existing))
+	for _, media := range existing {
+		if music, ok := media.(schema.Music); ok {
+			existingMusic[mediafile.MatchKey(music.Title, music.Artist)] = music
+		}
+	}
+
+	rows := make([]mediafile.Row, 0)
+	mergeRows := make([]mediafile.Row, 0)
+	mergeIDs := make([]string, 0)
+	for _, row := range mediafile.AggregatePlays(plays, i.MinPlayDuration) {
+		if music, ok := row.Media.(schema.Music); ok {
+			if stored, ok := existingMusic[mediafile.MatchKey(music.Title, music.Artist)]; ok {
+				mergeRows = append(mergeRows, row)
+				mergeIDs = append(mergeIDs, stored.ID)
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	mergeErr := mergeListens(ctx, mergeRows, mergeIDs)
+	err = importRows(ctx, rows)
+	if err != nil {
+		return err
+	}
+
+	return mergeErr
+}
+
+// mergePlays returns stored with the listens in imported merged into it,
+// and whether that changed it. A listening history may include plays that
+// are already counted, so the larger play count is kept instead of the
+// sum, and importing the same history again changes nothing.
+func mergePlays(stored, imported schema.Music) (schema.Music, bool) {
+	merged := stored
+	if imported.DateListened < merged.DateListened {
+		merged.DateListened = imported.DateListened
+	}
+	if imported.LastListened > merged.LastListened {
+		merged.LastListened = imported.LastListened
+	}
+	if imported.Plays > merged.Plays {
+		merged.Plays = imported.Plays
+	}
+
+	return merged, merged != stored
+}
+
+// mergeListens merges the listens in rows into the entries with the
+// matching ids that are already in the database. Each entry is read again
+// and only updated if it has not changed since, so that a concurrent
+// change is never overwritten. Entries that cannot be merged are reported
+// with their file and line number.
+func mergeListens(ctx context.Context, rows []mediafile.Row, ids []string) error {
+	numMerged, numFailed := 0, 0
+	for j, row := range rows {
+		if ctx.Err() != nil {
+			numFailed += len(rows) - j
+			break
+		}
+
+		stored, etag, err := MediaDbClient.ReadEntry(ctx, ids[j], schema.Music{})
+		if err == nil {
+			merged, changed := mergePlays(stored.(schema.Music), row.Media.(schema.Music))
+			if !changed {
+				continue
+			}
+			err = MediaDbClient.Update(ctx, ids[j], merged, etag)
+		}
+		if err != nil {
+			StderrLogger.Printf("%s:%d: %s", row.File, row.Line, err)
+			numFailed++
+			continue
+		}
+		numMerged++
+	}
+
+	if len(rows) > 0 {
+		StdoutLogger.Printf("updated the plays of %d of %d tracks that are already in the database", numMerged, len(rows))
+	}
+	if numFailed > 0 {
+		return fmt.Errorf("%d of %d tracks that are already in the database could not be updated", numFailed, len(rows))
+	}
+
+	return nil
+}
+
+// readFile opens the named file and reads entries from it with read. The
+// entries are labeled with the file name, and the errors are prefixed with it.
+func readFile(fileName string, read func(file *os.File) ([]mediafile.Row, error)) ([]mediafile.Row, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	for j := range rows {
+		rows[j].File = fileName
+	}
+
+	return rows, nil
+}
+
+// importRows creates the valid entries in rows and reports the rows that
+// could not be imported with their file and line number. Warnings about
+// the entries that were imported are also reported.
+func importRows(ctx context.Context, rows []mediafile.Row) error {
+	validRows := make([]mediafile.Row, 0, len(rows))
+	media := make([]schema.Media, 0, len(rows))
+	numFailed := 0
+
+	for _, row := range rows {
+		if row.Err != nil {
+			StderrLogger.Printf("%s:%d: %s", row.File, row.Line, row.Err)
+			numFailed++
+			continue
+		}
+		validRows = append(validRows, row)
+		media = append(media, row.Media)
+	}
+
+	errs, err := MediaDbClient.CreateBatch(ctx, media)
+	numWarnings, numInterrupted := 0, 0
+	for j := range errs {
+		if errors.Is(errs[j], context.Canceled) {
+			numInterrupted++
+			numFailed++
+		} else if errs[j] != nil {
+			StderrLogger.Printf("%s:%d: %s", validRows[j].File, validRows[j].Line, errs[j])
+			numFailed++
+		} else if validRows[j].Warning != "" {
+			StderrLogger.Printf("%s:%d: warning: %s (id: %s)", validRows[j].File, validRows[j].Line, validRows[j].Warning, schema.GetIDFromKey(media[j].Key()))
+			numWarnings++
+		}
+	}
+
+	StdoutLogger.Printf("imported %d entries", len(rows)-numFailed)
+	if numInterrupted > 0 {
+		StdoutLogger.Printf("%d entries were not imported because the import was interrupted", numInterrupted)
+	}
+	if numWarnings > 0 {
+		StdoutLogger.Printf("%d imported entries have warnings, correct them with 'media-db %s'", numWarnings, UpdateCmdName())
+	}
+
+	if err != nil {
+		return err
+	}
+	if numFailed > 0 {
+		return fmt.Errorf("%d of %d entries could not be imported", numFailed, len(rows))
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestNewImportCommand(tt *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		format    string
+		mediaType schema.Media
+		isError   bool
+	}{
+		{"valid-csv", []string{"import", "movies.csv"}, "csv", nil, false},
+		{"valid-json", []string{"import", "-format=json", "media.txt"}, "json", nil, false},
+		{"valid-ndjson", []string{"import", "--format", "ndjson", "-type", "music", "music.log"}, "ndjson", schema.Music{}, false},
+		{"valid-extension-case", []string{"import", "-type=movie", "MOVIES.CSV"}, "csv", schema.Movie{}, false},
+		{"valid-letterboxd", []string{"import", "letterboxd", "diary.csv"}, "letterboxd", schema.Movie{}, false},
+		{"valid-lastfm", []string{"import", "lastfm", "scrobbles.csv"}, "lastfm", schema.Music{}, false},
+		{"valid-spotify", []string{"import", "spotify", "-min-play=1m", "Streaming_History_Audio_2020.json", "Streaming_History_Audio_2021.json"}, "spotify", schema.Music{}, false},
+		{"spotify-negative-min-play", []string{"import", "spotify", "-min-play=-1s", "history.json"}, "", nil, true},
+		{"letterboxd-min-play", []string{"import", "letterboxd", "-min-play=1m", "diary.csv"}, "", nil, true},
+		{"letterboxd-no-file", []string{"import", "letterboxd"}, "", nil, true},
+		{"letterboxd-format-flag", []string{"import", "letterboxd", "-format=json", "diary.csv"}, "", nil, true},
+		{"no-file", []string{"import", "-format=csv"}, "", nil, true},
+		{"extra-args", []string{"import", "a.csv", "b.csv"}, "", nil, true},
+		{"unknown-extension", []string{"import", "movies.txt"}, "", nil, true},
+		{"invalid-format", []string{"import", "-format=xml", "movies.csv"}, "", nil, true},
+		{"invalid-media-type", []string{"import", "-type=book", "books.csv"}, "", nil, true},
+		{"invalid-flag", []string{"import", "-notaflag", "movies.csv"}, "", nil, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			importCmd, err := NewImportCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if importCmd.Format != test.format {
+				subtt.Fatalf("want format %s, got %s", test.format, importCmd.Format)
+			}
+
+			if !reflect.DeepEqual(importCmd.MediaType, test.mediaType) {
+				subtt.Fatalf("want media type %T, got %T", test.mediaType, importCmd.MediaType)
+			}
+		})
+	}
+}
+
+func TestMergePlays(tt *testing.T) {
+	stored := schema.Music{ID: "123", Title: "A Title", Artist: "An Artist", DateListened: 200, LastListened: 300, Plays: 5}
+
+	testCases := []struct {
+		name      string
+		imported  schema.Music
+		want      schema.Music
+		isChanged bool
+	}{
+		{"more-plays", schema.Music{DateListened: 200, LastListened: 400, Plays: 7},
+			schema.Music{ID: "123", Title: "A Title", Artist: "An Artist", DateListened: 200, LastListened: 400, Plays: 7}, true},
+		{"earlier-listen", schema.Music{DateListened: 100, LastListened: 300, Plays: 5},
+			schema.Music{ID: "123", Title: "A Title", Artist: "An Artist", DateListened: 100, LastListened: 300, Plays: 5}, true},
+		{"same-history", schema.Music{DateListened: 200, LastListened: 300, Plays: 5}, stored, false},
+		{"older-history", schema.Music{DateListened: 200, LastListened: 250, Plays: 2}, stored, false},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			merged, isChanged := mergePlays(stored, test.imported)
+
+			if merged != test.want {
+				subtt.Fatalf("want %v, got %v", test.want, merged)
+			}
+			if isChanged != test.isChanged {
+				subtt.Fatalf("want changed %t, got %t", test.isChanged, isChanged)
+			}
+		})
+	}
+}
@@ -1,13 +1,15 @@
 package cli
 
 import (
+	"context"
 	"errors"
 )
 
 // MediaDbCommand defines methods common to all CLI commands.
 type MediaDbCommand interface {
 	// Run executes the CLI command and returns any errors encountered during execution.
-	Run() error
+	// The command stops making changes to the database once ctx is cancelled.
+	Run(ctx context.Context) error
 }
 
 // NewMediaDbCommand parses args from the command line and returns the appropriate
@@ -18,17 +20,55 @@ func NewMediaDbCommand(args []string) (MediaDbCommand, error) {
 	case SetupCmdName():
 		return NewSetupCommand(args)
 	case CreateCmdName():
-		InitDb()
+		InitDbOrQueue()
 		return NewCreateCommand(args)
 	case ReadCmdName():
 		InitDb()
 		return NewReadCommand(args)
 	case UpdateCmdName():
-		InitDb()
+		InitDbOrQueue()
 		return NewUpdateCommand(args)
 	case DeleteCmdName():
-		InitDb()
+		InitDbOrQueue()
 		return NewDeleteCommand(args)
+	case ReindexCmdName():
+		InitDb()
+		return NewReindexCommand(args)
+	case TrashCmdName():
+		InitDb()
+		return NewTrashCommand(args)
+	case RestoreCmdName():
+		InitDb()
+		return NewRestoreCommand(args)
+	case HistoryCmdName():
+		InitDb()
+		return NewHistoryCommand(args)
+	case RevertCmdName():
+		InitDb()
+		return NewRevertCommand(args)
+	case ImportCmdName():
+		InitDb()
+		return NewImportCommand(args)
+	case ExportCmdName():
+		InitDb()
+		return NewExportCommand(args)
+	case SyncCmdName():
+		return NewSyncCommand(args)
+	case RekeyCmdName():
+		InitDb()
+		return NewRekeyCommand(args)
+	case PushCmdName():
+		InitDb()
+		return NewPushCommand(args)
+	case BackupCmdName():
+		InitDb()
+		return NewBackupCommand(args)
+	case MigrateCmdName():
+		InitDb()
+		return NewMigrateCommand(args)
+	case StatsCmdName():
+		InitDb()
+		return NewStatsCommand(args)
 	default:
 		return nil, errors.New(GetInvalidCommandHelpText(cmd))
 	}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// MigrateCommand provides an interface between the CLI and the MediaDbClient migrate service.
+type MigrateCommand struct {
+	FlagSet *flag.FlagSet
+	DryRun  bool
+}
+
+// NewMigrateCommand returns a pointer to a new MigrateCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewMigrateCommand(args []string) (*MigrateCommand, error) {
+	migrateCmd := &MigrateCommand{
+		FlagSet: flag.NewFlagSet("migrate", flag.ContinueOnError),
+	}
+
+	migrateCmd.FlagSet.BoolVar(&migrateCmd.DryRun, "dry-run", false, "Count the objects to migrate without changing them (optional)")
+
+	err := migrateCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if migrateCmd.FlagSet.NArg() != 0 {
+		return nil, errors.New(GetCommandHelpText(MigrateCmdName()))
+	}
+
+	return migrateCmd, nil
+}
+
+// Run executes the MigrateCommand. It returns a non-nil error if the
+// underlying migrate service encounters a problem. A summary is written
+// to standard output.
+func (m *MigrateCommand) Run(ctx context.Context) error {
+	result, err := MediaDbClient.Migrate(ctx, m.DryRun)
+	if err != nil {
+		return err
+	}
+
+	if m.DryRun {
+		StdoutLogger.Printf("%d of %d objects would be migrated to schema version %d", result.Outdated, result.Checked, schema.GetSchemaVersion())
+	} else {
+		StdoutLogger.Printf("migrated %d of %d objects to schema version %d", result.Outdated, result.Checked, schema.GetSchemaVersion())
+	}
+
+	return nil
+}
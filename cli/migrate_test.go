@@ -0,0 +1,32 @@
+package cli
+
+import "testing"
+
+func TestNewMigrateCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid", []string{"migrate"}, false},
+		{"dry-run", []string{"migrate", "-dry-run"}, false},
+		{"invalid-flag", []string{"migrate", "-notaflag", "test"}, true},
+		{"extra-args", []string{"migrate", "movie"}, true},
+		{"dry-run-value", []string{"migrate", "-dry-run=maybe"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewMigrateCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,579 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/alexpcook/media-db/mediafile"
+	"github.com/alexpcook/media-db/query"
+	"github.com/alexpcook/media-db/schema"
+)
+
+// TextOutput returns the name of the output format that prints each entry
+// the way it is shown everywhere else in the CLI.
+func TextOutput() string {
+	return "text"
+}
+
+// TableOutput returns the name of the output format that prints the
+// entries in aligned columns, with one entry per row.
+func TableOutput() string {
+	return "table"
+}
+
+// YAMLOutput returns the name of the YAML output format, a list of entries.
+func YAMLOutput() string {
+	return "yaml"
+}
+
+// GetOutputFormats returns a slice of all the output formats of the read command.
+func GetOutputFormats() []string {
+	return []string{TextOutput(), TableOutput(), mediafile.JSONFormat(), mediafile.NDJSONFormat(), mediafile.CSVFormat(), YAMLOutput()}
+}
+
+// getDefaultOutputFields returns the fields that are shown by every output
+// format but text when the fields are not chosen. They are the columns of
+// an exported file.
+func getDefaultOutputFields() []string {
+	return mediafile.GetColumns()
+}
+
+// getGroupField returns the name of the field that holds the name
+// of the group of an entry, when the entries are grouped.
+func getGroupField() string {
+	return "group"
+}
+
+// parseOutputFields parses a comma-separated list of fields, such as
+// title,year,date. It returns a non-nil error if any field is not a
+// field of an entry.
+func parseOutputFields(s string) ([]string, error) {
+	fields := strings.Split(s, ",")
+	for i, field := range fields {
+		fields[i] = strings.ToLower(strings.TrimSpace(field))
+
+		isField := false
+		for _, name := range query.GetFields() {
+			isField = isField || fields[i] == name
+		}
+		if !isField {
+			return nil, fmt.Errorf("%q is not a field, want one of %s", field, strings.Join(query.GetFields(), ", "))
+		}
+	}
+
+	return fields, nil
+}
+
+// outputField is the value of a single field of an entry. The value
+// is nil if the entry does not have the field.
+type outputField struct {
+	name  string
+	value interface{}
+}
+
+// getOutputFields returns the values of the named fields of media. If
+// omitEmpty is true, the fields that media does not have are left out, and
+// so is a rewatch that is false, in the same way as in an exported file.
+func getOutputFields(media schema.Media, names []string, omitEmpty bool) []outputField {
+	fields := make([]outputField, 0, len(names))
+	for _, name := range names {
+		value, ok := query.GetValue(media, name)
+		if omitEmpty && (!ok || value == false) {
+			continue
+		}
+		fields = append(fields, outputField{name, value})
+	}
+
+	return fields
+}
+
+// formatValue returns value as it is shown in the text and table output
+// formats. A missing value is the empty string "".
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// marshalFields returns a JSON object of fields, in the order of fields.
+func marshalFields(fields []outputField) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, field := range fields {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// outputWriter writes the entries shown by the read command in an output
+// format. When the entries are grouped, startGroup is called before the
+// entries of each group.
+type outputWriter interface {
+	startGroup(name string, size int) error
+	write(media schema.Media) error
+	close() error
+}
+
+// outputOptions chooses how the entries shown by the read command are
+// written. Fields is nil to show the default fields, and Template is nil
+// unless each entry is written with a template.
+type outputOptions struct {
+	Format    string
+	Fields    []string
+	Template  *template.Template
+	IsGrouped bool
+}
+
+// newOutputWriter returns an outputWriter that writes entries to w.
+func newOutputWriter(w io.Writer, options outputOptions) (outputWriter, error) {
+	fields := options.Fields
+	omitEmpty := fields == nil
+	if fields == nil {
+		fields = getDefaultOutputFields()
+	}
+
+	switch {
+	case options.Template != nil:
+		return &templateOutputWriter{w: w, template: options.Template}, nil
+	case options.Format == TextOutput():
+		return &textOutputWriter{w: w, fields: options.Fields}, nil
+	case options.Format == TableOutput():
+		return &tableOutputWriter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0), fields: fields}, nil
+	case options.Format == mediafile.CSVFormat():
+		var extraColumns []string
+		if options.IsGrouped {
+			extraColumns = []string{getGroupField()}
+		}
+		csvWriter, err := mediafile.NewCSVWriter(w, extraColumns, fields)
+		if err != nil {
+			return nil, err
+		}
+		return &csvOutputWriter{csvWriter: csvWriter, isGrouped: options.IsGrouped}, nil
+	case options.Format == mediafile.JSONFormat():
+		return &jsonOutputWriter{w: w, fields: fields, omitEmpty: omitEmpty, isGrouped: options.IsGrouped}, nil
+	case options.Format == mediafile.NDJSONFormat():
+		return &ndjsonOutputWriter{w: w, fields: fields, omitEmpty: omitEmpty, isGrouped: options.IsGrouped}, nil
+	case options.Format == YAMLOutput():
+		return &yamlOutputWriter{w: w, fields: fields, omitEmpty: omitEmpty, isGrouped: options.IsGrouped}, nil
+	default:
+		return nil, fmt.Errorf("%q is not an output format, want one of %s", options.Format, strings.Join(GetOutputFormats(), ", "))
+	}
+}
+
+// writeGroupHeader writes the header that the text and template output
+// formats show before the entries of a group, with a blank line before
+// every header but the first.
+func writeGroupHeader(w io.Writer, isFirst bool, name string, size int) error {
+	separator := "\n"
+	if isFirst {
+		separator = ""
+	}
+
+	_, err := fmt.Fprintf(w, "%s== %s (%d) ==\n", separator, name, size)
+	return err
+}
+
+// textOutputWriter writes each entry the way it is printed by its String
+// method, or only the chosen fields in the same layout.
+type textOutputWriter struct {
+	w         io.Writer
+	fields    []string
+	numGroups int
+}
+
+func (tw *textOutputWriter) startGroup(name string, size int) error {
+	tw.numGroups++
+	return writeGroupHeader(tw.w, tw.numGroups == 1, name, size)
+}
+
+func (tw *textOutputWriter) write(media schema.Media) error {
+	if tw.fields == nil {
+		_, err := fmt.Fprintln(tw.w, media)
+		return err
+	}
+
+	lines := make([]string, 0, len(tw.fields))
+	for _, field := range getOutputFields(media, tw.fields, false) {
+		lines = append(lines, fmt.Sprintf("%s: %s", field.name, formatValue(field.value)))
+	}
+
+	_, err := fmt.Fprintln(tw.w, strings.Join(lines, "\n  "))
+	return err
+}
+
+func (tw *textOutputWriter) close() error {
+	return nil
+}
+
+// templateOutputWriter writes each entry with a template, followed by a
+// newline. The template is given a map of every field of the entry, so
+// that {{.title}} is the title, and a field that the entry does not have
+// is the empty string "".
+type templateOutputWriter struct {
+	w         io.Writer
+	template  *template.Template
+	numGroups int
+}
+
+func (tw *templateOutputWriter) startGroup(name string, size int) error {
+	tw.numGroups++
+	return writeGroupHeader(tw.w, tw.numGroups == 1, name, size)
+}
+
+// getTemplateData returns the data that a template is executed with
+// for media, which is a map of every field of the entry.
+func getTemplateData(media schema.Media) map[string]interface{} {
+	data := make(map[string]interface{})
+	for _, field := range getOutputFields(media, query.GetFields(), false) {
+		data[field.name] = field.value
+		if field.value == nil {
+			data[field.name] = ""
+		}
+	}
+
+	return data
+}
+
+// parseTemplate parses the template that each entry is written with. It
+// returns a non-nil error if the template is not valid or uses a field
+// that entries do not have.
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("entry").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tmpl.Execute(io.Discard, getTemplateData(schema.Movie{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+func (tw *templateOutputWriter) write(media schema.Media) error {
+	err := tw.template.Execute(tw.w, getTemplateData(media))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(tw.w, "\n")
+	return err
+}
+
+func (tw *templateOutputWriter) close() error {
+	return nil
+}
+
+// tableOutputWriter writes the entries in aligned columns under a header
+// row. When the entries are grouped, each group is a separate table under
+// a line with the name of the group.
+type tableOutputWriter struct {
+	w         *tabwriter.Writer
+	fields    []string
+	numGroups int
+	hasHeader bool
+}
+
+func (tw *tableOutputWriter) writeRow(cells []string) error {
+	_, err := fmt.Fprintln(tw.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (tw *tableOutputWriter) startGroup(name string, size int) error {
+	tw.numGroups++
+	if tw.numGroups != 1 {
+		if _, err := fmt.Fprintln(tw.w); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(tw.w, "%s (%d)\n", name, size)
+	tw.hasHeader = false
+	return err
+}
+
+func (tw *tableOutputWriter) write(media schema.Media) error {
+	if !tw.hasHeader {
+		header := make([]string, len(tw.fields))
+		for i, field := range tw.fields {
+			header[i] = strings.ToUpper(field)
+		}
+		if err := tw.writeRow(header); err != nil {
+			return err
+		}
+		tw.hasHeader = true
+	}
+
+	cells := make([]string, 0, len(tw.fields))
+	for _, field := range getOutputFields(media, tw.fields, false) {
+		cells = append(cells, formatValue(field.value))
+	}
+
+	return tw.writeRow(cells)
+}
+
+func (tw *tableOutputWriter) close() error {
+	return tw.w.Flush()
+}
+
+// csvOutputWriter writes a CSV file in the same way as an exported file,
+// but with only the chosen columns. When the entries are grouped, the
+// first column is the name of the group of each entry.
+type csvOutputWriter struct {
+	csvWriter *mediafile.CSVWriter
+	isGrouped bool
+	group     string
+}
+
+func (cw *csvOutputWriter) startGroup(name string, size int) error {
+	cw.group = name
+	return nil
+}
+
+func (cw *csvOutputWriter) write(media schema.Media) error {
+	if cw.isGrouped {
+		return cw.csvWriter.WriteWithExtra([]string{cw.group}, media)
+	}
+
+	return cw.csvWriter.Write(media)
+}
+
+func (cw *csvOutputWriter) close() error {
+	return cw.csvWriter.Close()
+}
+
+// jsonOutputWriter writes a JSON array with one entry per line. When the
+// entries are grouped, the array has an object for each group instead,
+// with the name of the group and an array of its entries.
+type jsonOutputWriter struct {
+	w          io.Writer
+	fields     []string
+	omitEmpty  bool
+	isGrouped  bool
+	numGroups  int
+	numEntries int
+}
+
+func (jw *jsonOutputWriter) startGroup(name string, size int) error {
+	group, err := json.Marshal(name)
+	if err != nil {
+		return err
+	}
+
+	separator := "\n  ]},\n  "
+	if jw.numGroups == 0 {
+		separator = "[\n  "
+	}
+	jw.numGroups++
+	jw.numEntries = 0
+
+	_, err = fmt.Fprintf(jw.w, `%s{"%s":%s,"entries":[`, separator, getGroupField(), group)
+	return err
+}
+
+func (jw *jsonOutputWriter) write(media schema.Media) error {
+	jsonData, err := marshalFields(getOutputFields(media, jw.fields, jw.omitEmpty))
+	if err != nil {
+		return err
+	}
+
+	indent := "\n  "
+	if jw.isGrouped {
+		indent = "\n    "
+	}
+
+	separator := "," + indent
+	switch {
+	case jw.numEntries == 0 && jw.isGrouped:
+		separator = indent
+	case jw.numEntries == 0:
+		separator = "[" + indent
+	}
+	jw.numEntries++
+
+	_, err = io.WriteString(jw.w, separator+string(jsonData))
+	return err
+}
+
+func (jw *jsonOutputWriter) close() error {
+	end := "\n]\n"
+	switch {
+	case jw.isGrouped && jw.numGroups == 0, !jw.isGrouped && jw.numEntries == 0:
+		end = "[]\n"
+	case jw.isGrouped:
+		end = "\n  ]}\n]\n"
+	}
+
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+// ndjsonOutputWriter writes one JSON object per line. When the entries are
+// grouped, each object starts with the name of the group of the entry.
+type ndjsonOutputWriter struct {
+	w         io.Writer
+	fields    []string
+	omitEmpty bool
+	isGrouped bool
+	group     string
+}
+
+func (nw *ndjsonOutputWriter) startGroup(name string, size int) error {
+	nw.group = name
+	return nil
+}
+
+func (nw *ndjsonOutputWriter) write(media schema.Media) error {
+	fields := getOutputFields(media, nw.fields, nw.omitEmpty)
+	if nw.isGrouped {
+		fields = append([]outputField{{getGroupField(), nw.group}}, fields...)
+	}
+
+	jsonData, err := marshalFields(fields)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(nw.w, "%s\n", jsonData)
+	return err
+}
+
+func (nw *ndjsonOutputWriter) close() error {
+	return nil
+}
+
+// yamlOutputWriter writes a YAML list of entries. When the entries are
+// grouped, the list has an item for each group instead, with the name of
+// the group and a list of its entries.
+type yamlOutputWriter struct {
+	w          io.Writer
+	fields     []string
+	omitEmpty  bool
+	isGrouped  bool
+	numEntries int
+}
+
+// yamlPlainPattern matches the strings that can be written as plain YAML
+// scalars. It is deliberately narrow, so that a string that starts with a
+// space or an indicator such as - or [, or contains :, # or a newline, is
+// quoted.
+var yamlPlainPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9 _.,'()/&-]*$`)
+
+// getYAMLReservedWords returns the plain scalars that YAML reads as
+// something other than a string, in lower case.
+func getYAMLReservedWords() []string {
+	return []string{"true", "false", "yes", "no", "on", "off", "y", "n", "null", "nan", "inf"}
+}
+
+// formatYAMLString returns s as a YAML scalar. It is a plain scalar when
+// that is read back as the same string, and a double-quoted scalar
+// otherwise, whose escapes are the same as Go's.
+func formatYAMLString(s string) string {
+	isPlain := yamlPlainPattern.MatchString(s) && !strings.HasSuffix(s, " ")
+	for _, word := range getYAMLReservedWords() {
+		isPlain = isPlain && strings.ToLower(s) != word
+	}
+
+	if isPlain {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// formatYAMLValue returns value as a YAML scalar.
+func formatYAMLValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return formatYAMLString(value), nil
+	case bool, int, int64, float64:
+		return formatValue(value), nil
+	default:
+		return "", fmt.Errorf("cannot write %v as YAML", value)
+	}
+}
+
+func (yw *yamlOutputWriter) startGroup(name string, size int) error {
+	group, err := formatYAMLValue(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(yw.w, "- %s: %s\n  entries:\n", getGroupField(), group)
+	return err
+}
+
+func (yw *yamlOutputWriter) write(media schema.Media) error {
+	yw.numEntries++
+
+	indent := ""
+	if yw.isGrouped {
+		indent = "  "
+	}
+
+	fields := getOutputFields(media, yw.fields, yw.omitEmpty)
+	if len(fields) == 0 {
+		_, err := fmt.Fprintf(yw.w, "%s- {}\n", indent)
+		return err
+	}
+
+	for i, field := range fields {
+		value, err := formatYAMLValue(field.value)
+		if err != nil {
+			return err
+		}
+
+		marker := "  "
+		if i == 0 {
+			marker = "- "
+		}
+
+		_, err = fmt.Fprintf(yw.w, "%s%s%s: %s\n", indent, marker, field.name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (yw *yamlOutputWriter) close() error {
+	if yw.numEntries == 0 {
+		_, err := io.WriteString(yw.w, "[]\n")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/query"
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestOutputWriter(tt *testing.T) {
+	movie := schema.Movie{ID: "1", Title: "Heat", Director: "Michael Mann", YearMade: 1995, DateWatched: 1620000000, Rating: 4.5}
+	music := schema.Music{ID: "2", Title: `Say "Hi"`, Artist: "AC/DC", YearMade: 1980, DateListened: 1610000000}
+
+	tmpl, err := parseTemplate("{{.title}} ({{.year}})")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		options outputOptions
+		want    string
+	}{
+		{"text-fields", outputOptions{Format: TextOutput(), Fields: []string{"title", "director"}}, "title: Heat\n  director: Michael Mann\ntitle: Say \"Hi\"\n  director: \n"},
+		{"text-grouped", outputOptions{Format: TextOutput(), Fields: []string{"title"}, IsGrouped: true}, "== movie (1) ==\ntitle: Heat\n\n== music (1) ==\ntitle: Say \"Hi\"\n"},
+		{"template", outputOptions{Format: TextOutput(), Template: tmpl}, "Heat (1995)\nSay \"Hi\" (1980)\n"},
+		{"table", outputOptions{Format: TableOutput(), Fields: []string{"title", "year"}}, "TITLE     YEAR\nHeat      1995\nSay \"Hi\"  1980\n"},
+		{"table-grouped", outputOptions{Format: TableOutput(), Fields: []string{"title"}, IsGrouped: true}, "movie (1)\nTITLE\nHeat\n\nmusic (1)\nTITLE\nSay \"Hi\"\n"},
+		{"csv", outputOptions{Format: "csv", Fields: []string{"title", "rating"}}, "title,rating\nHeat,4.5\n\"Say \"\"Hi\"\"\",\n"},
+		{"csv-grouped", outputOptions{Format: "csv", Fields: []string{"title"}, IsGrouped: true}, "group,title\nmovie,Heat\nmusic,\"Say \"\"Hi\"\"\"\n"},
+		{"json", outputOptions{Format: "json"}, "[\n  {\"type\":\"movie\",\"id\":\"1\",\"title\":\"Heat\",\"director\":\"Michael Mann\",\"year\":1995,\"date\":\"2021-05-03\",\"rating\":4.5},\n  {\"type\":\"music\",\"id\":\"2\",\"title\":\"Say \\\"Hi\\\"\",\"artist\":\"AC/DC\",\"year\":1980,\"date\":\"2021-01-07\"}\n]\n"},
+		{"json-fields", outputOptions{Format: "json", Fields: []string{"year", "director"}}, "[\n  {\"year\":1995,\"director\":\"Michael Mann\"},\n  {\"year\":1980,\"director\":null}\n]\n"},
+		{"json-grouped", outputOptions{Format: "json", Fields: []string{"title"}, IsGrouped: true}, "[\n  {\"group\":\"movie\",\"entries\":[\n    {\"title\":\"Heat\"}\n  ]},\n  {\"group\":\"music\",\"entries\":[\n    {\"title\":\"Say \\\"Hi\\\"\"}\n  ]}\n]\n"},
+		{"ndjson-grouped", outputOptions{Format: "ndjson", Fields: []string{"title"}, IsGrouped: true}, "{\"group\":\"movie\",\"title\":\"Heat\"}\n{\"group\":\"music\",\"title\":\"Say \\\"Hi\\\"\"}\n"},
+		{"yaml", outputOptions{Format: YAMLOutput(), Fields: []string{"title", "rating"}}, "- title: Heat\n  rating: 4.5\n- title: \"Say \\\"Hi\\\"\"\n  rating: null\n"},
+		{"yaml-grouped", outputOptions{Format: YAMLOutput(), Fields: []string{"title"}, IsGrouped: true}, "- group: movie\n  entries:\n  - title: Heat\n- group: music\n  entries:\n  - title: \"Say \\\"Hi\\\"\"\n"},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			var buf bytes.Buffer
+			writer, err := newOutputWriter(&buf, test.options)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			for _, group := range query.GroupBy([]schema.Media{music, movie}, "type", query.Order{}) {
+				if test.options.IsGrouped {
+					err = writer.startGroup(group.Name, len(group.Media))
+					if err != nil {
+						subtt.Fatal(err)
+					}
+				}
+				for _, media := range group.Media {
+					err = writer.write(media)
+					if err != nil {
+						subtt.Fatal(err)
+					}
+				}
+			}
+
+			err = writer.close()
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if got := buf.String(); got != test.want {
+				subtt.Fatalf("want:\n%s\ngot:\n%s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestGetOutputFields(tt *testing.T) {
+	movie := schema.Movie{ID: "1", Title: "Heat", Director: "Michael Mann", YearMade: 1995}
+	music := schema.Music{ID: "2", Title: "Thunderstruck", Artist: "AC/DC", YearMade: 1990}
+
+	testCases := []struct {
+		name      string
+		media     schema.Media
+		omitEmpty bool
+		want      []outputField
+	}{
+		{"unrated-movie", movie, false, []outputField{{"title", "Heat"}, {"rating", nil}, {"plays", nil}}},
+		{"unrated-movie-omit-empty", movie, true, []outputField{{"title", "Heat"}}},
+		{"music-without-plays", music, false, []outputField{{"title", "Thunderstruck"}, {"rating", nil}, {"plays", nil}}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			got := getOutputFields(test.media, []string{"title", "rating", "plays"}, test.omitEmpty)
+			if !reflect.DeepEqual(test.want, got) {
+				subtt.Fatalf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestOutputWriterEmpty(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		options outputOptions
+		want    string
+	}{
+		{"text", outputOptions{Format: TextOutput()}, ""},
+		{"json", outputOptions{Format: "json"}, "[]\n"},
+		{"json-grouped", outputOptions{Format: "json", IsGrouped: true}, "[]\n"},
+		{"yaml", outputOptions{Format: YAMLOutput()}, "[]\n"},
+		{"csv", outputOptions{Format: "csv", Fields: []string{"title"}}, "title\n"},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			var buf bytes.Buffer
+			writer, err := newOutputWriter(&buf, test.options)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			err = writer.close()
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if got := buf.String(); got != test.want {
+				subtt.Fatalf("want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFormatYAMLString(tt *testing.T) {
+	testCases := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"plain", "Heat", "Heat"},
+		{"punctuation", "Rock 'n' Roll, Vol. 2 (Live)", "Rock 'n' Roll, Vol. 2 (Live)"},
+		{"colon", "Mission: Impossible", `"Mission: Impossible"`},
+		{"hash", "Love #1", `"Love #1"`},
+		{"leading-space", " Heat", `" Heat"`},
+		{"trailing-space", "Heat ", `"Heat "`},
+		{"newline", "Heat\nII", `"Heat\nII"`},
+		{"quote", `Say "Hi"`, `"Say \"Hi\""`},
+		{"indicator", "-ism", `"-ism"`},
+		{"number", "1917", `"1917"`},
+		{"reserved", "No", `"No"`},
+		{"empty", "", `""`},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			if got := formatYAMLString(test.s); got != test.want {
+				subtt.Fatalf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
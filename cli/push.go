@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/service"
+)
+
+// PushCommand provides an interface between the CLI and the MediaDbClient push service.
+type PushCommand struct {
+	FlagSet *flag.FlagSet
+	Options service.PushOptions
+}
+
+// NewPushCommand returns a pointer to a new PushCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewPushCommand(args []string) (*PushCommand, error) {
+	pushCmd := &PushCommand{
+		FlagSet: flag.NewFlagSet("push", flag.ContinueOnError),
+	}
+
+	pushCmd.FlagSet.BoolVar(&pushCmd.Options.Force, "force", false, "Replace entries changed in the database since the change was queued (optional)")
+	pushCmd.FlagSet.BoolVar(&pushCmd.Options.SkipConflicts, "skip-conflicts", false, "Drop queued changes to entries changed in the database since they were queued (optional)")
+
+	err := pushCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if pushCmd.FlagSet.NArg() != 0 || pushCmd.Options.Force && pushCmd.Options.SkipConflicts {
+		return nil, errors.New(GetCommandHelpText(PushCmdName()))
+	}
+
+	return pushCmd, nil
+}
+
+// Run executes the PushCommand. It returns a non-nil error if the
+// underlying push service encounters a problem, which includes a queued
+// change that conflicts with the database unless -force or
+// -skip-conflicts is given. A summary is written to standard output.
+func (p *PushCommand) Run(ctx context.Context) error {
+	result, err := MediaDbClient.Push(ctx, service.NewQueue(config.GetQueueFile()), p.Options)
+
+	for _, conflictErr := range result.Conflicts {
+		StderrLogger.Printf("media-db: skipped %s", conflictErr)
+	}
+
+	if result.Pushed != 0 || len(result.Conflicts) != 0 || err == nil {
+		StdoutLogger.Printf("pushed %d queued changes, skipped %d", result.Pushed, len(result.Conflicts))
+	}
+
+	var conflictErr *service.ConflictError
+	if errors.As(err, &conflictErr) {
+		return withHelp(err, GetPushConflictHelpText(err, conflictErr, result.Remaining))
+	}
+
+	return err
+}
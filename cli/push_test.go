@@ -0,0 +1,33 @@
+package cli
+
+import "testing"
+
+func TestNewPushCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-1", []string{"push"}, false},
+		{"valid-2", []string{"push", "-force"}, false},
+		{"valid-3", []string{"push", "-skip-conflicts"}, false},
+		{"force-and-skip", []string{"push", "-force", "-skip-conflicts"}, true},
+		{"invalid-flags", []string{"push", "-notaflag"}, true},
+		{"extra-args", []string{"push", "movie"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewPushCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
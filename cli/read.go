@@ -1,10 +1,15 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
+	"strings"
 
+	"github.com/alexpcook/media-db/query"
 	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
 )
 
 // ReadCommand provides an interface between the CLI and the MediaDbClient read service.
@@ -12,53 +17,249 @@ type ReadCommand struct {
 	FlagSet   *flag.FlagSet
 	ID        string
 	MediaType schema.Media
+	Filter    service.Filter
+	Order     query.Order
+	Limit     int
+	Offset    int
+	GroupBy   string
+	Output    outputOptions
+}
+
+// parseDateFlag returns the Unix timestamp of the date in value, which is
+// the value of the flag called name, or zero if value is the empty string "".
+func parseDateFlag(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	unixTime, err := schema.StringToUnixTime(value)
+	if err != nil {
+		return 0, fmt.Errorf("media-db: -%s must be a date in the format yyyy-mm-dd, got %q: %w", name, value, err)
+	}
+
+	return unixTime, nil
 }
 
 // NewReadCommand returns a pointer to a new ReadCommand struct. If there is a problem
 // creating the command, the usage help text for the command will be returned as a non-nil error.
 func NewReadCommand(args []string) (*ReadCommand, error) {
 	readCmd := &ReadCommand{}
+	flagArgs := args[1:]
 
-	// Get everything in the database, so no args or flags are required.
-	if len(args) < 2 {
-		return readCmd, nil
+	// Without a media type, everything in the database is read.
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		readCmd.FlagSet = flag.NewFlagSet("read", flag.ContinueOnError)
+	} else {
+		mediaType := args[1]
+		flagArgs = args[2:]
+
+		switch mediaType {
+		case MovieMediaType():
+			readCmd.FlagSet = flag.NewFlagSet("read movie", flag.ContinueOnError)
+			readCmd.MediaType = schema.Movie{}
+		case MusicMediaType():
+			readCmd.FlagSet = flag.NewFlagSet("read music", flag.ContinueOnError)
+			readCmd.MediaType = schema.Music{}
+		default:
+			return nil, errors.New(GetInvalidMediaTypeHelpText(ReadCmdName(), mediaType))
+		}
 	}
 
-	mediaType := args[1]
+	var watchedAfter, watchedBefore, where, order, fields, tmpl string
+
+	readCmd.FlagSet.StringVar(&readCmd.ID, "id", "", "The id in the database to return")
+	readCmd.FlagSet.StringVar(&readCmd.Filter.Title, "title", "", "Only return entries whose title contains this text, or matches this glob pattern, ignoring case (optional)")
+	readCmd.FlagSet.StringVar(&readCmd.Filter.Director, "director", "", "Only return movies whose director contains this text, or matches this glob pattern, ignoring case (optional)")
+	readCmd.FlagSet.StringVar(&readCmd.Filter.Artist, "artist", "", "Only return music whose artist contains this text, or matches this glob pattern, ignoring case (optional)")
+	readCmd.FlagSet.IntVar(&readCmd.Filter.Year, "year", 0, "Only return entries made in this year (optional)")
+	readCmd.FlagSet.IntVar(&readCmd.Filter.YearMin, "year-min", 0, "Only return entries made in or after this year (optional)")
+	readCmd.FlagSet.IntVar(&readCmd.Filter.YearMax, "year-max", 0, "Only return entries made in or before this year (optional)")
+	readCmd.FlagSet.StringVar(&watchedAfter, "watched-after", "", "Only return entries watched or listened to on or after this date, in the format yyyy-mm-dd (optional)")
+	readCmd.FlagSet.StringVar(&watchedBefore, "watched-before", "", "Only return entries watched or listened to on or before this date, in the format yyyy-mm-dd (optional)")
+	readCmd.FlagSet.StringVar(&where, "where", "", "Only return entries that match this query, e.g. 'year >= 2000 and director ~ \"nolan\"' (optional)")
+	readCmd.FlagSet.StringVar(&order, "sort", "", "The field to sort entries by, e.g. date, with :desc to reverse the order, e.g. date:desc (optional)")
+	readCmd.FlagSet.IntVar(&readCmd.Limit, "limit", 0, "The most entries to return (optional)")
+	readCmd.FlagSet.IntVar(&readCmd.Offset, "offset", 0, "The number of entries to skip before returning any (optional)")
+	readCmd.FlagSet.StringVar(&readCmd.GroupBy, "group-by", "", fmt.Sprintf("Show the entries in groups, one of %s (optional)", strings.Join(query.GetGroupings(), ", ")))
+	readCmd.FlagSet.StringVar(&readCmd.Output.Format, "output", TextOutput(), fmt.Sprintf("The format to show the entries in, one of %s (optional)", strings.Join(GetOutputFormats(), ", ")))
+	readCmd.FlagSet.StringVar(&fields, "fields", "", "A comma-separated list of the fields to show, e.g. title,year,date (optional)")
+	readCmd.FlagSet.StringVar(&tmpl, "template", "", "A Go template to show each entry with, e.g. '{{.title}} ({{.year}})' (optional)")
 
-	switch mediaType {
-	case MovieMediaType():
-		readCmd.FlagSet = flag.NewFlagSet("read movie", flag.ContinueOnError)
-		readCmd.MediaType = schema.Movie{}
-	case MusicMediaType():
-		readCmd.FlagSet = flag.NewFlagSet("read music", flag.ContinueOnError)
-		readCmd.MediaType = schema.Music{}
-	default:
-		return nil, errors.New(GetInvalidMediaTypeHelpText(ReadCmdName(), mediaType))
+	err := readCmd.FlagSet.Parse(flagArgs)
+	if err != nil {
+		return nil, err
 	}
 
-	readCmd.FlagSet.StringVar(&readCmd.ID, "id", "", "The id in the database to return")
+	if readCmd.FlagSet.NArg() != 0 {
+		return nil, errors.New(GetCommandHelpText(ReadCmdName()))
+	}
 
-	err := readCmd.FlagSet.Parse(args[2:])
+	switch readCmd.MediaType.(type) {
+	case schema.Movie:
+		if readCmd.Filter.Artist != "" {
+			return nil, fmt.Errorf("media-db: -artist does not apply to movies\n\n%s", GetCommandHelpText(ReadCmdName()))
+		}
+	case schema.Music:
+		if readCmd.Filter.Director != "" {
+			return nil, fmt.Errorf("media-db: -director does not apply to music\n\n%s", GetCommandHelpText(ReadCmdName()))
+		}
+	}
+
+	readCmd.Filter.WatchedAfter, err = parseDateFlag("watched-after", watchedAfter)
 	if err != nil {
 		return nil, err
 	}
 
+	readCmd.Filter.WatchedBefore, err = parseDateFlag("watched-before", watchedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	if where != "" {
+		readCmd.Filter.Where, err = query.Parse(where)
+		if err != nil {
+			return nil, errors.New(GetQueryErrorHelpText(err))
+		}
+	}
+
+	err = readCmd.Filter.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("media-db: %w\n\n%s", err, GetCommandHelpText(ReadCmdName()))
+	}
+
+	if order != "" {
+		readCmd.Order, err = query.ParseOrder(order)
+		if err != nil {
+			return nil, fmt.Errorf("media-db: -sort: %w\n\n%s", err, GetCommandHelpText(ReadCmdName()))
+		}
+	}
+
+	if readCmd.GroupBy != "" {
+		err = query.ValidateGrouping(readCmd.GroupBy)
+		if err != nil {
+			return nil, fmt.Errorf("media-db: -group-by: %w\n\n%s", err, GetCommandHelpText(ReadCmdName()))
+		}
+	}
+
+	if readCmd.Limit < 0 || readCmd.Offset < 0 {
+		return nil, fmt.Errorf("media-db: -limit and -offset cannot be negative\n\n%s", GetCommandHelpText(ReadCmdName()))
+	}
+
+	isFormat := false
+	for _, format := range GetOutputFormats() {
+		isFormat = isFormat || readCmd.Output.Format == format
+	}
+	if !isFormat {
+		return nil, fmt.Errorf("media-db: '%s' is an invalid output format, want one of '%s'\n\n%s", readCmd.Output.Format, strings.Join(GetOutputFormats(), ", "), GetCommandHelpText(ReadCmdName()))
+	}
+
+	if fields != "" {
+		readCmd.Output.Fields, err = parseOutputFields(fields)
+		if err != nil {
+			return nil, fmt.Errorf("media-db: -fields: %w\n\n%s", err, GetCommandHelpText(ReadCmdName()))
+		}
+	}
+
+	if tmpl != "" {
+		if readCmd.Output.Format != TextOutput() || readCmd.Output.Fields != nil {
+			return nil, fmt.Errorf("media-db: -template cannot be used with -output or -fields\n\n%s", GetCommandHelpText(ReadCmdName()))
+		}
+
+		readCmd.Output.Template, err = parseTemplate(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("media-db: -template: %w\n\n%s", err, GetCommandHelpText(ReadCmdName()))
+		}
+	}
+
+	readCmd.Output.IsGrouped = readCmd.GroupBy != ""
+
 	return readCmd, nil
 }
 
 // Run executes the ReadCommand. It returns a non-nil error
 // if the underlying read service encounters a problem. The
 // results of the query are written to standard output.
-func (r *ReadCommand) Run() error {
-	res, err := MediaDbClient.Read(r.ID, r.MediaType)
+func (r *ReadCommand) Run(ctx context.Context) (err error) {
+	// An exact id is shown with its etag, which can be
+	// given to update and delete to detect conflicting changes.
+	var res []schema.Media
+	var notFoundErr error
+	if r.ID != "" && r.MediaType != nil {
+		media, etag, err := MediaDbClient.ReadEntry(ctx, r.ID, r.MediaType)
+		if err == nil && r.Filter.Matches(media) {
+			if r.Output.Format == TextOutput() && r.Output.Fields == nil && r.Output.Template == nil {
+				StdoutLogger.Printf("%s\n  etag: %s", media, etag)
+				return nil
+			}
+			res = []schema.Media{media}
+		} else if err != nil && !errors.Is(err, service.ErrNotFound) {
+			return err
+		} else if err != nil {
+			notFoundErr = err
+		}
+	}
+
+	if res == nil {
+		res, err = MediaDbClient.ReadMatching(ctx, r.ID, r.MediaType, r.Filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	// An id that is not even the start of
+	// another id does not match any entry.
+	if notFoundErr != nil && len(res) == 0 {
+		return notFoundErr
+	}
+
+	r.Order.Sort(res)
+	res = paginate(res, r.Offset, r.Limit)
+
+	writer, err := newOutputWriter(StdoutLogger.Writer(), r.Output)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if closeErr := writer.close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	groups := []query.Group{{Media: res}}
+	if r.GroupBy != "" {
+		groups = query.GroupBy(res, r.GroupBy, r.Order)
+	}
 
-	for _, media := range res {
-		StdoutLogger.Println(media)
+	for _, group := range groups {
+		if r.GroupBy != "" {
+			err = writer.startGroup(group.Name, len(group.Media))
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, media := range group.Media {
+			err = writer.write(media)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
+
+// paginate returns the entries in media after skipping offset of them,
+// and at most limit of them if limit is positive.
+func paginate(media []schema.Media, offset, limit int) []schema.Media {
+	if offset >= len(media) {
+		return media[:0]
+	}
+	media = media[offset:]
+
+	if limit > 0 && limit < len(media) {
+		media = media[:limit]
+	}
+
+	return media
+}
@@ -1,6 +1,10 @@
 package cli
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
 
 func TestNewReadCommand(tt *testing.T) {
 	testCases := []struct {
@@ -13,7 +17,33 @@ func TestNewReadCommand(tt *testing.T) {
 		{"valid-3", []string{"read", "music"}, false},
 		{"valid-4", []string{"read", "movie", "-id", "123"}, false},
 		{"valid-5", []string{"read", "music", "-id", "123"}, false},
+		{"valid-filters", []string{"read", "-title", "the *", "-year-min", "2000", "-watched-after", "2021-01-01"}, false},
+		{"valid-movie-filters", []string{"read", "movie", "-director", "nolan", "-year", "2008"}, false},
+		{"valid-music-filters", []string{"read", "music", "-artist", "bach", "-watched-before", "2021-12-31"}, false},
 		{"invalid-media-type", []string{"read", "invalid"}, true},
+		{"invalid-movie-artist", []string{"read", "movie", "-artist", "bach"}, true},
+		{"invalid-music-director", []string{"read", "music", "-director", "nolan"}, true},
+		{"invalid-date", []string{"read", "-watched-after", "2021-13-01"}, true},
+		{"invalid-year-range", []string{"read", "-year-min", "2001", "-year-max", "2000"}, true},
+		{"invalid-pattern", []string{"read", "-title", "[the"}, true},
+		{"valid-where", []string{"read", "-where", `year >= 2000 and director ~ "nolan" and date in 2021`}, false},
+		{"valid-where-filters", []string{"read", "movie", "-title", "the", "--where", "rating >= 4"}, false},
+		{"invalid-where", []string{"read", "-where", "year >"}, true},
+		{"valid-sort", []string{"read", "-sort", "date:desc", "-limit", "10", "-offset", "20"}, false},
+		{"valid-group-by", []string{"read", "movie", "-sort=title", "-group-by=year"}, false},
+		{"invalid-sort-field", []string{"read", "-sort", "genre"}, true},
+		{"invalid-sort-direction", []string{"read", "-sort", "date:up"}, true},
+		{"invalid-group-by", []string{"read", "-group-by", "rating"}, true},
+		{"negative-limit", []string{"read", "-limit", "-1"}, true},
+		{"negative-offset", []string{"read", "-offset", "-1"}, true},
+		{"valid-output", []string{"read", "-output", "json", "-fields", "title, year,date"}, false},
+		{"valid-template", []string{"read", "movie", "-template", "{{.title}} ({{.year}}) {{.rating}}"}, false},
+		{"invalid-output", []string{"read", "-output", "xml"}, true},
+		{"invalid-fields", []string{"read", "-output", "csv", "-fields", "title,genre"}, true},
+		{"invalid-template", []string{"read", "-template", "{{.title"}, true},
+		{"invalid-template-field", []string{"read", "-template", "{{.genre}}"}, true},
+		{"template-with-output", []string{"read", "-output", "json", "-template", "{{.title}}"}, true},
+		{"extra-args", []string{"read", "movie", "-title", "the", "music"}, true},
 		{"invalid-flags-1", []string{"read", "movie", "-notaflag", "movie"}, true},
 		{"invalid-flags-2", []string{"read", "music", "-notaflag", "music"}, true},
 	}
@@ -33,3 +63,33 @@ func TestNewReadCommand(tt *testing.T) {
 		})
 	}
 }
+
+func TestPaginate(tt *testing.T) {
+	media := []schema.Media{schema.Movie{ID: "1"}, schema.Movie{ID: "2"}, schema.Movie{ID: "3"}}
+
+	testCases := []struct {
+		name   string
+		offset int
+		limit  int
+		want   int
+	}{
+		{"all", 0, 0, 3},
+		{"limit", 0, 2, 2},
+		{"limit-past-end", 0, 5, 3},
+		{"offset", 1, 0, 2},
+		{"offset-and-limit", 1, 1, 1},
+		{"offset-past-end", 3, 1, 0},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			page := paginate(media, test.offset, test.limit)
+			if len(page) != test.want {
+				subtt.Fatalf("want %d entries, got %d", test.want, len(page))
+			}
+			if len(page) != 0 && page[0].(schema.Movie).ID != media[test.offset].(schema.Movie).ID {
+				subtt.Fatalf("want page to start at entry %d, got %v", test.offset, page[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+)
+
+// ReindexCommand provides an interface between the CLI and the MediaDbClient reindex service.
+type ReindexCommand struct {
+	FlagSet *flag.FlagSet
+}
+
+// NewReindexCommand returns a pointer to a new ReindexCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewReindexCommand(args []string) (*ReindexCommand, error) {
+	reindexCmd := &ReindexCommand{
+		FlagSet: flag.NewFlagSet("reindex", flag.ContinueOnError),
+	}
+
+	err := reindexCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if reindexCmd.FlagSet.NArg() != 0 {
+		return nil, errors.New(GetCommandHelpText(ReindexCmdName()))
+	}
+
+	return reindexCmd, nil
+}
+
+// Run executes the ReindexCommand. It returns a non-nil error
+// if the underlying reindex service encounters a problem.
+func (r *ReindexCommand) Run(ctx context.Context) error {
+	numEntries, err := MediaDbClient.Reindex(ctx)
+	if err != nil {
+		return err
+	}
+
+	StdoutLogger.Printf("indexed %d entries", numEntries)
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package cli
+
+import "testing"
+
+func TestNewReindexCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid", []string{"reindex"}, false},
+		{"invalid-flag", []string{"reindex", "-notaflag", "test"}, true},
+		{"extra-args", []string{"reindex", "movie"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewReindexCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+)
+
+// RekeyCommand provides an interface between the CLI and the MediaDbClient rekey service.
+type RekeyCommand struct {
+	FlagSet       *flag.FlagSet
+	KeyFile       string
+	PassphraseEnv string
+}
+
+// NewRekeyCommand returns a pointer to a new RekeyCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+// Exactly one of a new key file, a new passphrase environment variable, or the decrypt flag,
+// which turns encryption off, must be given.
+func NewRekeyCommand(args []string) (*RekeyCommand, error) {
+	rekeyCmd := &RekeyCommand{
+		FlagSet: flag.NewFlagSet("rekey", flag.ContinueOnError),
+	}
+
+	var decrypt bool
+	rekeyCmd.FlagSet.StringVar(&rekeyCmd.KeyFile, "key-file", "", "A file with the new secret to encrypt entries with")
+	rekeyCmd.FlagSet.StringVar(&rekeyCmd.PassphraseEnv, "passphrase-env", "", "An environment variable with the new passphrase to encrypt entries with")
+	rekeyCmd.FlagSet.BoolVar(&decrypt, "decrypt", false, "Decrypt entries and stop encrypting them")
+
+	err := rekeyCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if rekeyCmd.FlagSet.NFlag() != 1 || rekeyCmd.FlagSet.NArg() != 0 || !decrypt && rekeyCmd.KeyFile == "" && rekeyCmd.PassphraseEnv == "" {
+		return nil, errors.New(GetCommandHelpText(RekeyCmdName()))
+	}
+
+	return rekeyCmd, nil
+}
+
+// Run executes the RekeyCommand. It returns a non-nil error if the new key
+// cannot be read, the underlying rekey service encounters a problem, or the
+// configuration cannot be saved. The configuration is only changed to the
+// new key once every entry uses it.
+func (r *RekeyCommand) Run(ctx context.Context) error {
+	newConfig := *MediaDbConfig
+	err := newConfig.SetEncryption(r.KeyFile, r.PassphraseEnv)
+	if err != nil {
+		return err
+	}
+
+	numObjects, err := MediaDbClient.Rekey(ctx, &newConfig)
+	if err != nil {
+		return withHelp(err, GetRekeyHelpText(err, numObjects))
+	}
+
+	err = newConfig.Save()
+	if err != nil {
+		return err
+	}
+
+	if newConfig.IsEncrypted() {
+		StdoutLogger.Printf("encrypted %d objects with the new key", numObjects)
+	} else {
+		StdoutLogger.Printf("decrypted %d objects", numObjects)
+	}
+
+	return nil
+}
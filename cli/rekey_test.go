@@ -0,0 +1,36 @@
+package cli
+
+import "testing"
+
+func TestNewRekeyCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-key-file", []string{"rekey", "-key-file", "new.key"}, false},
+		{"valid-passphrase", []string{"rekey", "-passphrase-env=MEDIA_DB_NEW_PASSPHRASE"}, false},
+		{"valid-decrypt", []string{"rekey", "-decrypt"}, false},
+		{"no-key", []string{"rekey"}, true},
+		{"empty-key-file", []string{"rekey", "-key-file="}, true},
+		{"decrypt-false", []string{"rekey", "-decrypt=false"}, true},
+		{"two-keys", []string{"rekey", "-key-file", "new.key", "-passphrase-env", "MEDIA_DB_NEW_PASSPHRASE"}, true},
+		{"invalid-flags", []string{"rekey", "-notaflag"}, true},
+		{"extra-args", []string{"rekey", "-decrypt", "movie"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewRekeyCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
+)
+
+// RestoreCommand provides an interface between the CLI and the MediaDbClient restore
+// services. It either restores a single entry from the trash, given its ID, or the
+// whole database from a backup archive, given the archive file.
+type RestoreCommand struct {
+	FlagSet   *flag.FlagSet
+	ID        string
+	MediaType schema.Media
+	Archive   string
+	Mode      service.RestoreMode
+}
+
+// NewRestoreCommand returns a pointer to a new RestoreCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewRestoreCommand(args []string) (*RestoreCommand, error) {
+	restoreCmd := &RestoreCommand{
+		FlagSet: flag.NewFlagSet("restore", flag.ContinueOnError),
+	}
+
+	var intoEmpty, merge, overwrite bool
+	restoreCmd.FlagSet.StringVar(&restoreCmd.ID, "id", "", "The id in the trash to restore")
+	restoreCmd.FlagSet.StringVar(&restoreCmd.Archive, "archive", "", "The backup archive to restore the database from")
+	restoreCmd.FlagSet.BoolVar(&intoEmpty, "into-empty", false, "Restore the archive only if the database is empty (default)")
+	restoreCmd.FlagSet.BoolVar(&merge, "merge", false, "Restore the archive, keeping any entries already in the database")
+	restoreCmd.FlagSet.BoolVar(&overwrite, "overwrite", false, "Restore the archive, replacing any entries already in the database")
+
+	// The media type may come before or after the flags.
+	positionalArgs := make([]string, 0, 1)
+	flagArgs := args[1:]
+	for {
+		err := restoreCmd.FlagSet.Parse(flagArgs)
+		if err != nil {
+			return nil, err
+		}
+		if restoreCmd.FlagSet.NArg() == 0 {
+			break
+		}
+		positionalArgs = append(positionalArgs, restoreCmd.FlagSet.Arg(0))
+		flagArgs = restoreCmd.FlagSet.Args()[1:]
+	}
+
+	numModeFlags := countSetFlags(restoreCmd.FlagSet, "into-empty", "merge", "overwrite")
+
+	if restoreCmd.Archive != "" {
+		if restoreCmd.ID != "" || len(positionalArgs) != 0 {
+			return nil, errors.New(GetCommandHelpText(RestoreCmdName()))
+		}
+		if numModeFlags > 1 {
+			return nil, fmt.Errorf("media-db: only one of -into-empty, -merge and -overwrite can be given\n\n%s", GetCommandHelpText(RestoreCmdName()))
+		}
+
+		switch {
+		case merge:
+			restoreCmd.Mode = service.RestoreMerge
+		case overwrite:
+			restoreCmd.Mode = service.RestoreOverwrite
+		default:
+			restoreCmd.Mode = service.RestoreIntoEmpty
+		}
+
+		return restoreCmd, nil
+	}
+
+	switch len(positionalArgs) {
+	case 0:
+	case 1:
+		// The media type is optional, since the id is enough to find the entry in the trash.
+		mediaType, err := schema.GetMediaTypeFromName(positionalArgs[0])
+		if err != nil {
+			return nil, errors.New(GetInvalidMediaTypeHelpText(RestoreCmdName(), positionalArgs[0]))
+		}
+		restoreCmd.MediaType = mediaType
+	default:
+		return nil, errors.New(GetCommandHelpText(RestoreCmdName()))
+	}
+
+	if restoreCmd.ID == "" || numModeFlags != 0 {
+		return nil, errors.New(GetCommandHelpText(RestoreCmdName()))
+	}
+
+	return restoreCmd, nil
+}
+
+// Run executes the RestoreCommand. It returns a non-nil error
+// if the underlying restore service encounters a problem. The
+// restored entry, or a summary of the restored archive, is
+// written to standard output.
+func (r *RestoreCommand) Run(ctx context.Context) error {
+	if r.Archive != "" {
+		return r.runArchive(ctx)
+	}
+
+	media, err := MediaDbClient.Restore(ctx, r.ID, r.MediaType)
+	if err != nil {
+		return err
+	}
+
+	StdoutLogger.Println(media)
+
+	return nil
+}
+
+// runArchive restores the database from the backup archive.
+func (r *RestoreCommand) runArchive(ctx context.Context) error {
+	file, err := os.Open(r.Archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result, err := MediaDbClient.RestoreBackup(ctx, file, r.Mode)
+	if result.Restored != 0 || err == nil {
+		StdoutLogger.Printf("restored %d objects, skipped %d", result.Restored, result.Skipped)
+	}
+
+	return err
+}
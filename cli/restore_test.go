@@ -0,0 +1,45 @@
+package cli
+
+import "testing"
+
+func TestNewRestoreCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-1", []string{"restore", "-id", "123"}, false},
+		{"valid-2", []string{"restore", "movie", "-id", "123"}, false},
+		{"valid-3", []string{"restore", "music", "-id=123"}, false},
+		{"no-id-1", []string{"restore"}, true},
+		{"no-id-2", []string{"restore", "movie"}, true},
+		{"invalid-media-type", []string{"restore", "invalid", "-id", "123"}, true},
+		{"invalid-flags", []string{"restore", "movie", "-notaflag", "123"}, true},
+		{"extra-args", []string{"restore", "movie", "-id", "123", "music"}, true},
+		{"archive-1", []string{"restore", "-archive", "library.tar.gz"}, false},
+		{"archive-2", []string{"restore", "-archive=library.tar.gz", "-merge"}, false},
+		{"archive-3", []string{"restore", "-overwrite", "-archive", "library.tar.gz"}, false},
+		{"archive-4", []string{"restore", "-into-empty", "-archive", "library.tar.gz"}, false},
+		{"archive-named-like-type", []string{"restore", "-archive", "movie"}, false},
+		{"archive-without-flag", []string{"restore", "library.tar.gz"}, true},
+		{"archive-with-id", []string{"restore", "-archive", "library.tar.gz", "-id", "123"}, true},
+		{"archive-with-type", []string{"restore", "movie", "-archive", "library.tar.gz"}, true},
+		{"archive-two-modes", []string{"restore", "-archive", "library.tar.gz", "-merge", "-overwrite"}, true},
+		{"mode-without-archive", []string{"restore", "movie", "-id", "123", "-merge"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewRestoreCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// RevertCommand provides an interface between the CLI and the MediaDbClient revert service.
+type RevertCommand struct {
+	FlagSet   *flag.FlagSet
+	ID        string
+	Version   string
+	MediaType schema.Media
+}
+
+// NewRevertCommand returns a pointer to a new RevertCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewRevertCommand(args []string) (*RevertCommand, error) {
+	if len(args) < 2 {
+		return nil, errors.New(GetCommandHelpText(RevertCmdName()))
+	}
+
+	mediaType := args[1]
+	revertCmd := &RevertCommand{}
+
+	switch mediaType {
+	case MovieMediaType():
+		revertCmd.FlagSet = flag.NewFlagSet("revert movie", flag.ContinueOnError)
+		revertCmd.MediaType = schema.Movie{}
+	case MusicMediaType():
+		revertCmd.FlagSet = flag.NewFlagSet("revert music", flag.ContinueOnError)
+		revertCmd.MediaType = schema.Music{}
+	default:
+		return nil, errors.New(GetInvalidMediaTypeHelpText(RevertCmdName(), mediaType))
+	}
+
+	revertCmd.FlagSet.StringVar(&revertCmd.ID, "id", "", "The id in the database to revert")
+	revertCmd.FlagSet.StringVar(&revertCmd.Version, "version", "", "The version from the history to revert to")
+
+	err := revertCmd.FlagSet.Parse(args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	expectFlags := 2
+	if gotFlags := revertCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+		revertCmd.FlagSet.Usage()
+		return nil, errors.New("")
+	}
+
+	return revertCmd, nil
+}
+
+// Run executes the RevertCommand. It returns a non-nil error
+// if the underlying revert service encounters a problem. The
+// reverted entry is written to standard output.
+func (r *RevertCommand) Run(ctx context.Context) error {
+	media, err := MediaDbClient.Revert(ctx, r.ID, r.MediaType, r.Version)
+	if err != nil {
+		return err
+	}
+
+	StdoutLogger.Println(media)
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package cli
+
+import "testing"
+
+func TestNewRevertCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-1", []string{"revert", "movie", "-id", "123", "-version", "1"}, false},
+		{"valid-2", []string{"revert", "music", "-id=123", "-version=1"}, false},
+		{"no-media-type", []string{"revert"}, true},
+		{"no-version", []string{"revert", "movie", "-id", "123"}, true},
+		{"no-id", []string{"revert", "movie", "-version", "1"}, true},
+		{"invalid-media-type", []string{"revert", "invalid", "-id", "123", "-version", "1"}, true},
+		{"invalid-flags", []string{"revert", "movie", "-notaflag", "123"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewRevertCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
+	"time"
 
 	"github.com/alexpcook/media-db/config"
 )
@@ -11,32 +14,78 @@ import (
 type SetupCommand struct {
 	FlagSet *flag.FlagSet
 	Config  *config.MediaDbConfig
+	Name    string
 }
 
 // NewSetupCommand returns a pointer to a new SetupCommand struct. If there is a problem
 // creating the command, the usage help text for the command will be returned as a non-nil error.
+// The S3 backend is configured with the profile, region, and bucket flags, and the local
+// filesystem backend is configured with the dir flag alone. With the name flag, the
+// configuration is saved as a named profile rather than as the current database.
 func NewSetupCommand(args []string) (*SetupCommand, error) {
 	setupCmd := &SetupCommand{
 		FlagSet: flag.NewFlagSet("setup", flag.ContinueOnError),
 	}
 
-	awsConfig := &config.MediaDbConfig{}
-	setupCmd.FlagSet.StringVar(&awsConfig.AWSProfile, "profile", "", "The AWS profile to use")
-	setupCmd.FlagSet.StringVar(&awsConfig.AWSRegion, "region", "", "The AWS region to use")
-	setupCmd.FlagSet.StringVar(&awsConfig.S3Bucket, "bucket", "", "The S3 bucket to use")
+	dbConfig := &config.MediaDbConfig{}
+	setupCmd.FlagSet.StringVar(&dbConfig.AWSProfile, "profile", "", "The AWS profile to use")
+	setupCmd.FlagSet.StringVar(&dbConfig.AWSRegion, "region", "", "The AWS region to use")
+	setupCmd.FlagSet.StringVar(&dbConfig.S3Bucket, "bucket", "", "The S3 bucket to use")
+	setupCmd.FlagSet.StringVar(&dbConfig.LocalDir, "dir", "", "The local directory to use instead of an S3 bucket")
+	setupCmd.FlagSet.IntVar(&dbConfig.Concurrency, "concurrency", 0, "The maximum number of entries to fetch at once (optional)")
+	var timeout time.Duration
+	setupCmd.FlagSet.DurationVar(&timeout, "timeout", 0, "The longest a single request to the database may take, e.g. 30s (optional)")
+	setupCmd.FlagSet.BoolVar(&dbConfig.QueueOffline, "queue", false, "Queue changes locally while the database cannot be reached, until 'media-db push' (optional)")
+	var keyFile, passphraseEnv string
+	setupCmd.FlagSet.StringVar(&keyFile, "key-file", "", "A file with the secret to encrypt entries with (optional)")
+	setupCmd.FlagSet.StringVar(&passphraseEnv, "passphrase-env", "", "An environment variable with the passphrase to encrypt entries with (optional)")
+	setupCmd.FlagSet.StringVar(&setupCmd.Name, "name", config.DefaultProfileName(), "The name of the profile to save the configuration as (optional)")
 
 	err := setupCmd.FlagSet.Parse(args[1:])
 	if err != nil {
 		return nil, err
 	}
 
+	isLocal := countSetFlags(setupCmd.FlagSet, "dir") == 1
+
 	expectFlags := 3
-	if gotFlags := setupCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+	if isLocal {
+		expectFlags = 1
+	}
+
+	if gotFlags := setupCmd.FlagSet.NFlag() - countSetFlags(setupCmd.FlagSet, "concurrency", "timeout", "queue", "key-file", "passphrase-env", "name"); gotFlags != expectFlags {
 		setupCmd.FlagSet.Usage()
 		return nil, errors.New("")
 	}
 
-	setupCmd.Config, err = config.NewMediaDbConfig(awsConfig.AWSProfile, awsConfig.AWSRegion, awsConfig.S3Bucket)
+	if dbConfig.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency cannot be negative, got %d", dbConfig.Concurrency)
+	}
+
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative, got %s", timeout)
+	}
+
+	_, err = config.GetProfileConfigFile(setupCmd.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if isLocal {
+		setupCmd.Config, err = config.NewLocalMediaDbConfig(dbConfig.LocalDir)
+	} else {
+		setupCmd.Config, err = config.NewMediaDbConfig(dbConfig.AWSProfile, dbConfig.AWSRegion, dbConfig.S3Bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+	setupCmd.Config.Concurrency = dbConfig.Concurrency
+	setupCmd.Config.QueueOffline = dbConfig.QueueOffline
+	if timeout != 0 {
+		setupCmd.Config.Timeout = timeout.String()
+	}
+
+	err = setupCmd.Config.SetEncryption(keyFile, passphraseEnv)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +95,6 @@ func NewSetupCommand(args []string) (*SetupCommand, error) {
 
 // Run executes the SetupCommand. It returns a non-nil error
 // if the underlying save action encounters a problem.
-func (s *SetupCommand) Run() error {
-	return s.Config.Save()
+func (s *SetupCommand) Run(ctx context.Context) error {
+	return s.Config.SaveProfile(s.Name)
 }
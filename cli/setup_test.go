@@ -12,6 +12,24 @@ func TestNewSetupCommand(tt *testing.T) {
 		{"invalid-flag", []string{"setup", "-notaflag", "test", "-profile", "aws"}, true},
 		{"missing-required-flags", []string{"setup", "-profile", "prof"}, true},
 		{"invalid-value", []string{"setup", "-profile", "\t", "-region", "us-west-1", "-bucket", "my_bucket"}, true},
+		{"valid-local", []string{"setup", "-dir", "/tmp/media-db"}, false},
+		{"local-with-s3-flags", []string{"setup", "-dir", "/tmp/media-db", "-profile", "prof"}, true},
+		{"invalid-local-value", []string{"setup", "-dir", " "}, true},
+		{"valid-concurrency", []string{"setup", "-dir", "/tmp/media-db", "-concurrency", "4"}, false},
+		{"concurrency-only", []string{"setup", "-concurrency", "4"}, true},
+		{"valid-queue", []string{"setup", "-profile", "prof", "-region", "us-west-1", "-bucket", "my_bucket", "-queue"}, false},
+		{"queue-only", []string{"setup", "-queue"}, true},
+		{"valid-key-file", []string{"setup", "-dir", "/tmp/media-db", "-key-file", "/tmp/media-db.key"}, false},
+		{"valid-passphrase", []string{"setup", "-dir", "/tmp/media-db", "-passphrase-env", "MEDIA_DB_PASSPHRASE"}, false},
+		{"key-file-and-passphrase", []string{"setup", "-dir", "/tmp/media-db", "-key-file", "/tmp/media-db.key", "-passphrase-env", "MEDIA_DB_PASSPHRASE"}, true},
+		{"valid-name", []string{"setup", "-dir", "/tmp/media-db", "-name", "backup"}, false},
+		{"name-only", []string{"setup", "-name", "backup"}, true},
+		{"invalid-name", []string{"setup", "-dir", "/tmp/media-db", "-name", "../backup"}, true},
+		{"negative-concurrency", []string{"setup", "-dir", "/tmp/media-db", "-concurrency", "-1"}, true},
+		{"valid-timeout", []string{"setup", "-dir", "/tmp/media-db", "-timeout", "45s"}, false},
+		{"timeout-only", []string{"setup", "-timeout", "45s"}, true},
+		{"negative-timeout", []string{"setup", "-dir", "/tmp/media-db", "-timeout", "-1s"}, true},
+		{"invalid-timeout", []string{"setup", "-dir", "/tmp/media-db", "-timeout", "soon"}, true},
 	}
 
 	for _, test := range testCases {
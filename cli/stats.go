@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexpcook/media-db/mediafile"
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
+)
+
+// StatsCommand provides an interface between the CLI and the MediaDbClient stats service.
+type StatsCommand struct {
+	FlagSet   *flag.FlagSet
+	MediaType schema.Media
+	Year      int
+	Top       int
+	Output    string
+}
+
+// NewStatsCommand returns a pointer to a new StatsCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewStatsCommand(args []string) (*StatsCommand, error) {
+	statsCmd := &StatsCommand{
+		FlagSet: flag.NewFlagSet("stats", flag.ContinueOnError),
+	}
+
+	statsCmd.FlagSet.IntVar(&statsCmd.Year, "year", 0, "Only count the entries watched or listened to in this year (optional)")
+	statsCmd.FlagSet.IntVar(&statsCmd.Top, "top", service.GetDefaultTopCount(), "The number of directors and artists to rank (optional)")
+	statsCmd.FlagSet.StringVar(&statsCmd.Output, "output", TextOutput(), fmt.Sprintf("The format to show the statistics in, one of %s, %s (optional)", TextOutput(), mediafile.JSONFormat()))
+
+	// The media type may come before or after the flags.
+	positionalArgs := make([]string, 0, 1)
+	flagArgs := args[1:]
+	for {
+		err := statsCmd.FlagSet.Parse(flagArgs)
+		if err != nil {
+			return nil, err
+		}
+		if statsCmd.FlagSet.NArg() == 0 {
+			break
+		}
+		positionalArgs = append(positionalArgs, statsCmd.FlagSet.Arg(0))
+		flagArgs = statsCmd.FlagSet.Args()[1:]
+	}
+
+	switch len(positionalArgs) {
+	case 0:
+	case 1:
+		mediaType, err := schema.GetMediaTypeFromName(positionalArgs[0])
+		if err != nil {
+			return nil, errors.New(GetInvalidMediaTypeHelpText(StatsCmdName(), positionalArgs[0]))
+		}
+		statsCmd.MediaType = mediaType
+	default:
+		return nil, errors.New(GetCommandHelpText(StatsCmdName()))
+	}
+
+	if statsCmd.Year < 0 {
+		return nil, fmt.Errorf("media-db: -year cannot be negative, got %d\n\n%s", statsCmd.Year, GetCommandHelpText(StatsCmdName()))
+	}
+
+	if statsCmd.Top < 1 {
+		return nil, fmt.Errorf("media-db: -top must be positive, got %d\n\n%s", statsCmd.Top, GetCommandHelpText(StatsCmdName()))
+	}
+
+	if statsCmd.Output != TextOutput() && statsCmd.Output != mediafile.JSONFormat() {
+		return nil, fmt.Errorf("media-db: '%s' is an invalid output format, want one of '%s, %s'\n\n%s", statsCmd.Output, TextOutput(), mediafile.JSONFormat(), GetCommandHelpText(StatsCmdName()))
+	}
+
+	return statsCmd, nil
+}
+
+// getYearFilter returns a filter for the entries watched or
+// listened to in year, or an empty filter if year is zero.
+func getYearFilter(year int) service.Filter {
+	if year == 0 {
+		return service.Filter{}
+	}
+
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+	return service.Filter{WatchedAfter: start.Unix(), WatchedBefore: end.Unix()}
+}
+
+// writeStatsText writes stats to w as text, with a table for each count.
+func writeStatsText(w io.Writer, stats service.Stats) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	types := make([]string, 0, len(stats.Types))
+	for _, count := range stats.Types {
+		types = append(types, fmt.Sprintf("%d %s", count.Count, count.Name))
+	}
+
+	fmt.Fprintf(tw, "total:\t%d", stats.Total)
+	if len(types) != 0 {
+		fmt.Fprintf(tw, " (%s)", strings.Join(types, ", "))
+	}
+	fmt.Fprintf(tw, "\naverage years from release to watch:\t%s\n", strconv.FormatFloat(stats.AverageYearsToWatch, 'f', 1, 64))
+
+	sections := []struct {
+		title  string
+		counts []service.Count
+	}{
+		{"watched per year", stats.Years},
+		{"watched per month", stats.Months},
+		{"top directors", stats.TopDirectors},
+		{"top artists", stats.TopArtists},
+		{"release decades", stats.Decades},
+	}
+
+	for _, section := range sections {
+		if len(section.counts) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(tw, "\n%s:\n", section.title)
+		for _, count := range section.counts {
+			fmt.Fprintf(tw, "  %s\t%d\n", count.Name, count.Count)
+		}
+	}
+
+	if stats.UnknownYear != 0 {
+		fmt.Fprintf(tw, "\nyear not known:\t%d\n", stats.UnknownYear)
+	}
+
+	return tw.Flush()
+}
+
+// Run executes the StatsCommand. It returns a non-nil error if the
+// underlying stats service encounters a problem. The statistics are
+// written to standard output.
+func (s *StatsCommand) Run(ctx context.Context) error {
+	stats, err := MediaDbClient.Stats(ctx, s.MediaType, getYearFilter(s.Year), s.Top)
+	if err != nil {
+		return err
+	}
+
+	if s.Output == mediafile.JSONFormat() {
+		jsonData, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		StdoutLogger.Println(string(jsonData))
+		return nil
+	}
+
+	return writeStatsText(StdoutLogger.Writer(), stats)
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/alexpcook/media-db/service"
+)
+
+func TestNewStatsCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		year    int
+		isError bool
+	}{
+		{"valid", []string{"stats"}, 0, false},
+		{"valid-movie", []string{"stats", "movie"}, 0, false},
+		{"valid-year", []string{"stats", "music", "-year=2021"}, 2021, false},
+		{"valid-flags-first", []string{"stats", "--year", "2021", "-output=json", "movie"}, 2021, false},
+		{"valid-top", []string{"stats", "-top", "3"}, 0, false},
+		{"invalid-media-type", []string{"stats", "invalid"}, 0, true},
+		{"extra-args", []string{"stats", "movie", "music"}, 0, true},
+		{"invalid-year", []string{"stats", "-year=last"}, 0, true},
+		{"negative-year", []string{"stats", "-year=-1"}, 0, true},
+		{"zero-top", []string{"stats", "-top=0"}, 0, true},
+		{"invalid-output", []string{"stats", "-output=csv"}, 0, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			statsCmd, err := NewStatsCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if statsCmd.Year != test.year {
+				subtt.Fatalf("want year %d, got %d", test.year, statsCmd.Year)
+			}
+		})
+	}
+}
+
+func TestWriteStatsText(tt *testing.T) {
+	stats := service.Stats{
+		Total:               3,
+		Types:               []service.Count{{Name: "movie", Count: 2}, {Name: "music", Count: 1}},
+		Years:               []service.Count{{Name: "2021", Count: 3}},
+		TopDirectors:        []service.Count{{Name: "Christopher Nolan", Count: 2}},
+		Decades:             []service.Count{{Name: "1990s", Count: 1}, {Name: "2000s", Count: 2}},
+		UnknownYear:         1,
+		AverageYearsToWatch: 12.25,
+	}
+
+	want := `total:                                3 (2 movie, 1 music)
+average years from release to watch:  12.2
+
+watched per year:
+  2021  3
+
+top directors:
+  Christopher Nolan  2
+
+release decades:
+  1990s  1
+  2000s  2
+
+year not known:  1
+`
+
+	var buf bytes.Buffer
+	err := writeStatsText(&buf, stats)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if got := buf.String(); got != want {
+		tt.Fatalf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
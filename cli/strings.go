@@ -1,8 +1,15 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/alexpcook/media-db/mediafile"
+	"github.com/alexpcook/media-db/query"
+	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
 )
 
 // SetupCmdName returns the name of the setup command.
@@ -30,6 +37,71 @@ func DeleteCmdName() string {
 	return "delete"
 }
 
+// ReindexCmdName returns the name of the reindex command.
+func ReindexCmdName() string {
+	return "reindex"
+}
+
+// TrashCmdName returns the name of the trash command.
+func TrashCmdName() string {
+	return "trash"
+}
+
+// RestoreCmdName returns the name of the restore command.
+func RestoreCmdName() string {
+	return "restore"
+}
+
+// HistoryCmdName returns the name of the history command.
+func HistoryCmdName() string {
+	return "history"
+}
+
+// RevertCmdName returns the name of the revert command.
+func RevertCmdName() string {
+	return "revert"
+}
+
+// ImportCmdName returns the name of the import command.
+func ImportCmdName() string {
+	return "import"
+}
+
+// ExportCmdName returns the name of the export command.
+func ExportCmdName() string {
+	return "export"
+}
+
+// BackupCmdName returns the name of the backup command.
+func BackupCmdName() string {
+	return "backup"
+}
+
+// SyncCmdName returns the name of the sync command.
+func SyncCmdName() string {
+	return "sync"
+}
+
+// PushCmdName returns the name of the push command.
+func PushCmdName() string {
+	return "push"
+}
+
+// RekeyCmdName returns the name of the rekey command.
+func RekeyCmdName() string {
+	return "rekey"
+}
+
+// MigrateCmdName returns the name of the migrate command.
+func MigrateCmdName() string {
+	return "migrate"
+}
+
+// StatsCmdName returns the name of the stats command.
+func StatsCmdName() string {
+	return "stats"
+}
+
 // MovieMediaType returns the name of the movie media type.
 func MovieMediaType() string {
 	return "movie"
@@ -51,11 +123,24 @@ func GetCLIHelpText() string {
 	return fmt.Sprintf(`usage: media-db <command> [%s] [<flag>...]
 
 where <command> is one of:
-  setup		Configure the database connection to AWS
+  setup		Configure the database connection to AWS or a local directory
   create	Create an entry in the database
   read		Read entries from the database
   update	Update an entry in the database
-  delete	Delete an entry from the database`, strings.Join(GetMediaTypes(), "|"))
+  delete	Move an entry from the database to the trash
+  trash		List or purge the entries in the trash
+  restore	Restore an entry from the trash, or the database from a backup
+  history	Show the previous versions of an entry
+  revert	Revert an entry to a previous version
+  import	Create entries in the database from a file
+  export	Write the entries in the database to a file
+  stats		Summarize the entries in the database
+  backup	Write a snapshot of the whole database to an archive
+  push		Make the changes queued while the database could not be reached
+  sync		Copy the changes between two configured databases
+  rekey		Encrypt the database with a new key
+  migrate	Rewrite the stored entries in the latest schema version
+  reindex	Rebuild the database index from the stored entries`, strings.Join(GetMediaTypes(), "|"))
 }
 
 // GetInvalidCommandHelpText returns help text intended to be displayed
@@ -79,17 +164,157 @@ func GetCommandHelpText(cmd string) string {
 	mediaTypes := strings.Join(GetMediaTypes(), "|")
 
 	switch cmd {
+	case SetupCmdName():
+		return fmt.Sprintf(`usage: media-db %s -profile=<profile> -region=<region> -bucket=<bucket> | -dir=<dir> [-concurrency=<n>] [-timeout=<duration>] [-queue] [-key-file=<file>|-passphrase-env=<var>] [-name=<profile>]`, cmd)
 	case CreateCmdName(), UpdateCmdName():
 		flagsHelpText := "<flag>..."
 		if cmd == UpdateCmdName() {
-			flagsHelpText = fmt.Sprintf("%s %s", "-id=<id>", flagsHelpText)
+			flagsHelpText = fmt.Sprintf("%s %s %s", "-id=<id>", "[-etag=<etag>]", flagsHelpText)
 		}
 		return fmt.Sprintf(`usage: media-db %s %s %s`, cmd, mediaTypes, flagsHelpText)
 	case ReadCmdName():
-		return fmt.Sprintf(`usage: media-db %s [%s] [-id=<id>]`, cmd, mediaTypes)
+		return fmt.Sprintf(`usage: media-db %s [%s] [-id=<id>] [-title=<text>] [-director=<text>] [-artist=<text>] [-year=<year>] [-year-min=<year>] [-year-max=<year>] [-watched-after=<date>] [-watched-before=<date>] [-where=<query>] [-sort=<field>[:asc|:desc]] [-limit=<n>] [-offset=<n>] [-group-by=%s] [-output=%s] [-fields=<field>,...] [-template=<template>]`, cmd, mediaTypes, strings.Join(query.GetGroupings(), "|"), strings.Join(GetOutputFormats(), "|"))
 	case DeleteCmdName():
+		return fmt.Sprintf(`usage: media-db %s %s -id=<id> [-etag=<etag>]`, cmd, mediaTypes)
+	case ReindexCmdName():
+		return fmt.Sprintf(`usage: media-db %s`, cmd)
+	case TrashCmdName():
+		return fmt.Sprintf(`usage: media-db %s %s [%s] | %s -older-than=<age>|-all`, cmd, TrashListSubcmdName(), mediaTypes, TrashPurgeSubcmdName())
+	case RestoreCmdName():
+		return fmt.Sprintf(`usage: media-db %s [%s] -id=<id> | -archive=<archive> [-into-empty|-merge|-overwrite]`, cmd, mediaTypes)
+	case BackupCmdName():
+		return fmt.Sprintf(`usage: media-db %s -o=<archive>`, cmd)
+	case RekeyCmdName():
+		return fmt.Sprintf(`usage: media-db %s -key-file=<file> | -passphrase-env=<var> | -decrypt`, cmd)
+	case PushCmdName():
+		return fmt.Sprintf(`usage: media-db %s [-force|-skip-conflicts]`, cmd)
+	case MigrateCmdName():
+		return fmt.Sprintf(`usage: media-db %s [-dry-run]`, cmd)
+	case StatsCmdName():
+		return fmt.Sprintf(`usage: media-db %s [%s] [-year=<year>] [-top=<n>] [-output=%s|%s]`, cmd, mediaTypes, TextOutput(), mediafile.JSONFormat())
+	case SyncCmdName():
+		return fmt.Sprintf(`usage: media-db %s [-from=<profile>] [-to=<profile>] [-bidirectional] [-dry-run]`, cmd)
+	case HistoryCmdName():
 		return fmt.Sprintf(`usage: media-db %s %s -id=<id>`, cmd, mediaTypes)
+	case RevertCmdName():
+		return fmt.Sprintf(`usage: media-db %s %s -id=<id> -version=<version>`, cmd, mediaTypes)
+	case ImportCmdName():
+		return fmt.Sprintf(`usage: media-db %s [-format=%s] [-type=%s] <file> | %s <file>... | %s|%s [-min-play=<duration>] <file>...`, cmd, strings.Join(mediafile.GetFormats(), "|"), mediaTypes, mediafile.LetterboxdFormat(), mediafile.LastfmFormat(), mediafile.SpotifyFormat())
+	case ExportCmdName():
+		return fmt.Sprintf(`usage: media-db %s [-format=%s] [%s] [-o=<file>] | %s [-o=<file>]`, cmd, strings.Join(mediafile.GetFormats(), "|"), mediaTypes, mediafile.LetterboxdFormat())
 	default:
 		return GetInvalidCommandHelpText(cmd)
 	}
 }
+
+// GetQueryErrorHelpText returns help text intended to be displayed when
+// a query given to the read command cannot be parsed. A *query.Error is
+// shown with the query and a marker under the problem.
+func GetQueryErrorHelpText(err error) string {
+	var queryErr *query.Error
+	if !errors.As(err, &queryErr) {
+		return fmt.Sprintf("media-db: -where: %s", err)
+	}
+
+	return fmt.Sprintf(`media-db: -where: %s
+
+  %s
+  %s^
+
+the fields are %s`, queryErr, queryErr.Query, strings.Repeat(" ", queryErr.Column-1), strings.Join(query.GetFields(), ", "))
+}
+
+// GetNotFoundHelpText returns help text intended to be displayed when
+// an entry given to a command does not exist in the database.
+func GetNotFoundHelpText(err error) string {
+	return fmt.Sprintf(`media-db: %s
+
+run 'media-db %s' to list the entries, or 'media-db %s %s' to list the deleted entries`, err.Error(), ReadCmdName(), TrashCmdName(), TrashListSubcmdName())
+}
+
+// GetValidationHelpText returns help text intended to be displayed when
+// a field of an entry given to a command is not valid. The field is named
+// by its flag.
+func GetValidationHelpText(validationErr *schema.ValidationError) string {
+	return fmt.Sprintf("media-db: -%s %s", validationErr.Field, validationErr.Reason)
+}
+
+// GetConflictHelpText returns help text intended to be displayed when an
+// entry was changed by another writer after the user read it.
+func GetConflictHelpText(conflictErr *service.ConflictError) string {
+	if conflictErr.Current == nil {
+		return fmt.Sprintf(`media-db: %s
+
+the entry no longer exists in the database`, conflictErr.Error())
+	}
+
+	return fmt.Sprintf(`media-db: %s
+
+the current value in the database is:
+%s
+  etag: %s
+
+rerun the command with -etag=%s to replace it`, conflictErr.Error(), conflictErr.Current, conflictErr.CurrentVersion, conflictErr.CurrentVersion)
+}
+
+// GetPushConflictHelpText returns help text intended to be displayed when
+// a queued change conflicts with a change made in the database after it
+// was queued. The err describes the queued change, and remaining is the
+// number of changes still in the queue, including the conflicting one.
+func GetPushConflictHelpText(err error, conflictErr *service.ConflictError, remaining int) string {
+	current := "the entry no longer exists in the database"
+	if conflictErr.Current != nil {
+		current = fmt.Sprintf("the current value in the database is:\n%s", conflictErr.Current)
+	}
+
+	return fmt.Sprintf(`media-db: %s
+
+%s
+
+%d changes are still queued, rerun the command with -force to replace the entry
+with the queued change, or with -skip-conflicts to drop the queued change`, err.Error(), current, remaining)
+}
+
+// GetRekeyHelpText returns help text intended to be displayed when a
+// rekey fails after numObjects objects were already changed to the new key.
+func GetRekeyHelpText(err error, numObjects int) string {
+	if numObjects == 0 {
+		return fmt.Sprintf("media-db: %s", err.Error())
+	}
+
+	return fmt.Sprintf(`media-db: %s
+
+%d objects already use the new key, and cannot be read until the rekey is
+finished, rerun the command with the same key to finish it`, err.Error(), numObjects)
+}
+
+// GetInterruptingHelpText returns help text intended to be displayed
+// as soon as the user interrupts a command.
+func GetInterruptingHelpText() string {
+	return "media-db: interrupted, stopping once the changes in progress are finished (interrupt again to quit now)"
+}
+
+// GetInterruptedHelpText returns help text intended to be displayed when
+// the command named cmdName stops with err because the user interrupted
+// it. The help text depends on whether the command changes the database.
+func GetInterruptedHelpText(cmdName string, err error) string {
+	reason := strings.TrimPrefix(err.Error(), "media-db: ")
+	if reason == context.Canceled.Error() {
+		reason = "interrupted"
+	}
+
+	var consequence string
+	switch cmdName {
+	case SetupCmdName(), ReadCmdName(), HistoryCmdName(), ExportCmdName(), BackupCmdName(), StatsCmdName():
+		consequence = "the command does not change the database, so nothing in it was changed"
+	case CreateCmdName(), UpdateCmdName(), DeleteCmdName(), RevertCmdName():
+		consequence = fmt.Sprintf(`the command was interrupted while changing the database, so the change may
+or may not have been made, run 'media-db %s' or 'media-db %s' to check`, ReadCmdName(), HistoryCmdName())
+	default:
+		consequence = fmt.Sprintf(`the command was interrupted part of the way through, so the changes reported
+above were made, and the last change in progress may or may not have been
+made, run 'media-db %s' or 'media-db %s' to check`, ReadCmdName(), HistoryCmdName())
+	}
+
+	return fmt.Sprintf("media-db: %s\n\n%s", reason, consequence)
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/service"
+)
+
+// SyncCommand provides an interface between the CLI and the MediaDbClient sync service.
+type SyncCommand struct {
+	FlagSet *flag.FlagSet
+	From    string
+	To      string
+	Options service.SyncOptions
+}
+
+// NewSyncCommand returns a pointer to a new SyncCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewSyncCommand(args []string) (*SyncCommand, error) {
+	syncCmd := &SyncCommand{
+		FlagSet: flag.NewFlagSet("sync", flag.ContinueOnError),
+	}
+
+	syncCmd.FlagSet.StringVar(&syncCmd.From, "from", config.DefaultProfileName(), "The profile of the database to sync from (optional)")
+	syncCmd.FlagSet.StringVar(&syncCmd.To, "to", config.DefaultProfileName(), "The profile of the database to sync to (optional)")
+	syncCmd.FlagSet.BoolVar(&syncCmd.Options.Bidirectional, "bidirectional", false, "Sync changes both ways, where the last change wins (optional)")
+	syncCmd.FlagSet.BoolVar(&syncCmd.Options.DryRun, "dry-run", false, "List the changes without making them (optional)")
+
+	err := syncCmd.FlagSet.Parse(args[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if syncCmd.From == syncCmd.To || syncCmd.FlagSet.NArg() != 0 {
+		return nil, errors.New(GetCommandHelpText(SyncCmdName()))
+	}
+
+	for _, profile := range []string{syncCmd.From, syncCmd.To} {
+		_, err = config.GetProfileConfigFile(profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return syncCmd, nil
+}
+
+// newProfileClient initializes a service client for the database
+// configured by the named profile.
+func newProfileClient(profile string) (*service.MediaDbClient, error) {
+	dbConfig, err := config.LoadProfileMediaDbConfig(profile)
+	if err == nil {
+		var client *service.MediaDbClient
+		client, err = service.NewMediaDbClient(dbConfig)
+		if err == nil {
+			return client, nil
+		}
+	}
+
+	setupHelp := "media-db setup"
+	if profile != config.DefaultProfileName() {
+		setupHelp = fmt.Sprintf("media-db setup -name=%s", profile)
+	}
+
+	return nil, fmt.Errorf(`profile %s: %s
+
+run '%s' to fix the configuration issue`, profile, err.Error(), setupHelp)
+}
+
+// Run executes the SyncCommand. It returns a non-nil error if either
+// database cannot be loaded or the underlying sync service encounters
+// a problem. Each change is written to standard output, followed by
+// a summary.
+func (s *SyncCommand) Run(ctx context.Context) error {
+	src, err := newProfileClient(s.From)
+	if err != nil {
+		return err
+	}
+
+	dst, err := newProfileClient(s.To)
+	if err != nil {
+		return err
+	}
+
+	// The changes that were made are reported even if the sync failed.
+	changes, err := src.Sync(ctx, dst, s.Options)
+	if err != nil && len(changes) == 0 {
+		return err
+	}
+
+	counts := make(map[service.SyncAction]int)
+	for _, change := range changes {
+		profile := s.To
+		if change.ToSource {
+			profile = s.From
+		}
+
+		StdoutLogger.Printf("%-6s %s in %s", change.Action, change.Key, profile)
+		counts[change.Action]++
+	}
+
+	if s.Options.DryRun {
+		StdoutLogger.Printf("dry run: %d to create, %d to update, %d to delete", counts[service.SyncCreate], counts[service.SyncUpdate], counts[service.SyncDelete])
+	} else {
+		StdoutLogger.Printf("created %d, updated %d, deleted %d objects", counts[service.SyncCreate], counts[service.SyncUpdate], counts[service.SyncDelete])
+	}
+
+	return err
+}
@@ -0,0 +1,35 @@
+package cli
+
+import "testing"
+
+func TestNewSyncCommand(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		isError bool
+	}{
+		{"valid-1", []string{"sync", "-from", "work", "-to", "home"}, false},
+		{"valid-2", []string{"sync", "--to=backup"}, false},
+		{"valid-3", []string{"sync", "-from=backup", "-bidirectional", "-dry-run"}, false},
+		{"same-profile-1", []string{"sync"}, true},
+		{"same-profile-2", []string{"sync", "-from", "home", "-to", "home"}, true},
+		{"invalid-profile", []string{"sync", "-to", "../backup"}, true},
+		{"invalid-flags", []string{"sync", "-notaflag", "backup"}, true},
+		{"extra-args", []string{"sync", "-to", "backup", "movie"}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := NewSyncCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
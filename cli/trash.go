@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// TrashListSubcmdName returns the name of the trash list subcommand.
+func TrashListSubcmdName() string {
+	return "list"
+}
+
+// TrashPurgeSubcmdName returns the name of the trash purge subcommand.
+func TrashPurgeSubcmdName() string {
+	return "purge"
+}
+
+// TrashCommand provides an interface between the CLI and the MediaDbClient trash services.
+type TrashCommand struct {
+	FlagSet    *flag.FlagSet
+	Subcommand string
+	MediaType  schema.Media
+	OlderThan  time.Duration
+}
+
+// NewTrashCommand returns a pointer to a new TrashCommand struct. If there is a problem
+// creating the command, the usage help text for the command will be returned as a non-nil error.
+func NewTrashCommand(args []string) (*TrashCommand, error) {
+	if len(args) < 2 {
+		return nil, errors.New(GetCommandHelpText(TrashCmdName()))
+	}
+
+	trashCmd := &TrashCommand{
+		Subcommand: args[1],
+	}
+
+	switch trashCmd.Subcommand {
+	case TrashListSubcmdName():
+		trashCmd.FlagSet = flag.NewFlagSet("trash list", flag.ContinueOnError)
+
+		err := trashCmd.FlagSet.Parse(args[2:])
+		if err != nil {
+			return nil, err
+		}
+
+		switch trashCmd.FlagSet.NArg() {
+		case 0:
+		case 1:
+			switch mediaType := trashCmd.FlagSet.Arg(0); mediaType {
+			case MovieMediaType():
+				trashCmd.MediaType = schema.Movie{}
+			case MusicMediaType():
+				trashCmd.MediaType = schema.Music{}
+			default:
+				return nil, errors.New(GetInvalidMediaTypeHelpText(TrashCmdName(), mediaType))
+			}
+		default:
+			return nil, errors.New(GetCommandHelpText(TrashCmdName()))
+		}
+	case TrashPurgeSubcmdName():
+		trashCmd.FlagSet = flag.NewFlagSet("trash purge", flag.ContinueOnError)
+
+		olderThan := trashCmd.FlagSet.String("older-than", "", "Only purge entries deleted at least this long ago, such as 30d or 12h")
+		all := trashCmd.FlagSet.Bool("all", false, "Purge every entry in the trash, however recently it was deleted")
+
+		err := trashCmd.FlagSet.Parse(args[2:])
+		if err != nil {
+			return nil, err
+		}
+
+		if trashCmd.FlagSet.NArg() != 0 {
+			return nil, errors.New(GetCommandHelpText(TrashCmdName()))
+		}
+
+		// Purging is permanent, so the whole trash is only purged when asked for.
+		if hasAge := countSetFlags(trashCmd.FlagSet, "older-than") != 0; hasAge == *all {
+			return nil, fmt.Errorf("media-db: %s %s needs either -older-than=<age> or -all\n\n%s", TrashCmdName(), TrashPurgeSubcmdName(), GetCommandHelpText(TrashCmdName()))
+		}
+		if *all {
+			break
+		}
+
+		trashCmd.OlderThan, err = parseAge(*olderThan)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(GetCommandHelpText(TrashCmdName()))
+	}
+
+	return trashCmd, nil
+}
+
+// Run executes the TrashCommand. It returns a non-nil error
+// if the underlying trash service encounters a problem. The
+// deleted entries are written to standard output.
+func (t *TrashCommand) Run(ctx context.Context) error {
+	if t.Subcommand == TrashPurgeSubcmdName() {
+		numPurged, err := MediaDbClient.PurgeTrash(ctx, t.OlderThan)
+		if numPurged != 0 || err == nil {
+			StdoutLogger.Printf("purged %d entries", numPurged)
+		}
+
+		return err
+	}
+
+	trashEntries, err := MediaDbClient.ReadTrash(ctx, t.MediaType)
+	if err != nil {
+		return err
+	}
+
+	for _, trashEntry := range trashEntries {
+		StdoutLogger.Printf("%s\n  deleted: %s", trashEntry.Media, trashEntry.DeletedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTrashCommand(tt *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		olderThan time.Duration
+		isError   bool
+	}{
+		{"valid-list", []string{"trash", "list"}, 0, false},
+		{"valid-list-movie", []string{"trash", "list", "movie"}, 0, false},
+		{"valid-list-music", []string{"trash", "list", "music"}, 0, false},
+		{"valid-purge-all", []string{"trash", "purge", "-all"}, 0, false},
+		{"valid-purge-days", []string{"trash", "purge", "-older-than=30d"}, 30 * 24 * time.Hour, false},
+		{"valid-purge-hours", []string{"trash", "purge", "-older-than", "12h"}, 12 * time.Hour, false},
+		{"no-subcommand", []string{"trash"}, 0, true},
+		{"invalid-subcommand", []string{"trash", "empty"}, 0, true},
+		{"invalid-media-type", []string{"trash", "list", "invalid"}, 0, true},
+		{"extra-args", []string{"trash", "list", "movie", "music"}, 0, true},
+		{"invalid-age", []string{"trash", "purge", "-older-than=soon"}, 0, true},
+		{"negative-age", []string{"trash", "purge", "-older-than=-1d"}, 0, true},
+		{"purge-media-type", []string{"trash", "purge", "-all", "movie"}, 0, true},
+		{"purge-without-flags", []string{"trash", "purge"}, 0, true},
+		{"purge-all-false", []string{"trash", "purge", "-all=false"}, 0, true},
+		{"purge-all-and-age", []string{"trash", "purge", "-all", "-older-than=30d"}, 0, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			trashCmd, err := NewTrashCommand(test.args)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if trashCmd.OlderThan != test.olderThan {
+				subtt.Fatalf("want %v, got %v", test.olderThan, trashCmd.OlderThan)
+			}
+		})
+	}
+}
@@ -1,19 +1,26 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"strings"
 
 	"github.com/alexpcook/media-db/schema"
+	"github.com/alexpcook/media-db/service"
 )
 
 // UpdateCommand provides an interface between the CLI and the MediaDbClient update service.
 type UpdateCommand struct {
 	FlagSet      *flag.FlagSet
 	ID           string
+	ETag         string
 	UpdatedMedia schema.Media
+
+	// Keep names the fields that keep their stored values
+	// because the optional flags for them were not given.
+	Keep []string
 }
 
 // NewUpdateCommand returns a pointer to a new UpdateCommand struct. If there is a problem
@@ -37,6 +44,9 @@ func NewUpdateCommand(args []string) (*UpdateCommand, error) {
 		updateCmd.FlagSet.StringVar(&movie.Director, "director", "", "The director of the movie")
 		updateCmd.FlagSet.IntVar(&movie.YearMade, "year", 0, "The year the movie was made")
 		updateCmd.FlagSet.StringVar(&dateStr, "date", "", "The date the movie was watched")
+		updateCmd.FlagSet.Float64Var(&movie.Rating, "rating", 0, "The rating of the movie out of 5, in steps of 0.5 (optional)")
+		updateCmd.FlagSet.BoolVar(&movie.Rewatch, "rewatch", false, "Whether the movie had been watched before (optional)")
+		updateCmd.FlagSet.StringVar(&updateCmd.ETag, "etag", "", "The etag of the movie the update is based on (optional)")
 
 		err := updateCmd.FlagSet.Parse(args[2:])
 		if err != nil {
@@ -44,28 +54,39 @@ func NewUpdateCommand(args []string) (*UpdateCommand, error) {
 		}
 
 		expectFlags := 5
-		if gotFlags := updateCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+		if gotFlags := updateCmd.FlagSet.NFlag() - countSetFlags(updateCmd.FlagSet, "etag", "rating", "rewatch"); gotFlags != expectFlags {
 			updateCmd.FlagSet.Usage()
 			return nil, errors.New("")
 		}
 
-		movie, err = schema.NewMovie(movie.Title, movie.Director, movie.YearMade, dateStr)
+		err = schema.ValidateRating(movie.Rating)
+		if err != nil {
+			return nil, err
+		}
+
+		newMovie, err := schema.NewMovie(movie.Title, movie.Director, movie.YearMade, dateStr)
 		if err != nil {
 			return nil, err
 		}
 
-		movie.ID = updateCmd.ID
-		updateCmd.UpdatedMedia = *movie
+		newMovie.ID = updateCmd.ID
+		newMovie.Rating = movie.Rating
+		newMovie.Rewatch = movie.Rewatch
+		updateCmd.UpdatedMedia = *newMovie
+		updateCmd.Keep = getUnsetFlags(updateCmd.FlagSet, "rating", "rewatch")
 	case MusicMediaType():
 		updateCmd.FlagSet = flag.NewFlagSet("update music", flag.ContinueOnError)
 		music := new(schema.Music)
-		var dateStr string
+		var dateStr, lastStr string
 
 		updateCmd.FlagSet.StringVar(&updateCmd.ID, "id", "", "The id of the music to udpate")
 		updateCmd.FlagSet.StringVar(&music.Title, "title", "", "The title of the piece of music")
 		updateCmd.FlagSet.StringVar(&music.Artist, "artist", "", "The artist who made or performed the piece of music")
 		updateCmd.FlagSet.IntVar(&music.YearMade, "year", 0, "The year the music was made")
 		updateCmd.FlagSet.StringVar(&dateStr, "date", "", "The date the music was listened to")
+		updateCmd.FlagSet.IntVar(&music.Plays, "plays", 0, "The number of times the music was played (optional)")
+		updateCmd.FlagSet.StringVar(&lastStr, "last-listened", "", "The date the music was last listened to (optional)")
+		updateCmd.FlagSet.StringVar(&updateCmd.ETag, "etag", "", "The etag of the music the update is based on (optional)")
 
 		err := updateCmd.FlagSet.Parse(args[2:])
 		if err != nil {
@@ -73,18 +94,38 @@ func NewUpdateCommand(args []string) (*UpdateCommand, error) {
 		}
 
 		expectFlags := 5
-		if gotFlags := updateCmd.FlagSet.NFlag(); gotFlags != expectFlags {
+		if gotFlags := updateCmd.FlagSet.NFlag() - countSetFlags(updateCmd.FlagSet, "etag", "plays", "last-listened"); gotFlags != expectFlags {
 			updateCmd.FlagSet.Usage()
 			return nil, errors.New("")
 		}
 
-		music, err = schema.NewMusic(music.Title, music.Artist, music.YearMade, dateStr)
+		err = schema.ValidatePlays(music.Plays)
 		if err != nil {
 			return nil, err
 		}
 
-		music.ID = updateCmd.ID
-		updateCmd.UpdatedMedia = *music
+		lastListened, err := schema.ParseLastListened(lastStr)
+		if err != nil {
+			return nil, err
+		}
+
+		newMusic, err := schema.NewMusic(music.Title, music.Artist, music.YearMade, dateStr)
+		if err != nil {
+			return nil, err
+		}
+
+		newMusic.ID = updateCmd.ID
+		newMusic.Plays = music.Plays
+		newMusic.LastListened = lastListened
+		updateCmd.UpdatedMedia = *newMusic
+
+		// The last listen is stored as "last".
+		updateCmd.Keep = getUnsetFlags(updateCmd.FlagSet, "plays", "last-listened")
+		for i, name := range updateCmd.Keep {
+			if name == "last-listened" {
+				updateCmd.Keep[i] = "last"
+			}
+		}
 	default:
 		return nil, errors.New(GetInvalidMediaTypeHelpText(UpdateCmdName(), mediaType))
 	}
@@ -93,7 +134,13 @@ func NewUpdateCommand(args []string) (*UpdateCommand, error) {
 }
 
 // Run executes the UpdateCommand. It returns a non-nil error
-// if the underlying update service encounters a problem.
-func (u *UpdateCommand) Run() error {
-	return MediaDbClient.Update(u.ID, u.UpdatedMedia)
+// if the underlying update service encounters a problem. The
+// update is queued instead if the database cannot be reached.
+// The fields in Keep are left as they are stored either way.
+func (u *UpdateCommand) Run(ctx context.Context) error {
+	if MediaDbClient == nil {
+		return queueChange(service.QueuedUpdate, u.UpdatedMedia.Key(), u.UpdatedMedia, u.ETag, u.Keep)
+	}
+
+	return conflictHelp(MediaDbClient.UpdateKeeping(ctx, u.ID, u.UpdatedMedia, u.ETag, u.Keep))
 }
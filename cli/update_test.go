@@ -1,6 +1,9 @@
 package cli
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestNewUpdateCommand(tt *testing.T) {
 	testCases := []struct {
@@ -10,6 +13,13 @@ func TestNewUpdateCommand(tt *testing.T) {
 	}{
 		{"valid-1", []string{"update", "music", "-id", "123", "-title", "title", "-artist", "artist", "-year", "2020", "-date", "2021-01-01"}, false},
 		{"valid-2", []string{"update", "movie", "-id", "123", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01"}, false},
+		{"valid-etag", []string{"update", "movie", "-id", "123", "-etag", "abc", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01"}, false},
+		{"valid-rating", []string{"update", "movie", "-id", "123", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01", "-rating=3"}, false},
+		{"valid-plays", []string{"update", "music", "-id", "123", "-title", "title", "-artist", "artist", "-year", "2020", "-date", "2021-01-01", "-plays=3", "-last-listened=2021-02-01"}, false},
+		{"invalid-plays", []string{"update", "music", "-id", "123", "-title", "title", "-artist", "artist", "-year", "2020", "-date", "2021-01-01", "-plays=-1"}, true},
+		{"invalid-last-listened", []string{"update", "music", "-id", "123", "-title", "title", "-artist", "artist", "-year", "2020", "-date", "2021-01-01", "-last-listened=yesterday"}, true},
+		{"invalid-rating", []string{"update", "movie", "-id", "123", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01", "-rating=6"}, true},
+		{"etag-without-id", []string{"update", "movie", "-etag", "abc", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01"}, true},
 		{"less-than-two-args", []string{"update"}, true},
 		{"invalid-media-type", []string{"update", "invalid"}, true},
 		{"invalid-flags-1", []string{"update", "movie", "-notaflag", "movie"}, true},
@@ -35,3 +45,34 @@ func TestNewUpdateCommand(tt *testing.T) {
 		})
 	}
 }
+
+func TestNewUpdateCommandKeep(tt *testing.T) {
+	movieArgs := []string{"update", "movie", "-id", "123", "-title", "title", "-director", "dir", "-year", "2020", "-date", "2021-01-01"}
+	musicArgs := []string{"update", "music", "-id", "123", "-title", "title", "-artist", "artist", "-year", "2020", "-date", "2021-01-01"}
+
+	testCases := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"no-optional-flags", movieArgs, []string{"rating", "rewatch"}},
+		{"rating", append(movieArgs[:len(movieArgs):len(movieArgs)], "-rating=3"), []string{"rewatch"}},
+		{"rating-rewatch", append(movieArgs[:len(movieArgs):len(movieArgs)], "-rating=0", "-rewatch=false"), []string{}},
+		{"no-music-optional-flags", musicArgs, []string{"plays", "last"}},
+		{"plays", append(musicArgs[:len(musicArgs):len(musicArgs)], "-plays=3"), []string{"last"}},
+		{"plays-last-listened", append(musicArgs[:len(musicArgs):len(musicArgs)], "-plays=3", "-last-listened=2021-02-01"), []string{}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			updateCmd, err := NewUpdateCommand(test.args)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(test.want, updateCmd.Keep) {
+				subtt.Fatalf("want to keep %v, got %v", test.want, updateCmd.Keep)
+			}
+		})
+	}
+}
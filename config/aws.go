@@ -1,13 +1,18 @@
 package config
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 // GetDefaultConfigFile returns the default database configuration file
@@ -47,12 +52,157 @@ func GetCurrentConfigFile() string {
 	return GetDefaultConfigFile()
 }
 
-// MediaDbConfig contains the AWS profile, region, and S3 bucket name to use
-// for interacting with the database.
+// S3BackendType returns the name of the AWS S3 storage backend.
+func S3BackendType() string {
+	return "s3"
+}
+
+// LocalBackendType returns the name of the local filesystem storage backend.
+func LocalBackendType() string {
+	return "local"
+}
+
+// MediaDbConfig contains the storage backend type along with the settings
+// for that backend. The S3 backend uses the AWS profile, region, and S3
+// bucket name. The local backend uses the directory to store entries in.
+// Concurrency is the maximum number of entries to fetch from the backend
+// at once, where zero means the service default. If QueueOffline is true,
+// changes are queued in a local file while the backend cannot be reached.
+// Timeout is the longest a single request to the backend may take, as a
+// duration such as "30s", where the empty string means the service default.
+// Entries are encrypted if either KeyFile, a file containing the secret
+// to derive the encryption key from, or PassphraseEnv, an environment
+// variable containing a passphrase to derive it from, is set. KeySalt is
+// the base64-encoded salt used to derive the key.
 type MediaDbConfig struct {
-	AWSProfile string `json:"profile"`
-	AWSRegion  string `json:"region"`
-	S3Bucket   string `json:"bucket"`
+	Backend       string `json:"backend,omitempty"`
+	AWSProfile    string `json:"profile,omitempty"`
+	AWSRegion     string `json:"region,omitempty"`
+	S3Bucket      string `json:"bucket,omitempty"`
+	LocalDir      string `json:"dir,omitempty"`
+	Concurrency   int    `json:"concurrency,omitempty"`
+	QueueOffline  bool   `json:"queue,omitempty"`
+	Timeout       string `json:"timeout,omitempty"`
+	KeyFile       string `json:"key_file,omitempty"`
+	PassphraseEnv string `json:"passphrase_env,omitempty"`
+	KeySalt       string `json:"key_salt,omitempty"`
+}
+
+// BackendType returns the storage backend type of the MediaDbConfig.
+// Configuration files written before the backend setting existed
+// default to the S3 backend.
+func (cfg *MediaDbConfig) BackendType() string {
+	if cfg.Backend == "" {
+		return S3BackendType()
+	}
+
+	return cfg.Backend
+}
+
+// GetTimeout returns the longest a single request to the backend may take,
+// or zero for the service default. It returns a non-nil error if Timeout
+// is not a valid duration or is negative.
+func (cfg *MediaDbConfig) GetTimeout() (time.Duration, error) {
+	if cfg.Timeout == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("timeout is not valid: %w", err)
+	}
+
+	if timeout < 0 {
+		return 0, fmt.Errorf("timeout cannot be negative, got %s", cfg.Timeout)
+	}
+
+	return timeout, nil
+}
+
+// IsEncrypted returns true if entries in the database of the
+// MediaDbConfig are encrypted.
+func (cfg *MediaDbConfig) IsEncrypted() bool {
+	return cfg.KeyFile != "" || cfg.PassphraseEnv != ""
+}
+
+// SetEncryption sets the source of the secret that the encryption key is
+// derived from to either keyFile or passphraseEnv, along with a new random
+// salt. If both are the empty string "", encryption is turned off. A
+// relative key file is converted to an absolute path. It returns a non-nil
+// error if both are given or a salt cannot be generated.
+func (cfg *MediaDbConfig) SetEncryption(keyFile, passphraseEnv string) error {
+	keyFile = strings.TrimSpace(keyFile)
+	passphraseEnv = strings.TrimSpace(passphraseEnv)
+
+	if keyFile != "" && passphraseEnv != "" {
+		return errors.New("only one of a key file and a passphrase environment variable can be given")
+	}
+
+	cfg.KeyFile, cfg.PassphraseEnv, cfg.KeySalt = "", "", ""
+
+	if keyFile != "" {
+		absKeyFile, err := filepath.Abs(keyFile)
+		if err != nil {
+			return err
+		}
+		cfg.KeyFile = absKeyFile
+	}
+	cfg.PassphraseEnv = passphraseEnv
+
+	if cfg.IsEncrypted() {
+		salt := make([]byte, 16)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return err
+		}
+		cfg.KeySalt = base64.StdEncoding.EncodeToString(salt)
+	}
+
+	return nil
+}
+
+// EncryptionSecret returns the secret that the encryption key is derived
+// from, read from the key file or the passphrase environment variable. It
+// returns nil if entries are not encrypted, and a non-nil error if the
+// secret cannot be read or is empty.
+func (cfg *MediaDbConfig) EncryptionSecret() ([]byte, error) {
+	var secret []byte
+
+	switch {
+	case cfg.KeyFile != "":
+		keyData, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		secret = bytes.TrimSpace(keyData)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("key file %s is empty", cfg.KeyFile)
+		}
+	case cfg.PassphraseEnv != "":
+		secret = []byte(os.Getenv(cfg.PassphraseEnv))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("the passphrase environment variable %s is not set", cfg.PassphraseEnv)
+		}
+	}
+
+	return secret, nil
+}
+
+// GetKeySalt returns the decoded salt used to derive the encryption key,
+// or nil if there is none. It returns a non-nil error if the salt is not
+// valid base64.
+func (cfg *MediaDbConfig) GetKeySalt() ([]byte, error) {
+	if cfg.KeySalt == "" {
+		return nil, nil
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(cfg.KeySalt)
+	if err != nil {
+		return nil, fmt.Errorf("key_salt is not valid: %w", err)
+	}
+
+	return salt, nil
 }
 
 // NewMediaDbConfig returns a pointer based on the given AWS profile,
@@ -76,17 +226,88 @@ func NewMediaDbConfig(awsProfile, awsRegion, s3Bucket string) (*MediaDbConfig, e
 	}
 
 	return &MediaDbConfig{
+		Backend:    S3BackendType(),
 		AWSProfile: awsProfile,
 		AWSRegion:  awsRegion,
 		S3Bucket:   s3Bucket,
 	}, nil
 }
 
+// NewLocalMediaDbConfig returns a pointer to a MediaDbConfig that stores
+// the database as files under the given directory. A relative directory
+// is converted to an absolute path.
+func NewLocalMediaDbConfig(localDir string) (*MediaDbConfig, error) {
+	localDir = strings.TrimSpace(localDir)
+	if localDir == "" {
+		return nil, fmt.Errorf("localDir cannot be null, got %q", localDir)
+	}
+
+	absDir, err := filepath.Abs(localDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MediaDbConfig{
+		Backend:  LocalBackendType(),
+		LocalDir: absDir,
+	}, nil
+}
+
+// GetQueueFile returns the location of the file that changes are queued
+// in while the database cannot be reached. It is kept beside the current
+// configuration file.
+func GetQueueFile() string {
+	return path.Join(path.Dir(GetCurrentConfigFile()), "queue")
+}
+
+// DefaultProfileName returns the name of the profile that refers to
+// the configuration in the current configuration file location.
+func DefaultProfileName() string {
+	return "default"
+}
+
+// GetProfileConfigFile returns the configuration file location for the named
+// profile. Profiles are kept in a profiles directory beside the current
+// configuration file, and the default profile is the current configuration
+// file itself. The error will be non-nil if the name is not a valid profile
+// name, which may only contain letters, digits, '.', '-' and '_'.
+func GetProfileConfigFile(profile string) (string, error) {
+	if profile == DefaultProfileName() {
+		return GetCurrentConfigFile(), nil
+	}
+
+	isValid := profile != "" && profile != "." && profile != ".."
+	for _, r := range profile {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(".-_", r)) {
+			isValid = false
+		}
+	}
+	if !isValid {
+		return "", fmt.Errorf("profile name %q may only contain letters, digits, '.', '-' and '_'", profile)
+	}
+
+	return path.Join(path.Dir(GetCurrentConfigFile()), "profiles", profile), nil
+}
+
 // Save creates the MediaDbConfig as JSON in the
 // current configuration file location.
 func (cfg *MediaDbConfig) Save() error {
-	configFile := GetCurrentConfigFile()
+	return cfg.saveFile(GetCurrentConfigFile())
+}
+
+// SaveProfile creates the MediaDbConfig as JSON in the
+// configuration file location for the named profile.
+func (cfg *MediaDbConfig) SaveProfile(profile string) error {
+	configFile, err := GetProfileConfigFile(profile)
+	if err != nil {
+		return err
+	}
+
+	return cfg.saveFile(configFile)
+}
 
+// saveFile creates the MediaDbConfig as JSON in configFile.
+func (cfg *MediaDbConfig) saveFile(configFile string) error {
 	configFileNew, err := os.CreateTemp("", "media_db_config")
 	if err != nil {
 		return err
@@ -112,7 +333,10 @@ func (cfg *MediaDbConfig) Save() error {
 	fileInfo, err := os.Stat(configFileDir)
 
 	if errors.Is(err, os.ErrNotExist) {
-		err = os.Mkdir(configFileDir, 0755)
+		err = os.MkdirAll(configFileDir, 0755)
+		if err != nil {
+			return err
+		}
 	} else if !fileInfo.IsDir() {
 		return fmt.Errorf("%s already exists and is not a directory", configFileDir)
 	}
@@ -131,7 +355,25 @@ func (cfg *MediaDbConfig) Save() error {
 // file ~/.mediadb/config in the user's home directory. The error will be
 // non-nil if a valid config file cannot be found or its settings cannot be parsed.
 func LoadMediaDbConfig() (*MediaDbConfig, error) {
-	configData, err := os.ReadFile(GetCurrentConfigFile())
+	return loadMediaDbConfigFile(GetCurrentConfigFile())
+}
+
+// LoadProfileMediaDbConfig loads the database config for the named profile
+// and returns a pointer to it. The error will be non-nil if the name is not
+// a valid profile name, the profile has not been set up, or its settings
+// cannot be parsed.
+func LoadProfileMediaDbConfig(profile string) (*MediaDbConfig, error) {
+	configFile, err := GetProfileConfigFile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return loadMediaDbConfigFile(configFile)
+}
+
+// loadMediaDbConfigFile loads the database config from configFile.
+func loadMediaDbConfigFile(configFile string) (*MediaDbConfig, error) {
+	configData, err := os.ReadFile(configFile)
 	if err != nil {
 		return nil, err
 	}
@@ -143,16 +385,44 @@ func LoadMediaDbConfig() (*MediaDbConfig, error) {
 	}
 
 	trim := strings.TrimSpace
-	if trim(dbConfig.AWSProfile) == "" {
-		return nil, fmt.Errorf("profile cannot be null, got %q", dbConfig.AWSProfile)
+
+	switch backendType := dbConfig.BackendType(); backendType {
+	case S3BackendType():
+		if trim(dbConfig.AWSProfile) == "" {
+			return nil, fmt.Errorf("profile cannot be null, got %q", dbConfig.AWSProfile)
+		}
+
+		if trim(dbConfig.AWSRegion) == "" {
+			return nil, fmt.Errorf("region cannot be null, got %q", dbConfig.AWSRegion)
+		}
+
+		if trim(dbConfig.S3Bucket) == "" {
+			return nil, fmt.Errorf("bucket cannot be null, got %q", dbConfig.S3Bucket)
+		}
+	case LocalBackendType():
+		if trim(dbConfig.LocalDir) == "" {
+			return nil, fmt.Errorf("dir cannot be null, got %q", dbConfig.LocalDir)
+		}
+	default:
+		return nil, fmt.Errorf("backend %q is not a supported backend type", backendType)
+	}
+
+	if dbConfig.Concurrency < 0 {
+		return nil, fmt.Errorf("concurrency cannot be negative, got %d", dbConfig.Concurrency)
 	}
 
-	if trim(dbConfig.AWSRegion) == "" {
-		return nil, fmt.Errorf("region cannot be null, got %q", dbConfig.AWSRegion)
+	_, err = dbConfig.GetTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	if dbConfig.KeyFile != "" && dbConfig.PassphraseEnv != "" {
+		return nil, errors.New("only one of key_file and passphrase_env can be set")
 	}
 
-	if trim(dbConfig.S3Bucket) == "" {
-		return nil, fmt.Errorf("bucket cannot be null, got %q", dbConfig.S3Bucket)
+	_, err = dbConfig.GetKeySalt()
+	if err != nil {
+		return nil, err
 	}
 
 	return &dbConfig, nil
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func preTestSetup() {
@@ -97,6 +98,25 @@ func TestGetCurrentConfigFile(tt *testing.T) {
 	}
 }
 
+func TestGetQueueFile(tt *testing.T) {
+	err := os.Setenv(GetOverrideConfigFileEnvVar(), path.Join("some", "override", "file"))
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err := os.Unsetenv(GetOverrideConfigFileEnvVar())
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	want := path.Join("some", "override", "queue")
+
+	if got := GetQueueFile(); want != got {
+		tt.Fatalf("want %q, got %q", want, got)
+	}
+}
+
 func TestNewMediaDbConfig(tt *testing.T) {
 	testCases := []struct {
 		name                    string
@@ -107,7 +127,7 @@ func TestNewMediaDbConfig(tt *testing.T) {
 		{
 			"valid",
 			"aws-profile", "aws-region", "aws-bucket",
-			&MediaDbConfig{"aws-profile", "aws-region", "aws-bucket"},
+			&MediaDbConfig{Backend: S3BackendType(), AWSProfile: "aws-profile", AWSRegion: "aws-region", S3Bucket: "aws-bucket"},
 			false,
 		},
 		{
@@ -150,6 +170,58 @@ func TestNewMediaDbConfig(tt *testing.T) {
 	}
 }
 
+func TestNewLocalMediaDbConfig(tt *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		dir     string
+		want    *MediaDbConfig
+		isError bool
+	}{
+		{
+			"absolute",
+			"/some/dir",
+			&MediaDbConfig{Backend: LocalBackendType(), LocalDir: "/some/dir"},
+			false,
+		},
+		{
+			"relative",
+			"some/dir",
+			&MediaDbConfig{Backend: LocalBackendType(), LocalDir: path.Join(cwd, "some", "dir")},
+			false,
+		},
+		{
+			"null-dir",
+			" \t",
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			got, err := NewLocalMediaDbConfig(test.dir)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				subtt.Fatalf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
 func TestMediaDbConfigSave(tt *testing.T) {
 	defer func() {
 		err := os.Unsetenv(GetOverrideConfigFileEnvVar())
@@ -343,6 +415,36 @@ func TestLoadMediaDbConfigOverride(tt *testing.T) {
 			nil,
 			true,
 		},
+		{
+			"local",
+			[]byte(`{"backend": "local", "dir": "/tmp/media-db"}`),
+			&MediaDbConfig{Backend: LocalBackendType(), LocalDir: "/tmp/media-db"},
+			false,
+		},
+		{
+			"null-dir",
+			[]byte(`{"backend": "local", "dir": "  "}`),
+			nil,
+			true,
+		},
+		{
+			"concurrency",
+			[]byte(`{"backend": "local", "dir": "/tmp/media-db", "concurrency": 4}`),
+			&MediaDbConfig{Backend: LocalBackendType(), LocalDir: "/tmp/media-db", Concurrency: 4},
+			false,
+		},
+		{
+			"negative-concurrency",
+			[]byte(`{"backend": "local", "dir": "/tmp/media-db", "concurrency": -1}`),
+			nil,
+			true,
+		},
+		{
+			"invalid-backend",
+			[]byte(`{"backend": "not-a-backend", "profile": "test-profile", "region": "us-west-1", "bucket": "test-bucket"}`),
+			nil,
+			true,
+		},
 	}
 
 	for _, test := range testCases {
@@ -393,3 +495,211 @@ func TestLoadMediaDbConfigOverride(tt *testing.T) {
 		})
 	}
 }
+
+func TestMediaDbConfigProfile(tt *testing.T) {
+	configDir := tt.TempDir()
+	err := os.Setenv(GetOverrideConfigFileEnvVar(), path.Join(configDir, "config"))
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err := os.Unsetenv(GetOverrideConfigFileEnvVar())
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	testCases := []struct {
+		profile string
+		want    string
+		isError bool
+	}{
+		{"backup", path.Join(configDir, "profiles", "backup"), false},
+		{"us-west-2_old.bucket", path.Join(configDir, "profiles", "us-west-2_old.bucket"), false},
+		{DefaultProfileName(), path.Join(configDir, "config"), false},
+		{"", "", true},
+		{"..", "", true},
+		{"../config", "", true},
+		{"a profile", "", true},
+	}
+
+	for _, test := range testCases {
+		got, err := GetProfileConfigFile(test.profile)
+
+		if test.isError {
+			if err == nil {
+				tt.Fatalf("for profile %q, want error, got nil", test.profile)
+			}
+			continue
+		} else if err != nil {
+			tt.Fatal(err)
+		}
+
+		if test.want != got {
+			tt.Fatalf("want %q, got %q", test.want, got)
+		}
+	}
+
+	_, err = LoadProfileMediaDbConfig("backup")
+	if err == nil {
+		tt.Fatal("want error loading a profile that is not set up, got nil")
+	}
+
+	defaultCfg, err := NewMediaDbConfig("profile", "region", "bucket")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = defaultCfg.Save()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	backupCfg, err := NewLocalMediaDbConfig("/some/dir")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = backupCfg.SaveProfile("backup")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	for profile, want := range map[string]*MediaDbConfig{DefaultProfileName(): defaultCfg, "backup": backupCfg} {
+		got, err := LoadProfileMediaDbConfig(profile)
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			tt.Fatalf("for profile %q, want %v, got %v", profile, want, got)
+		}
+	}
+}
+
+func TestMediaDbConfigEncryption(tt *testing.T) {
+	cfg := &MediaDbConfig{}
+	if cfg.IsEncrypted() {
+		tt.Fatal("want a new configuration not to be encrypted")
+	}
+
+	secret, err := cfg.EncryptionSecret()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if secret != nil {
+		tt.Fatalf("want no secret, got %q", secret)
+	}
+
+	err = cfg.SetEncryption("some/key", "SOME_PASSPHRASE")
+	if err == nil {
+		tt.Fatal("want error setting both a key file and a passphrase, got nil")
+	}
+
+	keyFile := path.Join(tt.TempDir(), "key")
+	err = os.WriteFile(keyFile, []byte("a secret\n"), 0600)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = cfg.SetEncryption(keyFile, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !cfg.IsEncrypted() {
+		tt.Fatal("want the configuration to be encrypted")
+	}
+
+	salt, err := cfg.GetKeySalt()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(salt) != 16 {
+		tt.Fatalf("want a 16 byte salt, got %v", salt)
+	}
+
+	secret, err = cfg.EncryptionSecret()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := "a secret"; want != string(secret) {
+		tt.Fatalf("want %q, got %q", want, secret)
+	}
+
+	envVar := "MEDIA_DB_TEST_PASSPHRASE"
+	err = cfg.SetEncryption("", envVar)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if cfg.KeyFile != "" {
+		tt.Fatalf("want no key file, got %q", cfg.KeyFile)
+	}
+
+	_, err = cfg.EncryptionSecret()
+	if err == nil {
+		tt.Fatalf("want error with %s unset, got nil", envVar)
+	}
+
+	err = os.Setenv(envVar, "a passphrase")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err := os.Unsetenv(envVar)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	secret, err = cfg.EncryptionSecret()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := "a passphrase"; want != string(secret) {
+		tt.Fatalf("want %q, got %q", want, secret)
+	}
+
+	err = cfg.SetEncryption("", "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if cfg.IsEncrypted() || cfg.KeySalt != "" {
+		tt.Fatalf("want encryption turned off, got %+v", cfg)
+	}
+}
+
+func TestMediaDbConfigGetTimeout(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		timeout string
+		want    time.Duration
+		isError bool
+	}{
+		{"default", "", 0, false},
+		{"seconds", "30s", 30 * time.Second, false},
+		{"minutes", "2m", 2 * time.Minute, false},
+		{"negative", "-1s", 0, true},
+		{"no-unit", "30", 0, true},
+		{"invalid", "soon", 0, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			cfg := &MediaDbConfig{Timeout: test.timeout}
+			got, err := cfg.GetTimeout()
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if test.want != got {
+				subtt.Fatalf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@ module github.com/alexpcook/media-db
 go 1.16
 
 require (
+	github.com/aws/aws-sdk-go-v2 v1.2.1
 	github.com/aws/aws-sdk-go-v2/config v1.1.2
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.2.1
+	github.com/aws/smithy-go v1.2.0
 	github.com/google/uuid v1.2.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 )
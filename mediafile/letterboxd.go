@@ -0,0 +1,113 @@
+package mediafile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// LetterboxdFormat returns the name of the Letterboxd CSV format. Files
+// exported from a Letterboxd diary can be read, and files written in
+// this format can be imported into Letterboxd. It only contains movies.
+func LetterboxdFormat() string {
+	return "letterboxd"
+}
+
+// UnknownDirector returns the director given to a movie that is read from
+// a file without one, since every movie in the database needs a director.
+func UnknownDirector() string {
+	return "unknown"
+}
+
+// getLetterboxdColumns returns the header of a Letterboxd file that is
+// written, using the column names of the Letterboxd import format.
+func getLetterboxdColumns() []string {
+	return []string{"Title", "Year", "Directors", "WatchedDate", "Rating", "Rewatch"}
+}
+
+// getLetterboxdField returns the field for a column of a Letterboxd file.
+// Both the column names of the diary export and of the import format are
+// accepted. The watched date falls back to the date the entry was logged.
+// Other columns, such as the Letterboxd URI and tags, are ignored.
+func getLetterboxdField(column string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(column, " ", "")) {
+	case "name", "title":
+		return "title", nil
+	case "year":
+		return "year", nil
+	case "directors", "director":
+		return "director", nil
+	case "watcheddate":
+		return "date", nil
+	case "date":
+		return "logged", nil
+	case "rating":
+		return "rating", nil
+	case "rewatch":
+		return "rewatch", nil
+	default:
+		return "", nil
+	}
+}
+
+// readLetterboxd parses a Letterboxd CSV file. A movie without a director
+// is given UnknownDirector, with a warning so that it can be corrected.
+func readLetterboxd(r io.Reader) ([]Row, error) {
+	return readCSVRows(r, getLetterboxdField, func(line int, fields map[string]string) Row {
+		if strings.TrimSpace(fields["date"]) == "" {
+			fields["date"] = fields["logged"]
+		}
+		delete(fields, "logged")
+
+		warning := ""
+		if strings.TrimSpace(fields["director"]) == "" {
+			fields["director"] = UnknownDirector()
+			warning = fmt.Sprintf("%q (%s) has no director, so it is imported with director %q", strings.TrimSpace(fields["title"]), strings.TrimSpace(fields["year"]), UnknownDirector())
+		}
+
+		row := newRow(line, fields, schema.Movie{})
+		if row.Err == nil {
+			row.Warning = warning
+		}
+		return row
+	})
+}
+
+// letterboxdFileWriter writes a CSV file in the Letterboxd import format.
+type letterboxdFileWriter struct {
+	csvWriter *csv.Writer
+}
+
+func (lw *letterboxdFileWriter) Write(media schema.Media) error {
+	movie, ok := media.(schema.Movie)
+	if !ok {
+		return fmt.Errorf("a Letterboxd file only contains movies, got %T", media)
+	}
+
+	director := movie.Director
+	if director == UnknownDirector() {
+		director = ""
+	}
+
+	date := ""
+	if movie.DateWatched != 0 {
+		date = time.Unix(movie.DateWatched, 0).UTC().Format(getDateLayout())
+	}
+
+	rating := ""
+	if movie.Rating != 0 {
+		rating = strconv.FormatFloat(movie.Rating, 'f', -1, 64)
+	}
+
+	return lw.csvWriter.Write([]string{movie.Title, strconv.Itoa(movie.YearMade), director, date, rating, strconv.FormatBool(movie.Rewatch)})
+}
+
+func (lw *letterboxdFileWriter) Close() error {
+	lw.csvWriter.Flush()
+	return lw.csvWriter.Error()
+}
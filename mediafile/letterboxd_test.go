@@ -0,0 +1,118 @@
+package mediafile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestReadLetterboxd(tt *testing.T) {
+	diary := `Date,Name,Year,Letterboxd URI,Rating,Rewatch,Tags,Watched Date
+2021-06-02,Alien,1979,https://boxd.it/abc,4.5,Yes,,2021-06-01
+2021-06-03,"Crouching Tiger, Hidden Dragon",2000,https://boxd.it/def,,,,
+2021-06-04,,2001,https://boxd.it/ghi,3,,,2021-06-04
+2021-06-05,Heat,1995,https://boxd.it/jkl,11,,,2021-06-05
+`
+
+	rows, err := Read(strings.NewReader(diary), LetterboxdFormat(), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(rows) != 4 {
+		tt.Fatalf("want 4 rows, got %d", len(rows))
+	}
+
+	alien, ok := rows[0].Media.(schema.Movie)
+	if !ok {
+		tt.Fatalf("want a movie, got %v (row error: %v)", rows[0].Media, rows[0].Err)
+	}
+	if alien.Title != "Alien" || alien.YearMade != 1979 || alien.Rating != 4.5 || !alien.Rewatch {
+		tt.Fatalf("want Alien (1979) rated 4.5 and rewatched, got %v", alien)
+	}
+	if want := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Unix(); alien.DateWatched != want {
+		tt.Fatalf("want the watched date %d, got %d", want, alien.DateWatched)
+	}
+	if alien.Director != UnknownDirector() || rows[0].Warning == "" {
+		tt.Fatalf("want director %q with a warning, got %q with warning %q", UnknownDirector(), alien.Director, rows[0].Warning)
+	}
+
+	// Without a watched date, the date the entry was logged is used.
+	crouchingTiger, ok := rows[1].Media.(schema.Movie)
+	if !ok {
+		tt.Fatalf("want a movie, got %v (row error: %v)", rows[1].Media, rows[1].Err)
+	}
+	if want := time.Date(2021, 6, 3, 0, 0, 0, 0, time.UTC).Unix(); crouchingTiger.DateWatched != want {
+		tt.Fatalf("want the logged date %d, got %d", want, crouchingTiger.DateWatched)
+	}
+	if crouchingTiger.Rating != 0 || crouchingTiger.Rewatch {
+		tt.Fatalf("want unrated and not rewatched, got %v", crouchingTiger)
+	}
+
+	for i, line := range []int{4, 5} {
+		if row := rows[i+2]; row.Err == nil || row.Line != line {
+			tt.Fatalf("want an error on line %d, got %v on line %d", line, row.Err, row.Line)
+		}
+	}
+
+	_, err = Read(strings.NewReader(diary), LetterboxdFormat(), schema.Music{})
+	if err == nil {
+		tt.Fatal("want error reading music from a Letterboxd file, got nil")
+	}
+}
+
+func TestLetterboxdWriter(tt *testing.T) {
+	buf := new(bytes.Buffer)
+
+	writer, err := NewWriter(buf, LetterboxdFormat())
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movies := []schema.Movie{
+		{ID: "123", Title: "Alien", Director: UnknownDirector(), YearMade: 1979, DateWatched: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Unix(), Rating: 4.5, Rewatch: true},
+		{ID: "456", Title: "Heat", Director: "Michael Mann", YearMade: 1995},
+	}
+	for _, movie := range movies {
+		err = writer.Write(movie)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	err = writer.Write(schema.Music{ID: "789", Title: "Low", Artist: "David Bowie", YearMade: 1977})
+	if err == nil {
+		tt.Fatal("want error writing music to a Letterboxd file, got nil")
+	}
+
+	err = writer.Close()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	want := `Title,Year,Directors,WatchedDate,Rating,Rewatch
+Alien,1979,,2021-06-01,4.5,true
+Heat,1995,Michael Mann,,,false
+`
+	if got := buf.String(); want != got {
+		tt.Fatalf("want %q, got %q", want, got)
+	}
+
+	// The file can be read again.
+	rows, err := Read(bytes.NewReader(buf.Bytes()), LetterboxdFormat(), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	for i, row := range rows {
+		movie, ok := row.Media.(schema.Movie)
+		if !ok {
+			tt.Fatalf("want a movie, got %v (row error: %v)", row.Media, row.Err)
+		}
+		movie.ID = movies[i].ID
+		if movie != movies[i] {
+			tt.Fatalf("want %v, got %v", movies[i], movie)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package mediafile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// LastfmFormat returns the name of the Last.fm scrobble CSV format.
+func LastfmFormat() string {
+	return "lastfm"
+}
+
+// SpotifyFormat returns the name of the Spotify extended streaming
+// history JSON format.
+func SpotifyFormat() string {
+	return "spotify"
+}
+
+// GetDefaultMinPlayDuration returns the shortest play of a track that is
+// counted as a listen by default. It is the same threshold that Spotify
+// uses to count a stream.
+func GetDefaultMinPlayDuration() time.Duration {
+	return 30 * time.Second
+}
+
+// Play is a single play of a track read from a listening history. File
+// and Line give where the play was read from. Duration is zero if the
+// history does not record how long the track was played for. If the play
+// is not valid, Err describes the problem.
+type Play struct {
+	File     string
+	Line     int
+	Title    string
+	Artist   string
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// MatchKey returns a key that is the same for two entries with the same
+// title and artist, ignoring differences in case and surrounding space.
+func MatchKey(title, artist string) string {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), " "))
+	}
+
+	return normalize(artist) + "\x00" + normalize(title)
+}
+
+// AggregatePlays combines the plays of each track into a single Music
+// entry. The date listened of an entry is the day of its first play, and
+// the last listen is the day of its last play. Plays shorter than
+// minDuration are not counted, but plays without a recorded duration
+// always are. Listening histories do not record the year a track was
+// made, so the year of every entry is unknown, with a warning so that it
+// can be set. Invalid plays are returned as rows with a non-nil Err.
+// The entries are ordered by their first play.
+func AggregatePlays(plays []Play, minDuration time.Duration) []Row {
+	rows := make([]Row, 0)
+	firstPlays := make(map[string]*Play)
+	lastPlays := make(map[string]*Play)
+	numPlays := make(map[string]int)
+
+	for i := range plays {
+		play := &plays[i]
+
+		if play.Err != nil {
+			rows = append(rows, Row{File: play.File, Line: play.Line, Err: play.Err})
+			continue
+		}
+		if play.Duration != 0 && play.Duration < minDuration {
+			continue
+		}
+
+		key := MatchKey(play.Title, play.Artist)
+		if first, ok := firstPlays[key]; !ok || play.Time.Before(first.Time) {
+			firstPlays[key] = play
+		}
+		if last, ok := lastPlays[key]; !ok || play.Time.After(last.Time) {
+			lastPlays[key] = play
+		}
+		numPlays[key]++
+	}
+
+	keys := make([]string, 0, len(firstPlays))
+	for key := range firstPlays {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if ti, tj := firstPlays[keys[i]].Time, firstPlays[keys[j]].Time; !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return keys[i] < keys[j]
+	})
+
+	formatDate := func(t time.Time) string {
+		return t.UTC().Format(getDateLayout())
+	}
+
+	for _, key := range keys {
+		first, last := firstPlays[key], lastPlays[key]
+
+		row := Row{File: first.File, Line: first.Line}
+		music, err := schema.NewMusicWithUnknownYear(first.Title, first.Artist, formatDate(first.Time))
+		if err != nil {
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+
+		music.LastListened, err = schema.StringToUnixTime(formatDate(last.Time))
+		if err != nil {
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+		music.Plays = numPlays[key]
+
+		row.Media = *music
+		row.Warning = fmt.Sprintf("%q by %s has no year, because listening histories do not record it", music.Title, music.Artist)
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// getLastfmTimeLayouts returns the layouts of the scrobble times in the
+// Last.fm exports made by common export tools.
+func getLastfmTimeLayouts() []string {
+	return []string{"2 Jan 2006 15:04", "2 Jan 2006, 15:04", "2006-01-02 15:04:05", time.RFC3339}
+}
+
+// parseLastfmTime parses the time of a scrobble, either as a Unix timestamp
+// or in one of the layouts returned by getLastfmTimeLayouts, in UTC.
+func parseLastfmTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if unixTime, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unixTime, 0).UTC(), nil
+	}
+
+	for _, layout := range getLastfmTimeLayouts() {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a valid scrobble time", s)
+}
+
+// ReadLastfm parses the plays in a Last.fm scrobble export, which is a CSV
+// file read from file. A file with a header row must have artist and track
+// columns, and a uts, utc_time, or date column for the time of the scrobble.
+// A file without a header row must have the columns artist, album, track,
+// and date in that order. Last.fm only records plays long enough to be
+// scrobbled, so the plays have no duration.
+func ReadLastfm(r io.Reader, file string) ([]Play, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []Play{}, nil
+	}
+
+	columns := map[string]int{"artist": 0, "track": 2, "date": 3}
+	line := 1
+
+	header := make(map[string]int)
+	for i, column := range records[0] {
+		header[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	_, hasArtist := header["artist"]
+	_, hasTrack := header["track"]
+	if hasArtist && hasTrack {
+		columns = map[string]int{"artist": header["artist"], "track": header["track"]}
+		for _, timeColumn := range []string{"uts", "utc_time", "date"} {
+			if i, ok := header[timeColumn]; ok {
+				columns["date"] = i
+				break
+			}
+		}
+		if _, ok := columns["date"]; !ok {
+			return nil, errors.New("line 1: a Last.fm file must have a uts, utc_time, or date column")
+		}
+
+		records = records[1:]
+		line++
+	}
+
+	plays := make([]Play, 0, len(records))
+
+	for _, record := range records {
+		play := Play{File: file, Line: line}
+
+		// Quoted values can span several lines.
+		line++
+		for _, value := range record {
+			line += strings.Count(value, "\n")
+		}
+
+		for _, i := range columns {
+			if i >= len(record) {
+				play.Err = fmt.Errorf("want at least %d values, got %d", i+1, len(record))
+				break
+			}
+		}
+		if play.Err == nil {
+			play.Artist = record[columns["artist"]]
+			play.Title = record[columns["track"]]
+			play.Time, play.Err = parseLastfmTime(record[columns["date"]])
+		}
+
+		plays = append(plays, play)
+	}
+
+	return plays, nil
+}
+
+// spotifyStream is a single stream in a Spotify extended streaming history.
+// The track name and artist are null for streams of podcasts and audiobooks.
+type spotifyStream struct {
+	Time       string  `json:"ts"`
+	MsPlayed   int64   `json:"ms_played"`
+	TrackName  *string `json:"master_metadata_track_name"`
+	ArtistName *string `json:"master_metadata_album_artist_name"`
+}
+
+// ReadSpotify parses the plays of tracks in a Spotify extended streaming
+// history, which is a JSON file read from file. Streams that are not of
+// music tracks, such as podcast episodes, are skipped.
+func ReadSpotify(r io.Reader, file string) ([]Play, error) {
+	plays := make([]Play, 0)
+
+	err := readJSONArray(r, func(line int, decoder *json.Decoder) error {
+		stream := spotifyStream{}
+		err := decoder.Decode(&stream)
+		if err != nil {
+			return err
+		}
+
+		if stream.TrackName == nil || stream.ArtistName == nil {
+			return nil
+		}
+
+		play := Play{
+			File:     file,
+			Line:     line,
+			Title:    *stream.TrackName,
+			Artist:   *stream.ArtistName,
+			Duration: time.Duration(stream.MsPlayed) * time.Millisecond,
+		}
+		play.Time, play.Err = time.Parse(time.RFC3339, stream.Time)
+		plays = append(plays, play)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plays, nil
+}
@@ -0,0 +1,161 @@
+package mediafile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestReadLastfm(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		want    []Play
+		isError bool
+	}{
+		{"header", `uts,utc_time,artist,artist_mbid,album,album_mbid,track,track_mbid
+1612118280,"31 Jan 2021, 18:38",David Bowie,,Low,,Warszawa,
+not-a-time,,David Bowie,,Low,,Subterraneans,
+`, []Play{
+			{Line: 2, Title: "Warszawa", Artist: "David Bowie", Time: time.Date(2021, 1, 31, 18, 38, 0, 0, time.UTC)},
+			{Line: 3, Title: "Subterraneans", Artist: "David Bowie"},
+		}, false},
+		{"no-header", `David Bowie,Low,Warszawa,31 Jan 2021 18:38
+Brian Eno,Another Green World,St. Elmo's Fire,01 Feb 2021 09:05
+Brian Eno,Another Green World
+`, []Play{
+			{Line: 1, Title: "Warszawa", Artist: "David Bowie", Time: time.Date(2021, 1, 31, 18, 38, 0, 0, time.UTC)},
+			{Line: 2, Title: "St. Elmo's Fire", Artist: "Brian Eno", Time: time.Date(2021, 2, 1, 9, 5, 0, 0, time.UTC)},
+			{Line: 3},
+		}, false},
+		{"header-without-time", `artist,album,track
+David Bowie,Low,Warszawa
+`, nil, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			plays, err := ReadLastfm(strings.NewReader(test.input), "scrobbles.csv")
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if len(plays) != len(test.want) {
+				subtt.Fatalf("want %d plays, got %d", len(test.want), len(plays))
+			}
+			for i, play := range plays {
+				if play.File != "scrobbles.csv" || play.Line != test.want[i].Line {
+					subtt.Fatalf("want play from scrobbles.csv:%d, got %s:%d", test.want[i].Line, play.File, play.Line)
+				}
+
+				// A play with no time in the test case is invalid.
+				if test.want[i].Time.IsZero() {
+					if play.Err == nil {
+						subtt.Fatalf("want error for line %d, got nil", play.Line)
+					}
+					continue
+				}
+
+				if play.Err != nil || play.Title != test.want[i].Title || play.Artist != test.want[i].Artist || !play.Time.Equal(test.want[i].Time) {
+					subtt.Fatalf("want %+v, got %+v", test.want[i], play)
+				}
+			}
+		})
+	}
+}
+
+func TestReadSpotify(tt *testing.T) {
+	input := `[
+  {"ts": "2021-01-31T18:38:00Z", "ms_played": 192000, "master_metadata_track_name": "Warszawa", "master_metadata_album_artist_name": "David Bowie"},
+  {"ts": "2021-02-01T09:00:00Z", "ms_played": 1800000, "master_metadata_track_name": null, "master_metadata_album_artist_name": null, "episode_name": "A Podcast"},
+  {"ts": "not-a-time", "ms_played": 1000, "master_metadata_track_name": "Subterraneans", "master_metadata_album_artist_name": "David Bowie"}
+]`
+
+	plays, err := ReadSpotify(strings.NewReader(input), "history.json")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(plays) != 2 {
+		tt.Fatalf("want 2 plays, got %d", len(plays))
+	}
+
+	want := Play{File: "history.json", Line: 2, Title: "Warszawa", Artist: "David Bowie", Time: time.Date(2021, 1, 31, 18, 38, 0, 0, time.UTC), Duration: 192 * time.Second}
+	if plays[0] != want {
+		tt.Fatalf("want %+v, got %+v", want, plays[0])
+	}
+
+	if plays[1].Line != 4 || plays[1].Err == nil {
+		tt.Fatalf("want error on line 4, got %v on line %d", plays[1].Err, plays[1].Line)
+	}
+
+	_, err = ReadSpotify(strings.NewReader(`{"ts": "2021-01-31T18:38:00Z"}`), "history.json")
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
+
+func TestAggregatePlays(tt *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 1, d, 12, 0, 0, 0, time.UTC)
+	}
+
+	plays := []Play{
+		{Line: 1, Title: "Warszawa", Artist: "David Bowie", Time: day(3), Duration: time.Minute},
+		{Line: 2, Title: "St. Elmo's Fire", Artist: "Brian Eno", Time: day(2)},
+		{Line: 3, Title: "warszawa ", Artist: "david  bowie", Time: day(1), Duration: time.Minute},
+		{Line: 4, Title: "Warszawa", Artist: "David Bowie", Time: day(9), Duration: 10 * time.Second},
+		{Line: 5, Title: "Warszawa", Artist: "David Bowie", Time: day(5), Duration: time.Minute},
+		{Line: 6, Title: "Skipped", Artist: "Brian Eno", Time: day(4), Duration: time.Second},
+		{Line: 7, Err: errors.New("an invalid play")},
+	}
+
+	rows := AggregatePlays(plays, 30*time.Second)
+	if len(rows) != 3 {
+		tt.Fatalf("want 3 rows, got %d", len(rows))
+	}
+
+	if rows[0].Line != 7 || rows[0].Err == nil {
+		tt.Fatalf("want the invalid play first, got %+v", rows[0])
+	}
+
+	warszawa, ok := rows[1].Media.(schema.Music)
+	if !ok || rows[1].Line != 3 {
+		tt.Fatalf("want music from line 3, got %+v", rows[1])
+	}
+	if warszawa.Title != "warszawa" || warszawa.Artist != "david  bowie" || warszawa.YearMade != 0 || warszawa.Plays != 3 {
+		tt.Fatalf("want 3 plays of the first spelling of warszawa, got %v", warszawa)
+	}
+	if rows[1].Warning == "" {
+		tt.Fatal("want a warning that the year is not known, got none")
+	}
+	if first := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Unix(); warszawa.DateListened != first {
+		tt.Fatalf("want first listen %d, got %d", first, warszawa.DateListened)
+	}
+	if last := time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC).Unix(); warszawa.LastListened != last {
+		tt.Fatalf("want last listen %d, got %d", last, warszawa.LastListened)
+	}
+
+	stElmosFire, ok := rows[2].Media.(schema.Music)
+	if !ok || stElmosFire.Title != "St. Elmo's Fire" || stElmosFire.Plays != 1 {
+		tt.Fatalf("want 1 play of St. Elmo's Fire, got %+v", rows[2])
+	}
+}
+
+func TestMatchKey(tt *testing.T) {
+	if MatchKey(" Warszawa", "David  Bowie") != MatchKey("warszawa", "david bowie") {
+		tt.Fatal("want keys that differ only in case and space to match")
+	}
+
+	if MatchKey("ab", "c") == MatchKey("a", "bc") {
+		tt.Fatal("want keys for different titles and artists to differ")
+	}
+}
@@ -0,0 +1,491 @@
+// Package mediafile reads and writes media entries in the file formats
+// used to move data in and out of the database, such as CSV and JSON.
+package mediafile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// CSVFormat returns the name of the comma-separated values format. The
+// first row is a header that names the field in each column.
+func CSVFormat() string {
+	return "csv"
+}
+
+// JSONFormat returns the name of the JSON format, an array of objects.
+func JSONFormat() string {
+	return "json"
+}
+
+// NDJSONFormat returns the name of the newline-delimited JSON format,
+// with one object per line.
+func NDJSONFormat() string {
+	return "ndjson"
+}
+
+// GetFormats returns a slice of all the supported file formats.
+func GetFormats() []string {
+	return []string{CSVFormat(), JSONFormat(), NDJSONFormat()}
+}
+
+// TypeField returns the name of the field that holds the media
+// type of an entry, such as movie or music.
+func TypeField() string {
+	return "type"
+}
+
+// getFields returns the names of the fields that a file can contain,
+// besides the type. The id field is accepted so that exported files
+// can be imported again, but a new id is always generated.
+func getFields() []string {
+	return []string{"id", "title", "director", "artist", "year", "date", "rating", "rewatch", "last", "plays"}
+}
+
+// Row is a single entry read from a file. Line is the line of the file
+// that the entry starts on. File is the name of the file, if it is known,
+// and is the empty string "" otherwise. If the entry is not valid, Media
+// is nil and Err describes the problem. Warning describes anything about
+// a valid entry that should be checked, and is the empty string ""
+// otherwise.
+type Row struct {
+	File    string
+	Line    int
+	Media   schema.Media
+	Err     error
+	Warning string
+}
+
+// Read parses the media entries in r, which is in the given format. If
+// mediaType is not nil, every entry is of that type, otherwise each entry
+// must give its type in the type field. The entries of a Letterboxd file
+// are always movies. Each entry is validated the same way as an entry
+// created on the command line. Invalid entries are returned as rows with
+// a non-nil Err, so that the valid entries can still be used. Read
+// returns a non-nil error if r cannot be parsed in the format at all.
+func Read(r io.Reader, format string, mediaType schema.Media) ([]Row, error) {
+	switch format {
+	case CSVFormat():
+		return readCSV(r, mediaType)
+	case JSONFormat():
+		return readJSON(r, mediaType)
+	case NDJSONFormat():
+		return readNDJSON(r, mediaType)
+	case LetterboxdFormat():
+		if mediaType != nil && schema.GetMediaTypeName(mediaType) != schema.GetMediaTypeName(schema.Movie{}) {
+			return nil, errors.New("a Letterboxd file only contains movies")
+		}
+		return readLetterboxd(r)
+	default:
+		return nil, fmt.Errorf("%q is not a supported format, want one of %s", format, strings.Join(GetFormats(), ", "))
+	}
+}
+
+// newRow validates the fields of an entry that starts on the given line.
+func newRow(line int, fields map[string]string, mediaType schema.Media) Row {
+	media, err := newMedia(fields, mediaType)
+	if err != nil {
+		return Row{Line: line, Err: err}
+	}
+
+	return Row{Line: line, Media: media}
+}
+
+// checkField returns a non-nil error if field is not the name
+// of a field that a file can contain.
+func checkField(field string) error {
+	if field == TypeField() {
+		return nil
+	}
+
+	for _, validField := range getFields() {
+		if field == validField {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%q is not a valid field, want one of %s, %s", field, TypeField(), strings.Join(getFields(), ", "))
+}
+
+// newMedia validates the fields of an entry and returns it as the media
+// type given by mediaType, or by its type field if mediaType is nil.
+func newMedia(fields map[string]string, mediaType schema.Media) (schema.Media, error) {
+	for field := range fields {
+		if err := checkField(field); err != nil {
+			return nil, err
+		}
+	}
+
+	if mediaType == nil {
+		var err error
+		mediaType, err = schema.GetMediaTypeFromName(strings.TrimSpace(fields[TypeField()]))
+		if err != nil {
+			return nil, err
+		}
+	} else if typeName, ok := fields[TypeField()]; ok && strings.TrimSpace(typeName) != schema.GetMediaTypeName(mediaType) {
+		return nil, fmt.Errorf("type must be %s, got %q", schema.GetMediaTypeName(mediaType), typeName)
+	}
+
+	// Music whose year is not known is written without one.
+	_, isMusic := mediaType.(schema.Music)
+	isYearUnknown := isMusic && strings.TrimSpace(fields["year"]) == ""
+
+	year := 0
+	if !isYearUnknown {
+		var err error
+		year, err = strconv.Atoi(strings.TrimSpace(fields["year"]))
+		if err != nil {
+			return nil, fmt.Errorf("year must be a whole number, got %q", fields["year"])
+		}
+	}
+
+	switch mediaType.(type) {
+	case schema.Movie:
+		if fields["artist"] != "" {
+			return nil, errors.New("a movie does not have an artist")
+		}
+		if fields["last"] != "" || fields["plays"] != "" {
+			return nil, errors.New("a movie does not have a last listen or plays")
+		}
+
+		rating, err := parseRating(fields["rating"])
+		if err != nil {
+			return nil, err
+		}
+
+		rewatch, err := parseRewatch(fields["rewatch"])
+		if err != nil {
+			return nil, err
+		}
+
+		movie, err := schema.NewMovie(fields["title"], fields["director"], year, fields["date"])
+		if err != nil {
+			return nil, err
+		}
+		movie.Rating = rating
+		movie.Rewatch = rewatch
+		return *movie, nil
+	case schema.Music:
+		if fields["director"] != "" {
+			return nil, errors.New("music does not have a director")
+		}
+		if fields["rating"] != "" || fields["rewatch"] != "" {
+			return nil, errors.New("music does not have a rating or rewatch")
+		}
+
+		lastListened, err := schema.StringToUnixTime(strings.TrimSpace(fields["last"]))
+		if err != nil {
+			return nil, err
+		}
+
+		plays := 0
+		if s := strings.TrimSpace(fields["plays"]); s != "" {
+			plays, err = strconv.Atoi(s)
+			if err != nil || plays < 0 {
+				return nil, fmt.Errorf("plays must be a whole number, got %q", s)
+			}
+		}
+
+		var music *schema.Music
+		if isYearUnknown {
+			music, err = schema.NewMusicWithUnknownYear(fields["title"], fields["artist"], fields["date"])
+		} else {
+			music, err = schema.NewMusic(fields["title"], fields["artist"], year, fields["date"])
+		}
+		if err != nil {
+			return nil, err
+		}
+		music.LastListened = lastListened
+		music.Plays = plays
+		return *music, nil
+	}
+
+	return nil, fmt.Errorf("%T is not a valid media type", mediaType)
+}
+
+// parseRating parses a movie rating, which is zero if it is left empty.
+func parseRating(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	rating, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("rating must be a number, got %q", s)
+	}
+
+	return rating, schema.ValidateRating(rating)
+}
+
+// parseRewatch parses whether a movie was a rewatch. Besides the values
+// accepted by strconv.ParseBool, it accepts yes and no, and it is false
+// if it is left empty.
+func parseRewatch(s string) (bool, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "":
+		return false, nil
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+
+	rewatch, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("rewatch must be true or false, got %q", s)
+	}
+
+	return rewatch, nil
+}
+
+// readCSV parses a CSV file with a header row.
+func readCSV(r io.Reader, mediaType schema.Media) ([]Row, error) {
+	getField := func(column string) (string, error) {
+		field := strings.ToLower(column)
+		return field, checkField(field)
+	}
+
+	return readCSVRows(r, getField, func(line int, fields map[string]string) Row {
+		return newRow(line, fields, mediaType)
+	})
+}
+
+// csvRecordReader reads the records of a CSV file along with the line that
+// each record starts on. A csv.Reader skips blank lines and does not say
+// where a record starts, so the lines of each record are read here, and
+// only the record itself is parsed by a csv.Reader.
+type csvRecordReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// read returns the next record and the line that it starts on. It returns
+// io.EOF when there are no more records.
+func (cr *csvRecordReader) read() ([]string, int, error) {
+	var text strings.Builder
+	start, numQuotes := 0, 0
+
+	for {
+		s, err := cr.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		if s != "" {
+			cr.line++
+		}
+
+		if text.Len() == 0 && strings.TrimRight(s, "\r\n") == "" {
+			if err == io.EOF {
+				return nil, 0, io.EOF
+			}
+			continue
+		}
+		if text.Len() == 0 {
+			start = cr.line
+		}
+		text.WriteString(s)
+
+		// A quoted value can span several lines, and is only
+		// finished once there is an even number of quotes.
+		numQuotes += strings.Count(s, `"`)
+		if err == io.EOF || numQuotes%2 == 0 {
+			break
+		}
+	}
+
+	csvReader := csv.NewReader(strings.NewReader(text.String()))
+	csvReader.FieldsPerRecord = -1
+
+	record, err := csvReader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, start, fmt.Errorf("line %d: %w", start+parseErr.Line-1, parseErr.Err)
+	} else if err != nil {
+		return nil, start, fmt.Errorf("line %d: %w", start, err)
+	}
+
+	return record, start, nil
+}
+
+// readCSVRows parses a CSV file with a header row. The getField function
+// returns the field for the name of each column in the header, or the
+// empty string "" if the column is ignored. The newRow function converts
+// the fields of each row that starts on the given line to a Row.
+func readCSVRows(r io.Reader, getField func(column string) (string, error), newRow func(line int, fields map[string]string) Row) ([]Row, error) {
+	csvReader := &csvRecordReader{r: bufio.NewReader(r)}
+
+	header, line, err := csvReader.read()
+	if err == io.EOF {
+		return []Row{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i], err = getField(strings.TrimSpace(header[i]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	rows := make([]Row, 0)
+
+	for {
+		record, line, err := csvReader.read()
+		if err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		// The number of values in each row is checked here, so that a
+		// malformed row is reported without rejecting the whole file.
+		if len(record) != len(header) {
+			rows = append(rows, Row{Line: line, Err: fmt.Errorf("want %d values, got %d", len(header), len(record))})
+			continue
+		}
+
+		fields := make(map[string]string, len(record))
+		for i, value := range record {
+			if header[i] != "" {
+				fields[header[i]] = value
+			}
+		}
+		rows = append(rows, newRow(line, fields))
+	}
+}
+
+// jsonFields converts the values of a JSON object to strings, so that
+// a year can be given either as a number or as a string.
+func jsonFields(obj map[string]interface{}) (map[string]string, error) {
+	fields := make(map[string]string, len(obj))
+
+	for field, value := range obj {
+		switch value := value.(type) {
+		case string:
+			fields[field] = value
+		case float64:
+			fields[field] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			fields[field] = strconv.FormatBool(value)
+		case nil:
+		default:
+			return nil, fmt.Errorf("%s must be a string or a number, got %v", field, value)
+		}
+	}
+
+	return fields, nil
+}
+
+// readJSON parses a JSON array of objects.
+func readJSON(r io.Reader, mediaType schema.Media) ([]Row, error) {
+	rows := make([]Row, 0)
+
+	err := readJSONArray(r, func(line int, decoder *json.Decoder) error {
+		obj := make(map[string]interface{})
+		err := decoder.Decode(&obj)
+		if err != nil {
+			return err
+		}
+
+		fields, err := jsonFields(obj)
+		if err != nil {
+			rows = append(rows, Row{Line: line, Err: err})
+			return nil
+		}
+		rows = append(rows, newRow(line, fields, mediaType))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// readJSONArray parses a JSON array, calling decodeValue to decode each
+// value in the array from decoder along with the line that it starts on.
+func readJSONArray(r io.Reader, decodeValue func(line int, decoder *json.Decoder) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// lineAt returns the line of the next value at or after offset,
+	// skipping any whitespace and the comma between values.
+	lineAt := func(offset int64) int {
+		start := int(offset) + len(data[offset:]) - len(bytes.TrimLeft(data[offset:], " \t\r\n,"))
+		return bytes.Count(data[:start], []byte("\n")) + 1
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("a JSON file must contain an array of entries")
+	}
+
+	for decoder.More() {
+		line := lineAt(decoder.InputOffset())
+
+		err = decodeValue(line, decoder)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	_, err = decoder.Token()
+	return err
+}
+
+// getMaxNDJSONLineSize returns the size in bytes of the longest
+// line of a newline-delimited JSON file that can be read.
+func getMaxNDJSONLineSize() int {
+	return 1024 * 1024
+}
+
+// readNDJSON parses one JSON object per line. Blank lines are skipped.
+func readNDJSON(r io.Reader, mediaType schema.Media) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, getMaxNDJSONLineSize())
+	rows := make([]Row, 0)
+
+	line := 1
+	for ; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		obj := make(map[string]interface{})
+		err := json.Unmarshal([]byte(text), &obj)
+		if err != nil {
+			rows = append(rows, Row{Line: line, Err: err})
+			continue
+		}
+
+		fields, err := jsonFields(obj)
+		if err != nil {
+			rows = append(rows, Row{Line: line, Err: err})
+			continue
+		}
+		rows = append(rows, newRow(line, fields, mediaType))
+	}
+
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return nil, fmt.Errorf("line %d: the line is longer than %d bytes", line, getMaxNDJSONLineSize())
+	}
+	return rows, scanner.Err()
+}
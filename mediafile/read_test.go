@@ -0,0 +1,156 @@
+package mediafile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// rowResult summarizes a Row for comparison, since the
+// ids of the entries are generated when they are read.
+type rowResult struct {
+	line    int
+	title   string
+	isError bool
+}
+
+func getRowResults(rows []Row) []rowResult {
+	results := make([]rowResult, 0, len(rows))
+
+	for _, row := range rows {
+		result := rowResult{line: row.Line, isError: row.Err != nil}
+		switch media := row.Media.(type) {
+		case schema.Movie:
+			result.title = media.Title
+		case schema.Music:
+			result.title = media.Title
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func TestRead(tt *testing.T) {
+	testCases := []struct {
+		name      string
+		format    string
+		mediaType schema.Media
+		input     string
+		want      []rowResult
+		isError   bool
+	}{
+		{"csv", CSVFormat(), nil, `type,title,director,artist,year,date
+movie,A Movie,A Director,,1999,2021-06-01
+music,Some Music,,An Artist,1977,2021-06-02
+`, []rowResult{{2, "A Movie", false}, {3, "Some Music", false}}, false},
+		{"csv-media-type", CSVFormat(), schema.Movie{}, `Title,Director,Year,Date
+A Movie,A Director,1999,2021-06-01
+`, []rowResult{{2, "A Movie", false}}, false},
+		{"csv-invalid-rows", CSVFormat(), schema.Movie{}, `title,director,year,date
+"A Movie
+With Two Lines",A Director,1999,2021-06-01
+No Director,,1999,2021-06-01
+A Movie,A Director,not-a-year,2021-06-01
+A Movie,A Director,1999
+A Movie,A Director,1999,2021-06-01
+`, []rowResult{{2, "A Movie\nWith Two Lines", false}, {4, "", true}, {5, "", true}, {6, "", true}, {7, "A Movie", false}}, false},
+		{"csv-blank-lines", CSVFormat(), schema.Movie{}, `
+title,director,year,date
+
+A Movie,A Director,1999,2021-06-01
+
+"A Movie
+
+With A Blank Line",A Director,1999,2021-06-01
+No Director,,1999,2021-06-01
+`, []rowResult{{4, "A Movie", false}, {6, "A Movie\n\nWith A Blank Line", false}, {9, "", true}}, false},
+		{"csv-crlf", CSVFormat(), schema.Movie{}, "title,director,year,date\r\n\r\nNo Director,,1999,2021-06-01\r\n", []rowResult{{3, "", true}}, false},
+		{"csv-malformed", CSVFormat(), schema.Movie{}, `title,director,year,date
+A "Movie",A Director,1999,2021-06-01
+`, nil, true},
+		{"csv-wrong-type", CSVFormat(), schema.Movie{}, `type,title,director,year
+music,Some Music,A Director,1977
+`, []rowResult{{2, "", true}}, false},
+		{"csv-invalid-field", CSVFormat(), nil, `type,name
+movie,A Movie
+`, nil, true},
+		{"csv-empty", CSVFormat(), nil, ``, []rowResult{}, false},
+		{"json", JSONFormat(), nil, `[
+  {"type": "movie", "title": "A Movie", "director": "A Director", "year": 1999, "date": "2021-06-01"},
+  {
+    "type": "music",
+    "title": "Some Music",
+    "artist": "An Artist",
+    "year": "1977"
+  },
+  {"type": "book", "title": "A Book", "year": 1850}
+]`, []rowResult{{2, "A Movie", false}, {3, "Some Music", false}, {9, "", true}}, false},
+		{"json-not-array", JSONFormat(), nil, `{"type": "movie"}`, nil, true},
+		{"json-malformed", JSONFormat(), nil, `[{"type": "movie"`, nil, true},
+		{"ndjson", NDJSONFormat(), schema.Music{}, `{"title": "Some Music", "artist": "An Artist", "year": 1977}
+
+{"title": "More Music", "artist": "An Artist", "year": 1979, "date": "2021-06-01"}
+{"title": "Bad JSON"
+{"title": "No Artist", "year": 1979}
+{"title": ["A List"], "artist": "An Artist", "year": 1979}
+{"title": "Rated Music", "artist": "An Artist", "year": 1979, "rating": 4}
+`, []rowResult{{1, "Some Music", false}, {3, "More Music", false}, {4, "", true}, {5, "", true}, {6, "", true}, {7, "", true}}, false},
+		{"ndjson-movie-rating", NDJSONFormat(), schema.Movie{}, `{"title": "A Movie", "director": "A Director", "year": 1999, "rating": 3.5, "rewatch": true}
+{"title": "A Movie", "director": "A Director", "year": 1999, "rating": 3.7}
+{"title": "A Movie", "director": "A Director", "year": 1999, "rewatch": "maybe"}
+`, []rowResult{{1, "A Movie", false}, {2, "", true}, {3, "", true}}, false},
+		{"ndjson-long-line", NDJSONFormat(), schema.Music{}, `{"title": "Some Music", "artist": "An Artist", "year": 1977}
+{"title": "` + strings.Repeat("a", 2*1024*1024) + `"}
+`, nil, true},
+		{"invalid-format", "xml", nil, ``, nil, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			rows, err := Read(strings.NewReader(test.input), test.format, test.mediaType)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			got := getRowResults(rows)
+			if len(got) != len(test.want) {
+				subtt.Fatalf("want %v, got %v", test.want, got)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					subtt.Fatalf("want %v, got %v (row error: %v)", test.want[i], got[i], rows[i].Err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadErrorLine(tt *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		input  string
+		want   string
+	}{
+		{"csv-after-blank-line", CSVFormat(), "title,director,year,date\n\n\nA \"Movie\",A Director,1999,2021-06-01\n", "line 4: "},
+		{"csv-header", CSVFormat(), "\ntitle,name\n", "line 2: "},
+		{"ndjson-long-line", NDJSONFormat(), "{}\n\n{\"title\": \"" + strings.Repeat("a", 2*1024*1024) + "\"}\n", "line 3: "},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := Read(strings.NewReader(test.input), test.format, schema.Movie{})
+			if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+				subtt.Fatalf("want error starting with %q, got %v", test.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package mediafile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// getDateLayout returns the ISO 8601 layout of the dates in a file, which
+// is the same yyyy-mm-dd layout that dates are given in on the command line.
+func getDateLayout() string {
+	return "2006-01-02"
+}
+
+// entry is a media entry as it is written to a file. The fields are in
+// the same order as the columns of a CSV file. Year is zero for music
+// whose year is not known, and is left out.
+type entry struct {
+	Type     string  `json:"type"`
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Director string  `json:"director,omitempty"`
+	Artist   string  `json:"artist,omitempty"`
+	Year     int     `json:"year,omitempty"`
+	Date     string  `json:"date"`
+	Rating   float64 `json:"rating,omitempty"`
+	Rewatch  bool    `json:"rewatch,omitempty"`
+	Last     string  `json:"last,omitempty"`
+	Plays    int     `json:"plays,omitempty"`
+}
+
+// GetColumns returns the header of a CSV file, which names every field
+// of an entry in the order that the fields are written.
+func GetColumns() []string {
+	return []string{TypeField(), "id", "title", "director", "artist", "year", "date", "rating", "rewatch", "last", "plays"}
+}
+
+// newEntry converts media to an entry. Dates are written in UTC, which
+// is the time zone that the dates of entries are stored in.
+func newEntry(media schema.Media) (entry, error) {
+	formatDate := func(unixTime int64) string {
+		return time.Unix(unixTime, 0).UTC().Format(getDateLayout())
+	}
+
+	switch media := media.(type) {
+	case schema.Movie:
+		return entry{
+			Type:     schema.GetMediaTypeName(media),
+			ID:       media.ID,
+			Title:    media.Title,
+			Director: media.Director,
+			Year:     media.YearMade,
+			Date:     formatDate(media.DateWatched),
+			Rating:   media.Rating,
+			Rewatch:  media.Rewatch,
+		}, nil
+	case schema.Music:
+		e := entry{
+			Type:   schema.GetMediaTypeName(media),
+			ID:     media.ID,
+			Title:  media.Title,
+			Artist: media.Artist,
+			Year:   media.YearMade,
+			Date:   formatDate(media.DateListened),
+			Plays:  media.Plays,
+		}
+		if media.LastListened != 0 {
+			e.Last = formatDate(media.LastListened)
+		}
+		return e, nil
+	}
+
+	return entry{}, fmt.Errorf("%T is not a valid media type", media)
+}
+
+// Writer writes media entries to a file one at a time, so that the
+// whole library does not have to be held in memory to be written.
+type Writer interface {
+	// Write writes a single media entry.
+	Write(media schema.Media) error
+
+	// Close finishes the file. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// NewWriter returns a Writer that writes entries to w in the given format.
+// Files written in any format can be read again with Read.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case CSVFormat():
+		return NewCSVWriter(w, nil, GetColumns())
+	case JSONFormat():
+		return &jsonFileWriter{w: w}, nil
+	case NDJSONFormat():
+		return &ndjsonFileWriter{encoder: json.NewEncoder(w)}, nil
+	case LetterboxdFormat():
+		csvWriter := csv.NewWriter(w)
+		err := csvWriter.Write(getLetterboxdColumns())
+		if err != nil {
+			return nil, err
+		}
+		return &letterboxdFileWriter{csvWriter: csvWriter}, nil
+	default:
+		return nil, fmt.Errorf("%q is not a supported format, want one of %s", format, strings.Join(GetFormats(), ", "))
+	}
+}
+
+// CSVWriter writes a CSV file with a header row and the chosen columns of
+// each entry. Extra columns whose values are not fields of an entry, such
+// as the group of each entry shown by the read command, can come first.
+type CSVWriter struct {
+	csvWriter *csv.Writer
+	columns   []string
+}
+
+// NewCSVWriter returns a pointer to a CSVWriter that writes the extra
+// columns, then the given columns, to w. The columns are fields of an
+// entry, as returned by GetColumns, and are written in the same way that
+// NewWriter writes every column. It returns a non-nil error if a column is
+// not a field of an entry or the header cannot be written.
+func NewCSVWriter(w io.Writer, extraColumns, columns []string) (*CSVWriter, error) {
+	for _, column := range columns {
+		isColumn := false
+		for _, validColumn := range GetColumns() {
+			isColumn = isColumn || column == validColumn
+		}
+		if !isColumn {
+			return nil, fmt.Errorf("%q is not a field, want one of %s", column, strings.Join(GetColumns(), ", "))
+		}
+	}
+
+	csvWriter := csv.NewWriter(w)
+	err := csvWriter.Write(append(append([]string{}, extraColumns...), columns...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CSVWriter{csvWriter: csvWriter, columns: columns}, nil
+}
+
+// getCSVValues returns the values of the fields of e as they are written
+// to a CSV file, keyed by column. A field that is not set is the empty
+// string "".
+func (e entry) getCSVValues() map[string]string {
+	values := map[string]string{
+		TypeField(): e.Type,
+		"id":        e.ID,
+		"title":     e.Title,
+		"director":  e.Director,
+		"artist":    e.Artist,
+		"date":      e.Date,
+		"last":      e.Last,
+	}
+
+	if e.Year != 0 {
+		values["year"] = strconv.Itoa(e.Year)
+	}
+	if e.Rating != 0 {
+		values["rating"] = strconv.FormatFloat(e.Rating, 'f', -1, 64)
+	}
+	if e.Rewatch {
+		values["rewatch"] = strconv.FormatBool(e.Rewatch)
+	}
+	if e.Plays != 0 {
+		values["plays"] = strconv.Itoa(e.Plays)
+	}
+
+	return values
+}
+
+// WriteWithExtra writes a single media entry, after the values of the
+// extra columns.
+func (cw *CSVWriter) WriteWithExtra(extra []string, media schema.Media) error {
+	e, err := newEntry(media)
+	if err != nil {
+		return err
+	}
+
+	values := e.getCSVValues()
+	record := append(make([]string, 0, len(extra)+len(cw.columns)), extra...)
+	for _, column := range cw.columns {
+		record = append(record, values[column])
+	}
+
+	return cw.csvWriter.Write(record)
+}
+
+// Write writes a single media entry, with no extra columns.
+func (cw *CSVWriter) Write(media schema.Media) error {
+	return cw.WriteWithExtra(nil, media)
+}
+
+// Close flushes the file. It does not close the underlying io.Writer.
+func (cw *CSVWriter) Close() error {
+	cw.csvWriter.Flush()
+	return cw.csvWriter.Error()
+}
+
+// jsonFileWriter writes a JSON array with one entry per line.
+type jsonFileWriter struct {
+	w          io.Writer
+	numEntries int
+}
+
+func (jw *jsonFileWriter) Write(media schema.Media) error {
+	e, err := newEntry(media)
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n  "
+	if jw.numEntries == 0 {
+		separator = "[\n  "
+	}
+	jw.numEntries++
+
+	_, err = io.WriteString(jw.w, separator+string(jsonData))
+	return err
+}
+
+func (jw *jsonFileWriter) Close() error {
+	end := "\n]\n"
+	if jw.numEntries == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(jw.w, end)
+	return err
+}
+
+// ndjsonFileWriter writes one JSON object per line.
+type ndjsonFileWriter struct {
+	encoder *json.Encoder
+}
+
+func (nw *ndjsonFileWriter) Write(media schema.Media) error {
+	e, err := newEntry(media)
+	if err != nil {
+		return err
+	}
+
+	return nw.encoder.Encode(e)
+}
+
+func (nw *ndjsonFileWriter) Close() error {
+	return nil
+}
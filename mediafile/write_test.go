@@ -0,0 +1,167 @@
+package mediafile
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestWriter(tt *testing.T) {
+	media := []schema.Media{
+		schema.Movie{
+			ID:          "123",
+			Title:       "A Movie, With a Comma",
+			Director:    "A Director",
+			YearMade:    1999,
+			DateWatched: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Unix(),
+			Rating:      4.5,
+			Rewatch:     true,
+		},
+		schema.Music{
+			ID:           "456",
+			Title:        "Some Music",
+			Artist:       "An Artist",
+			YearMade:     1977,
+			DateListened: time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC).Unix(),
+			LastListened: time.Date(2021, 7, 2, 0, 0, 0, 0, time.UTC).Unix(),
+			Plays:        12,
+		},
+		schema.Music{
+			ID:           "789",
+			Title:        "Some Streamed Music",
+			Artist:       "An Artist",
+			DateListened: time.Date(2021, 6, 3, 0, 0, 0, 0, time.UTC).Unix(),
+		},
+	}
+
+	testCases := []struct {
+		format string
+		media  []schema.Media
+		want   string
+	}{
+		{CSVFormat(), media, `type,id,title,director,artist,year,date,rating,rewatch,last,plays
+movie,123,"A Movie, With a Comma",A Director,,1999,2021-06-01,4.5,true,,
+music,456,Some Music,,An Artist,1977,2021-06-02,,,2021-07-02,12
+music,789,Some Streamed Music,,An Artist,,2021-06-03,,,,
+`},
+		{JSONFormat(), media, `[
+  {"type":"movie","id":"123","title":"A Movie, With a Comma","director":"A Director","year":1999,"date":"2021-06-01","rating":4.5,"rewatch":true},
+  {"type":"music","id":"456","title":"Some Music","artist":"An Artist","year":1977,"date":"2021-06-02","last":"2021-07-02","plays":12},
+  {"type":"music","id":"789","title":"Some Streamed Music","artist":"An Artist","date":"2021-06-03"}
+]
+`},
+		{NDJSONFormat(), media, `{"type":"movie","id":"123","title":"A Movie, With a Comma","director":"A Director","year":1999,"date":"2021-06-01","rating":4.5,"rewatch":true}
+{"type":"music","id":"456","title":"Some Music","artist":"An Artist","year":1977,"date":"2021-06-02","last":"2021-07-02","plays":12}
+{"type":"music","id":"789","title":"Some Streamed Music","artist":"An Artist","date":"2021-06-03"}
+`},
+		{CSVFormat(), nil, "type,id,title,director,artist,year,date,rating,rewatch,last,plays\n"},
+		{JSONFormat(), nil, "[]\n"},
+		{NDJSONFormat(), nil, ""},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.format, func(subtt *testing.T) {
+			buf := new(bytes.Buffer)
+
+			writer, err := NewWriter(buf, test.format)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			for _, media := range test.media {
+				err = writer.Write(media)
+				if err != nil {
+					subtt.Fatal(err)
+				}
+			}
+			err = writer.Close()
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if got := buf.String(); test.want != got {
+				subtt.Fatalf("want %q, got %q", test.want, got)
+			}
+
+			// The file can be imported again, with new ids.
+			rows, err := Read(bytes.NewReader(buf.Bytes()), test.format, nil)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			if len(rows) != len(test.media) {
+				subtt.Fatalf("want %d rows, got %d", len(test.media), len(rows))
+			}
+			for i, row := range rows {
+				if row.Err != nil {
+					subtt.Fatal(row.Err)
+				}
+
+				id := schema.GetIDFromKey(test.media[i].Key())
+				switch media := row.Media.(type) {
+				case schema.Movie:
+					media.ID = id
+					row.Media = media
+				case schema.Music:
+					media.ID = id
+					row.Media = media
+				}
+				if !reflect.DeepEqual(test.media[i], row.Media) {
+					subtt.Fatalf("want %v, got %v", test.media[i], row.Media)
+				}
+			}
+		})
+	}
+
+	_, err := NewWriter(new(bytes.Buffer), "xml")
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
+
+func TestCSVWriter(tt *testing.T) {
+	movie := schema.Movie{ID: "1", Title: "Heat", Director: "Michael Mann", YearMade: 1995, DateWatched: 1620000000}
+
+	testCases := []struct {
+		name         string
+		extraColumns []string
+		extra        []string
+		columns      []string
+		want         string
+		isErr        bool
+	}{
+		{"columns", nil, nil, []string{"title", "year", "rating", "rewatch"}, "title,year,rating,rewatch\nHeat,1995,,\n", false},
+		{"extra", []string{"group"}, []string{"movie"}, []string{"title"}, "group,title\nmovie,Heat\n", false},
+		{"invalid-column", nil, nil, []string{"title", "genre"}, "", true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewCSVWriter(&buf, test.extraColumns, test.columns)
+			if test.isErr {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			err = writer.WriteWithExtra(test.extra, movie)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			err = writer.Close()
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if got := buf.String(); got != test.want {
+				subtt.Fatalf("want %q, got %q", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"sort"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// kind is the type of the values of a field.
+type kind int
+
+const (
+	textKind kind = iota
+	numberKind
+	dateKind
+	boolKind
+)
+
+// String returns the name of the kind, as it is shown in errors.
+func (k kind) String() string {
+	switch k {
+	case numberKind:
+		return "number"
+	case dateKind:
+		return "date"
+	case boolKind:
+		return "true or false"
+	default:
+		return "text"
+	}
+}
+
+// getFieldKinds returns the kind of every field that can be queried, keyed
+// by the name of the field, which is the same as in an exported file.
+func getFieldKinds() map[string]kind {
+	return map[string]kind{
+		"type":     textKind,
+		"id":       textKind,
+		"title":    textKind,
+		"director": textKind,
+		"artist":   textKind,
+		"year":     numberKind,
+		"date":     dateKind,
+		"rating":   numberKind,
+		"rewatch":  boolKind,
+		"last":     dateKind,
+		"plays":    numberKind,
+	}
+}
+
+// GetFields returns the sorted names of the fields that can be queried.
+func GetFields() []string {
+	names := make([]string, 0, len(getFieldKinds()))
+	for name := range getFieldKinds() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// value is the value of a field of an entry. Only the member
+// that holds values of the kind of the field is set.
+type value struct {
+	text    string
+	number  float64
+	date    int64
+	boolean bool
+}
+
+// getValue returns the value of the field called name of media, and false
+// if media does not have the field. A rating of zero means that a movie is
+// unrated, so it is treated as missing rather than as the lowest rating.
+// So are the last listen date and plays of music that were not recorded
+// by a listening history, and the year of music whose year is not known.
+func getValue(media schema.Media, name string) (value, bool) {
+	switch m := media.(type) {
+	case schema.Movie:
+		switch name {
+		case "type":
+			return value{text: schema.GetMediaTypeName(m)}, true
+		case "id":
+			return value{text: m.ID}, true
+		case "title":
+			return value{text: m.Title}, true
+		case "director":
+			return value{text: m.Director}, true
+		case "year":
+			return value{number: float64(m.YearMade)}, true
+		case "date":
+			return value{date: m.DateWatched}, true
+		case "rating":
+			return value{number: m.Rating}, m.Rating != 0
+		case "rewatch":
+			return value{boolean: m.Rewatch}, true
+		}
+	case schema.Music:
+		switch name {
+		case "type":
+			return value{text: schema.GetMediaTypeName(m)}, true
+		case "id":
+			return value{text: m.ID}, true
+		case "title":
+			return value{text: m.Title}, true
+		case "artist":
+			return value{text: m.Artist}, true
+		case "year":
+			return value{number: float64(m.YearMade)}, m.YearMade != 0
+		case "date":
+			return value{date: m.DateListened}, true
+		case "last":
+			return value{date: m.LastListened}, m.LastListened != 0
+		case "plays":
+			return value{number: float64(m.Plays)}, m.Plays != 0
+		}
+	}
+
+	return value{}, false
+}
+
+// GetValue returns the value of the field called name of media, and false
+// if media does not have the field, in the same way as it is compared in a
+// query. Text is a string, the year and plays are an int, the rating is a
+// float64, the rewatch is a bool, and dates are a string in the format
+// yyyy-mm-dd.
+func GetValue(media schema.Media, name string) (interface{}, bool) {
+	v, ok := getValue(media, name)
+	if !ok {
+		return nil, false
+	}
+
+	switch name {
+	case "year", "plays":
+		return int(v.number), true
+	}
+
+	switch getFieldKinds()[name] {
+	case numberKind:
+		return v.number, true
+	case dateKind:
+		return time.Unix(v.date, 0).UTC().Format("2006-01-02"), true
+	case boolKind:
+		return v.boolean, true
+	default:
+		return v.text, true
+	}
+}
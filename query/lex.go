@@ -0,0 +1,177 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a token of a query.
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	wordToken
+	stringToken
+	numberToken
+	dateToken
+	operatorToken
+	leftParenToken
+	rightParenToken
+	rangeToken
+)
+
+// token is a single token of a query. For a string, text is the string
+// without its quotes or escapes. Pos is the byte offset of the token in
+// the query.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// String describes the token, as it is shown in errors.
+func (t token) String() string {
+	switch t.kind {
+	case eofToken:
+		return "the end of the query"
+	case stringToken:
+		return fmt.Sprintf("the string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// is returns true if the token is the keyword or operator text.
+// Keywords are not case sensitive.
+func (t token) is(text string) bool {
+	switch t.kind {
+	case wordToken:
+		return strings.EqualFold(t.text, text)
+	case operatorToken, leftParenToken, rightParenToken, rangeToken:
+		return t.text == text
+	default:
+		return false
+	}
+}
+
+// getOperators returns the comparison operators,
+// with the longest operators that share a prefix first.
+func getOperators() []string {
+	return []string{"==", "=~", "!=", "!~", "<=", ">=", "=", "<", ">", "~"}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+// lex splits the query s into tokens. The last token is always an
+// eofToken. It returns an *Error if s contains an unterminated string or
+// a character that cannot start a token.
+func lex(s string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{leftParenToken, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{rightParenToken, ")", i})
+			i++
+		case strings.HasPrefix(s[i:], ".."):
+			tokens = append(tokens, token{rangeToken, "..", i})
+			i += 2
+		case c == '"' || c == '\'':
+			text, end, err := lexString(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{stringToken, text, i})
+			i = end
+		case isDigit(c):
+			tok := lexNumber(s, i)
+			tokens = append(tokens, tok)
+			i += len(tok.text)
+		case isWordChar(c):
+			start := i
+			for i < len(s) && isWordChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, token{wordToken, s[start:i], start})
+		default:
+			isOperator := false
+			for _, op := range getOperators() {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, token{operatorToken, op, i})
+					i += len(op)
+					isOperator = true
+					break
+				}
+			}
+			if !isOperator {
+				r, _ := utf8.DecodeRuneInString(s[i:])
+				return nil, newError(s, i, "unexpected character %q", r)
+			}
+		}
+	}
+
+	return append(tokens, token{eofToken, "", len(s)}), nil
+}
+
+// lexString returns the text of the string quoted by the character at
+// start of s, and the offset of the character after the closing quote.
+// A backslash escapes the character after it.
+func lexString(s string, start int) (string, int, error) {
+	quote := s[start]
+
+	var text strings.Builder
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				text.WriteByte(s[i])
+			}
+		case quote:
+			return text.String(), i + 1, nil
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+
+	return "", 0, newError(s, start, "the string is not closed, want a closing %c", quote)
+}
+
+// lexNumber returns the number or date that starts at start of s. A date
+// is a year followed by a month, and optionally a day, joined by dashes,
+// such as 2021-05 or 2021-05-01.
+func lexNumber(s string, start int) token {
+	i := start
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+
+	switch {
+	case i+1 < len(s) && s[i] == '-' && isDigit(s[i+1]):
+		for i < len(s) && (isDigit(s[i]) || s[i] == '-') {
+			i++
+		}
+		return token{dateToken, s[start:i], start}
+	case i+1 < len(s) && s[i] == '.' && isDigit(s[i+1]):
+		i++
+		for i < len(s) && isDigit(s[i]) {
+			i++
+		}
+	}
+
+	return token{numberToken, s[start:i], start}
+}
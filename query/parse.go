@@ -0,0 +1,492 @@
+// Package query parses and evaluates the expressions that select media
+// entries by the values of their fields, such as
+//
+//	year >= 2000 and director ~ "nolan" and date in 2021
+//
+// A comparison is a field, an operator, and a value. The fields are the
+// same as in an exported file. Comparisons are combined with and, or, and
+// not, and grouped with parentheses. The operators are:
+//
+//	=  !=  <  <=  >  >=   compare a field with a value
+//	~  !~                 a text field contains, or does not contain, the value
+//	=~                    a text field matches the value as a regular expression
+//	in                    a number or date field is in a range, such as
+//	                      year in 1990..1999, date in 2021-05, or
+//	                      date in 2021-01-01..2021-03-31
+//
+// Text is compared ignoring case. A date is a year, a year and month, or a
+// day, such as 2021, 2021-05, or 2021-05-01, and covers the whole period,
+// so date = 2021 is the same as date in 2021, and date > 2021 is after the
+// end of 2021. An entry that does not have a field, such as the director
+// of music, the rating of an unrated movie, or the year of music whose
+// year is not known, does not match any comparison of that field.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// Error is returned when a query cannot be parsed. Column is the position
+// of the problem in the query, counting characters from 1.
+type Error struct {
+	Query   string
+	Column  int
+	Message string
+}
+
+// Error describes the problem and where it is in the query.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Message, e.Column)
+}
+
+// newError returns an *Error for the problem found at the byte offset
+// pos of the query s, with a message in the manner of fmt.Sprintf.
+func newError(s string, pos int, format string, a ...interface{}) *Error {
+	return &Error{
+		Query:   s,
+		Column:  utf8.RuneCountInString(s[:pos]) + 1,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// node is a part of a parsed query.
+type node interface {
+	matches(media schema.Media) bool
+}
+
+type andNode struct {
+	left, right node
+}
+
+func (n andNode) matches(media schema.Media) bool {
+	return n.left.matches(media) && n.right.matches(media)
+}
+
+type orNode struct {
+	left, right node
+}
+
+func (n orNode) matches(media schema.Media) bool {
+	return n.left.matches(media) || n.right.matches(media)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) matches(media schema.Media) bool {
+	return !n.operand.matches(media)
+}
+
+// comparison compares a field of an entry with a value. Numbers are
+// compared with the inclusive range from min to max, and dates with the
+// range from start to end, where end is not included.
+type comparison struct {
+	field   string
+	kind    kind
+	op      string
+	text    string
+	re      *regexp.Regexp
+	min     float64
+	max     float64
+	start   int64
+	end     int64
+	boolean bool
+}
+
+func (c comparison) matches(media schema.Media) bool {
+	v, ok := getValue(media, c.field)
+	if !ok {
+		return false
+	}
+
+	switch c.kind {
+	case textKind:
+		return c.matchText(v.text)
+	case numberKind:
+		return compareRange(c.op, v.number < c.min, v.number > c.max)
+	case dateKind:
+		return compareRange(c.op, v.date < c.start, v.date >= c.end)
+	case boolKind:
+		return (v.boolean == c.boolean) == (c.op == "=")
+	}
+
+	return false
+}
+
+func (c comparison) matchText(text string) bool {
+	text = strings.ToLower(text)
+
+	switch c.op {
+	case "=":
+		return text == c.text
+	case "!=":
+		return text != c.text
+	case "<":
+		return text < c.text
+	case "<=":
+		return text <= c.text
+	case ">":
+		return text > c.text
+	case ">=":
+		return text >= c.text
+	case "~":
+		return strings.Contains(text, c.text)
+	case "!~":
+		return !strings.Contains(text, c.text)
+	case "=~":
+		return c.re.MatchString(text)
+	}
+
+	return false
+}
+
+// compareRange compares a value with a range, given whether the value is
+// before or after the range. Equality means that the value is in the range.
+func compareRange(op string, isBefore, isAfter bool) bool {
+	switch op {
+	case "=", "in":
+		return !isBefore && !isAfter
+	case "!=":
+		return isBefore || isAfter
+	case "<":
+		return isBefore
+	case "<=":
+		return !isAfter
+	case ">":
+		return isAfter
+	case ">=":
+		return !isBefore
+	}
+
+	return false
+}
+
+// Query is a parsed query expression.
+type Query struct {
+	text string
+	root node
+}
+
+// String returns the query as it was given to Parse.
+func (q *Query) String() string {
+	return q.text
+}
+
+// Matches returns true if media matches the query.
+func (q *Query) Matches(media schema.Media) bool {
+	return q.root.matches(media)
+}
+
+// parser parses a query from its tokens by recursive descent. The
+// operators from lowest to highest precedence are or, and, and not.
+type parser struct {
+	query  string
+	tokens []token
+	pos    int
+}
+
+// Parse parses the query expression s. It returns an *Error that gives
+// the position of the problem if s is not a valid query.
+func Parse(s string) (*Query, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{query: s, tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != eofToken {
+		return nil, p.errorAt(tok, "want and, or, or the end of the query, got %s", tok)
+	}
+
+	return &Query{text: s, root: root}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != eofToken {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorAt(tok token, format string, a ...interface{}) *Error {
+	return newError(p.query, tok.pos, format, a...)
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().is("not") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand}, nil
+	}
+
+	if p.peek().is("(") {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); !tok.is(")") {
+			return nil, p.errorAt(tok, "want ), got %s", tok)
+		}
+		return n, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != wordToken {
+		return nil, p.errorAt(fieldTok, "want a field name, got %s", fieldTok)
+	}
+
+	field := strings.ToLower(fieldTok.text)
+	fieldKind, ok := getFieldKinds()[field]
+	if !ok {
+		return nil, p.errorAt(fieldTok, "%q is not a field", fieldTok.text)
+	}
+
+	opTok := p.next()
+	op := opTok.text
+	switch {
+	case opTok.is("in"):
+		op = "in"
+	case opTok.is("=="):
+		op = "="
+	case opTok.kind != operatorToken:
+		return nil, p.errorAt(opTok, "want an operator after %s, got %s", field, opTok)
+	}
+
+	c := comparison{field: field, kind: fieldKind, op: op}
+
+	var err error
+	switch fieldKind {
+	case textKind:
+		err = p.parseTextValue(&c, opTok)
+	case numberKind:
+		err = p.parseNumberValue(&c, opTok)
+	case dateKind:
+		err = p.parseDateValue(&c, opTok)
+	case boolKind:
+		err = p.parseBoolValue(&c, opTok)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// checkOperator returns an *Error if the operator in opTok cannot be
+// used with the field of c.
+func (p *parser) checkOperator(c *comparison, opTok token, ops ...string) error {
+	for _, op := range ops {
+		if c.op == op {
+			return nil
+		}
+	}
+
+	return p.errorAt(opTok, "%s cannot be used with %s, which is %s", opTok, c.field, c.kind)
+}
+
+func (p *parser) parseTextValue(c *comparison, opTok token) error {
+	err := p.checkOperator(c, opTok, "=", "!=", "<", "<=", ">", ">=", "~", "!~", "=~")
+	if err != nil {
+		return err
+	}
+
+	tok := p.next()
+	switch tok.kind {
+	case stringToken, wordToken, numberToken, dateToken:
+	default:
+		return p.errorAt(tok, "want text after %s, got %s", opTok.text, tok)
+	}
+	c.text = strings.ToLower(tok.text)
+
+	if c.op == "=~" {
+		c.re, err = regexp.Compile("(?i)" + tok.text)
+		if err != nil {
+			return p.errorAt(tok, "%s is not a valid regular expression: %s", tok, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) parseNumber() (float64, error) {
+	tok := p.next()
+	if tok.kind != numberToken {
+		return 0, p.errorAt(tok, "want a number, got %s", tok)
+	}
+
+	return strconv.ParseFloat(tok.text, 64)
+}
+
+func (p *parser) parseNumberValue(c *comparison, opTok token) error {
+	err := p.checkOperator(c, opTok, "=", "!=", "<", "<=", ">", ">=", "in")
+	if err != nil {
+		return err
+	}
+
+	c.min, err = p.parseNumber()
+	if err != nil {
+		return err
+	}
+	c.max = c.min
+
+	if c.op == "in" && p.peek().is("..") {
+		rangeTok := p.next()
+		c.max, err = p.parseNumber()
+		if err != nil {
+			return err
+		}
+		if c.max < c.min {
+			return p.errorAt(rangeTok, "the range is empty, since %v is after %v", c.min, c.max)
+		}
+	}
+
+	return nil
+}
+
+// parseDate parses a year, a year and month, or a day, and returns the
+// Unix timestamps of the start of the period and the start of the next.
+func (p *parser) parseDate() (int64, int64, error) {
+	tok := p.next()
+	if tok.kind != dateToken && tok.kind != numberToken {
+		return 0, 0, p.errorAt(tok, "want a date such as 2021, 2021-05, or 2021-05-01, got %s", tok)
+	}
+
+	parts := strings.Split(tok.text, "-")
+	fields := []int{0, 1, 1}
+	if len(parts) > len(fields) {
+		return 0, 0, p.errorAt(tok, "%s is not a valid date, want yyyy, yyyy-mm, or yyyy-mm-dd", tok)
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, 0, p.errorAt(tok, "%s is not a valid date, want yyyy, yyyy-mm, or yyyy-mm-dd", tok)
+		}
+		fields[i] = n
+	}
+
+	start := time.Date(fields[0], time.Month(fields[1]), fields[2], 0, 0, 0, 0, time.UTC)
+	if start.Year() != fields[0] || start.Month() != time.Month(fields[1]) || start.Day() != fields[2] {
+		return 0, 0, p.errorAt(tok, "%s is not a valid date", tok)
+	}
+
+	var end time.Time
+	switch len(parts) {
+	case 1:
+		end = start.AddDate(1, 0, 0)
+	case 2:
+		end = start.AddDate(0, 1, 0)
+	default:
+		end = start.AddDate(0, 0, 1)
+	}
+
+	return start.Unix(), end.Unix(), nil
+}
+
+func (p *parser) parseDateValue(c *comparison, opTok token) error {
+	err := p.checkOperator(c, opTok, "=", "!=", "<", "<=", ">", ">=", "in")
+	if err != nil {
+		return err
+	}
+
+	c.start, c.end, err = p.parseDate()
+	if err != nil {
+		return err
+	}
+
+	if c.op == "in" && p.peek().is("..") {
+		rangeTok := p.next()
+		var lastStart int64
+		lastStart, c.end, err = p.parseDate()
+		if err != nil {
+			return err
+		}
+		if lastStart < c.start {
+			return p.errorAt(rangeTok, "the range is empty, since the first date is after the last")
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) parseBoolValue(c *comparison, opTok token) error {
+	err := p.checkOperator(c, opTok, "=", "!=")
+	if err != nil {
+		return err
+	}
+
+	tok := p.next()
+	switch {
+	case tok.is("true"):
+		c.boolean = true
+	case tok.is("false"):
+		c.boolean = false
+	default:
+		return p.errorAt(tok, "want true or false, got %s", tok)
+	}
+
+	return nil
+}
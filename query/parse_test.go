@@ -0,0 +1,136 @@
+package query
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestMatches(tt *testing.T) {
+	movie, err := schema.NewMovie("The Dark Knight", "Christopher Nolan", 2008, "2021-05-14")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	movie.Rating = 4.5
+
+	unrated, err := schema.NewMovie("Heat", "Michael Mann", 1995, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	music, err := schema.NewMusic("Back in Black", "AC/DC", 1980, "2020-12-31")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	streamed, err := schema.NewMusicWithUnknownYear("Thunderstruck", "AC/DC", "2021-01-02")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		query string
+		media schema.Media
+		want  bool
+	}{
+		{"number-equal", "year = 2008", *movie, true},
+		{"number-double-equal", "year == 2008", *movie, true},
+		{"number-not-equal", "year != 2008", *movie, false},
+		{"number-less", "year < 2008", *movie, false},
+		{"number-less-equal", "year <= 2008", *movie, true},
+		{"number-greater", "year > 2000", *movie, true},
+		{"number-greater-equal", "year >= 2009", *movie, false},
+		{"number-decimal", "rating >= 4.5", *movie, true},
+		{"number-range", "year in 2000..2009", *movie, true},
+		{"number-range-outside", "year in 1990..1999", *movie, false},
+		{"text-equal-ignores-case", "title = 'the dark knight'", *movie, true},
+		{"text-contains", `director ~ "nolan"`, *movie, true},
+		{"text-not-contains", "director !~ nolan", *movie, false},
+		{"text-regex", `title =~ "^the .*t$"`, *movie, true},
+		{"text-escaped-quote", `title != "the \"dark\" knight"`, *movie, true},
+		{"text-type", "type = music", *music, true},
+		{"missing-field", "director ~ nolan", *music, false},
+		{"missing-field-not-equal", "director != nolan", *music, false},
+		{"missing-last", "last in 2020", *music, false},
+		{"missing-rating", "rating < 3", *music, false},
+		{"unrated", "rating < 3", *unrated, false},
+		{"unrated-not-equal", "rating != 4.5", *unrated, false},
+		{"not-unrated", "not rating > 0", *unrated, true},
+		{"missing-plays", "plays >= 0", *music, false},
+		{"missing-year", "year < 2000", *streamed, false},
+		{"not-missing-year", "not year > 0", *streamed, true},
+		{"date-in-year", "date in 2021", *movie, true},
+		{"date-in-month", "date in 2021-05", *movie, true},
+		{"date-in-other-month", "date in 2021-06", *movie, false},
+		{"date-equal-day", "date = 2021-05-14", *movie, true},
+		{"date-after-year", "date > 2020", *music, false},
+		{"date-before-or-in-year", "date <= 2020", *music, true},
+		{"date-from-year", "date >= 2021", *movie, true},
+		{"date-range", "date in 2021-01-01..2021-05-14", *movie, true},
+		{"date-range-outside", "date in 2021-01..2021-04", *movie, false},
+		{"bool", "rewatch = false", *movie, true},
+		{"bool-not-equal", "rewatch != false", *movie, false},
+		{"and", `year >= 2000 and director ~ "nolan" and date in 2021`, *movie, true},
+		{"and-false", "year >= 2000 and type = music", *movie, false},
+		{"or", "year < 2000 or type = movie", *movie, true},
+		{"not", "not type = music", *movie, true},
+		{"precedence", "type = music or type = movie and year < 2000", *movie, false},
+		{"parentheses", "(type = music or type = movie) and year > 2000", *movie, true},
+		{"keywords-ignore-case", "Year > 2000 AND NOT Type = music", *movie, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			q, err := Parse(test.query)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if got := q.Matches(test.media); got != test.want {
+				subtt.Fatalf("want %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseError(tt *testing.T) {
+	testCases := []struct {
+		name   string
+		query  string
+		column int
+	}{
+		{"empty", "", 1},
+		{"unknown-field", "year > 2000 and genre = drama", 17},
+		{"missing-operator", "year 2000", 6},
+		{"missing-value", "year >", 7},
+		{"wrong-value-kind", "year = nolan", 8},
+		{"wrong-operator-kind", "year ~ 2000", 6},
+		{"text-range", "title in a", 7},
+		{"invalid-date", "date in 2021-13", 9},
+		{"invalid-day", "date = 2021-02-30", 8},
+		{"empty-range", "year in 2009..2000", 13},
+		{"invalid-regex", "title =~ '('", 10},
+		{"unclosed-string", `title = "the dark`, 9},
+		{"unclosed-parenthesis", "(year = 2000", 13},
+		{"unexpected-character", "year = 2000 & type = movie", 13},
+		{"trailing-token", "year = 2000 type = movie", 13},
+		{"bool-value", "rewatch = yes", 11},
+		{"multibyte-column", "title = 'é' and x", 17},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := Parse(test.query)
+
+			var queryErr *Error
+			if !errors.As(err, &queryErr) {
+				subtt.Fatalf("want *Error, got %v", err)
+			}
+			if queryErr.Column != test.column {
+				subtt.Fatalf("want column %d, got %d (%s)", test.column, queryErr.Column, queryErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// Order sorts media entries by the value of a field. The zero value
+// leaves entries in the order they are in.
+type Order struct {
+	Field      string
+	Descending bool
+}
+
+// ParseOrder parses an order such as date, or date:desc for the latest
+// entries first. The field can be any field that can be queried, and the
+// direction is asc by default. It returns a non-nil error if s is not a
+// valid order.
+func ParseOrder(s string) (Order, error) {
+	fieldDirection := strings.SplitN(s, ":", 2)
+
+	order := Order{Field: strings.ToLower(fieldDirection[0])}
+	if _, ok := getFieldKinds()[order.Field]; !ok {
+		return Order{}, fmt.Errorf("%q is not a field, want one of %s", fieldDirection[0], strings.Join(GetFields(), ", "))
+	}
+
+	if len(fieldDirection) == 2 {
+		switch strings.ToLower(fieldDirection[1]) {
+		case "asc":
+		case "desc":
+			order.Descending = true
+		default:
+			return Order{}, fmt.Errorf("%q is not a direction, want asc or desc", fieldDirection[1])
+		}
+	}
+
+	return order, nil
+}
+
+// compareValues returns a negative number, zero, or a positive number if
+// a is before, the same as, or after b for a field of the given kind.
+func compareValues(k kind, a, b value) int {
+	switch k {
+	case numberKind:
+		switch {
+		case a.number < b.number:
+			return -1
+		case a.number > b.number:
+			return 1
+		}
+	case dateKind:
+		switch {
+		case a.date < b.date:
+			return -1
+		case a.date > b.date:
+			return 1
+		}
+	case boolKind:
+		switch {
+		case !a.boolean && b.boolean:
+			return -1
+		case a.boolean && !b.boolean:
+			return 1
+		}
+	default:
+		return strings.Compare(strings.ToLower(a.text), strings.ToLower(b.text))
+	}
+
+	return 0
+}
+
+// sortByValue sorts media by the values of kind k that get returns for
+// each entry. Entries that get returns false for come last in either
+// direction, and entries with the same value keep the order they were in.
+func sortByValue(media []schema.Media, k kind, isDescending bool, get func(schema.Media) (value, bool)) {
+	sort.SliceStable(media, func(i, j int) bool {
+		a, aOK := get(media[i])
+		b, bOK := get(media[j])
+		if !aOK || !bOK {
+			return aOK && !bOK
+		}
+
+		if isDescending {
+			return compareValues(k, a, b) > 0
+		}
+		return compareValues(k, a, b) < 0
+	})
+}
+
+// Sort sorts media in the order o. Entries that do not have the field
+// come last in either direction, and entries with the same value keep
+// the order they were in.
+func (o Order) Sort(media []schema.Media) {
+	if o.Field == "" {
+		return
+	}
+
+	sortByValue(media, getFieldKinds()[o.Field], o.Descending, func(m schema.Media) (value, bool) {
+		return getValue(m, o.Field)
+	})
+}
+
+// GetGroupings returns the ways that entries can be grouped. A year groups
+// entries by the year they were made, and a month by the month they were
+// watched or listened to.
+func GetGroupings() []string {
+	return []string{"year", "month", "director", "artist", "type"}
+}
+
+// getGroupField returns the field that the grouping by is based on.
+func getGroupField(by string) string {
+	if by == "month" {
+		return "date"
+	}
+	return by
+}
+
+// ValidateGrouping returns a non-nil error if by is not one of GetGroupings.
+func ValidateGrouping(by string) error {
+	for _, grouping := range GetGroupings() {
+		if by == grouping {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%q is not a grouping, want one of %s", by, strings.Join(GetGroupings(), ", "))
+}
+
+// Group is the entries that share a value of the field they are grouped by.
+type Group struct {
+	// Name is the value that the entries share, such as 2021 or 2021-05.
+	Name  string
+	Media []schema.Media
+}
+
+// getGroupValue returns the value of the field of media that the grouping
+// by is based on, and false if media does not have the field. The date of
+// a month grouping is the first day of the month.
+func getGroupValue(media schema.Media, by string) (value, bool) {
+	if by != "month" {
+		return getValue(media, by)
+	}
+
+	v, ok := getValue(media, "date")
+	date := time.Unix(v.date, 0).UTC()
+	v.date = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	return v, ok
+}
+
+// groupName returns the name of the group of media by the grouping by.
+func groupName(media schema.Media, by string) string {
+	v, ok := getGroupValue(media, by)
+	if !ok {
+		return "no " + by
+	}
+
+	switch by {
+	case "year":
+		return strconv.Itoa(int(v.number))
+	case "month":
+		return time.Unix(v.date, 0).UTC().Format("2006-01")
+	default:
+		return v.text
+	}
+}
+
+// GroupBy groups media by the grouping by, which is one of GetGroupings.
+// Groups are in the order of the field they are grouped by, which is
+// descending if o sorts by that field in descending order, and entries that
+// do not have the field come last. The entries in each group keep the order
+// they were in. Text is grouped ignoring case.
+func GroupBy(media []schema.Media, by string, o Order) []Group {
+	sorted := make([]schema.Media, len(media))
+	copy(sorted, media)
+
+	field := getGroupField(by)
+	sortByValue(sorted, getFieldKinds()[field], o.Field == field && o.Descending, func(m schema.Media) (value, bool) {
+		return getGroupValue(m, by)
+	})
+
+	groups := make([]Group, 0)
+	for _, m := range sorted {
+		name := groupName(m, by)
+		if n := len(groups); n > 0 && strings.EqualFold(groups[n-1].Name, name) {
+			groups[n-1].Media = append(groups[n-1].Media, m)
+			continue
+		}
+		groups = append(groups, Group{Name: name, Media: []schema.Media{m}})
+	}
+
+	return groups
+}
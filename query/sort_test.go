@@ -0,0 +1,106 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestParseOrder(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		order   string
+		want    Order
+		isError bool
+	}{
+		{"field", "date", Order{Field: "date"}, false},
+		{"asc", "year:asc", Order{Field: "year"}, false},
+		{"desc", "Title:DESC", Order{Field: "title", Descending: true}, false},
+		{"invalid-field", "genre", Order{}, true},
+		{"invalid-direction", "date:newest", Order{}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			order, err := ParseOrder(test.order)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if order != test.want {
+				subtt.Fatalf("want %+v, got %+v", test.want, order)
+			}
+		})
+	}
+}
+
+// getTitles returns the title of every entry in media.
+func getTitles(media []schema.Media) []string {
+	titles := make([]string, len(media))
+	for i, m := range media {
+		v, _ := getValue(m, "title")
+		titles[i] = v.text
+	}
+	return titles
+}
+
+func TestSortAndGroupBy(tt *testing.T) {
+	heat := schema.Movie{Title: "Heat", Director: "Michael Mann", YearMade: 1995, DateWatched: 1620000000}
+	memento := schema.Movie{Title: "memento", Director: "Christopher Nolan", YearMade: 2000, DateWatched: 1610000000}
+	tenet := schema.Movie{Title: "Tenet", Director: "christopher nolan", YearMade: 2020, DateWatched: 1620100000}
+	thriller := schema.Music{Title: "Thriller", Artist: "Michael Jackson", YearMade: 1982, DateListened: 1600000000}
+	media := []schema.Media{tenet, thriller, heat, memento}
+
+	testCases := []struct {
+		name    string
+		order   Order
+		groupBy string
+		want    []string
+		groups  []string
+	}{
+		{"unsorted", Order{}, "", []string{"Tenet", "Thriller", "Heat", "memento"}, nil},
+		{"title", Order{Field: "title"}, "", []string{"Heat", "memento", "Tenet", "Thriller"}, nil},
+		{"year-desc", Order{Field: "year", Descending: true}, "", []string{"Tenet", "memento", "Heat", "Thriller"}, nil},
+		{"director-missing-last", Order{Field: "director", Descending: true}, "", []string{"Heat", "Tenet", "memento", "Thriller"}, nil},
+		{"group-by-director", Order{Field: "year"}, "director", []string{"memento", "Tenet", "Heat", "Thriller"}, []string{"Christopher Nolan", "Michael Mann", "no director"}},
+		{"group-by-month", Order{Field: "title"}, "month", []string{"Thriller", "memento", "Heat", "Tenet"}, []string{"2020-09", "2021-01", "2021-05"}},
+		{"group-by-month-desc", Order{Field: "date", Descending: true}, "month", []string{"Tenet", "Heat", "memento", "Thriller"}, []string{"2021-05", "2021-01", "2020-09"}},
+		{"group-by-type", Order{}, "type", []string{"Tenet", "Heat", "memento", "Thriller"}, []string{"movie", "music"}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			sorted := make([]schema.Media, len(media))
+			copy(sorted, media)
+			test.order.Sort(sorted)
+
+			got := sorted
+			if test.groupBy != "" {
+				got = make([]schema.Media, 0, len(sorted))
+				groups := GroupBy(sorted, test.groupBy, test.order)
+				if len(groups) != len(test.groups) {
+					subtt.Fatalf("want groups %v, got %d groups", test.groups, len(groups))
+				}
+				for i, group := range groups {
+					if group.Name != test.groups[i] {
+						subtt.Fatalf("want group %q, got %q", test.groups[i], group.Name)
+					}
+					got = append(got, group.Media...)
+				}
+			}
+
+			titles := getTitles(got)
+			for i := range test.want {
+				if titles[i] != test.want[i] {
+					subtt.Fatalf("want %v, got %v", test.want, titles)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package schema
+
+import "fmt"
+
+// ValidationError is returned when a field of a media entry is not valid.
+// Field is the name of the field as it is stored, such as title or date.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+// Error describes the field that is not valid and why.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Reason)
+}
+
+// newValidationError returns a *ValidationError for field, with
+// the reason formatted from format and a as with fmt.Sprintf.
+func newValidationError(field, format string, a ...interface{}) error {
+	return &ValidationError{
+		Field:  field,
+		Reason: fmt.Sprintf(format, a...),
+	}
+}
+
+// validateDate converts the date s for field to a Unix timestamp as
+// with StringToUnixTime, returning a *ValidationError if s is not valid.
+func validateDate(field, s string) (int64, error) {
+	unixTime, err := StringToUnixTime(s)
+	if err != nil {
+		return 0, newValidationError(field, "must be a date in the format yyyy-mm-dd, got %q: %s", s, err)
+	}
+
+	return unixTime, nil
+}
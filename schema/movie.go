@@ -2,6 +2,8 @@ package schema
 
 import (
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,13 +11,17 @@ import (
 )
 
 // Movie contains information about a single film.
-// DateWatched is a Unix timestamp.
+// DateWatched is a Unix timestamp. Rating is out of
+// five stars in half-star steps, and zero if unrated.
+// Rewatch is true if the film had been seen before.
 type Movie struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Director    string `json:"director"`
-	YearMade    int    `json:"year"`
-	DateWatched int64  `json:"date"`
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	Director    string  `json:"director"`
+	YearMade    int     `json:"year"`
+	DateWatched int64   `json:"date"`
+	Rating      float64 `json:"rating,omitempty"`
+	Rewatch     bool    `json:"rewatch,omitempty"`
 }
 
 // Key returns the unique object key for storage in the database.
@@ -25,35 +31,45 @@ func (m Movie) Key() string {
 }
 
 // String provides a standard interface to print Movie to output.
+// The rating and rewatch are only printed if they are set.
 func (m Movie) String() string {
-	return fmt.Sprintf(`id: %s
+	s := fmt.Sprintf(`id: %s
   title:    %s
   director: %s
   year:     %d
   date:	    %s`, m.ID, m.Title, m.Director, m.YearMade, time.Unix(m.DateWatched, 0).Format("2006-01-02"))
+
+	if m.Rating != 0 {
+		s += fmt.Sprintf("\n  rating:   %s", strconv.FormatFloat(m.Rating, 'f', -1, 64))
+	}
+	if m.Rewatch {
+		s += "\n  rewatch:  yes"
+	}
+
+	return s
 }
 
 // NewMovie validates the given inputs and returns a pointer to a Movie type.
 // The dateWatched parameter should be in the format 'yyyy-mm-dd'.
-// If there are validation problems, a non-nil error is returned.
+// If there are validation problems, a *ValidationError is returned.
 func NewMovie(title, director string, yearMade int, dateWatched string) (*Movie, error) {
 	trim := strings.TrimSpace
 
 	title = trim(title)
 	if title == "" {
-		return nil, fmt.Errorf("title cannot be null, got %q", title)
+		return nil, newValidationError("title", "cannot be null, got %q", title)
 	}
 
 	director = trim(director)
 	if director == "" {
-		return nil, fmt.Errorf("director cannot be null, got %q", director)
+		return nil, newValidationError("director", "cannot be null, got %q", director)
 	}
 
 	if yearMade < 1 {
-		return nil, fmt.Errorf("yearMade must be positive, got %d", yearMade)
+		return nil, newValidationError("year", "must be positive, got %d", yearMade)
 	}
 
-	unixTime, err := StringToUnixTime(trim(dateWatched))
+	unixTime, err := validateDate("date", trim(dateWatched))
 	if err != nil {
 		return nil, err
 	}
@@ -66,3 +82,13 @@ func NewMovie(title, director string, yearMade int, dateWatched string) (*Movie,
 		DateWatched: unixTime,
 	}, nil
 }
+
+// ValidateRating returns a *ValidationError if rating is not a valid Movie
+// rating, which is zero for unrated or from 0.5 to 5 in steps of 0.5.
+func ValidateRating(rating float64) error {
+	if rating < 0 || rating > 5 || rating != math.Round(rating*2)/2 {
+		return newValidationError("rating", "must be from 0.5 to 5 in steps of 0.5, or 0 for unrated, got %v", rating)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -18,6 +19,7 @@ type newMovieInput struct {
 type newMovieOutput struct {
 	movie   *Movie
 	isError bool
+	field   string
 }
 
 func TestNewMovie(tt *testing.T) {
@@ -29,27 +31,27 @@ func TestNewMovie(tt *testing.T) {
 		{
 			"basic",
 			newMovieInput{"a title", "a director", 2000, "2021-03-14"},
-			newMovieOutput{&Movie{}, false},
+			newMovieOutput{&Movie{}, false, ""},
 		},
 		{
 			"empty title",
 			newMovieInput{"", "a director", 2000, "2021-03-14"},
-			newMovieOutput{nil, true},
+			newMovieOutput{nil, true, "title"},
 		},
 		{
 			"empty director",
 			newMovieInput{"a title", "\t  \t\n", 2000, "2021-03-14"},
-			newMovieOutput{nil, true},
+			newMovieOutput{nil, true, "director"},
 		},
 		{
 			"invalid year",
 			newMovieInput{"a title", "a director", 0, "2021-03-14"},
-			newMovieOutput{nil, true},
+			newMovieOutput{nil, true, "year"},
 		},
 		{
 			"invalid date",
 			newMovieInput{"a title", "a director", 2000, "2021-17-14"},
-			newMovieOutput{nil, true},
+			newMovieOutput{nil, true, "date"},
 		},
 	}
 
@@ -63,8 +65,12 @@ func TestNewMovie(tt *testing.T) {
 			}
 
 			if test.output.isError {
-				if err == nil {
-					subtt.Fatal("want error, got nil")
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					subtt.Fatalf("want *ValidationError, got %v", err)
+				}
+				if test.output.field != validationErr.Field {
+					subtt.Fatalf("want invalid field %s, got %s", test.output.field, validationErr.Field)
 				}
 				return
 			} else if err != nil {
@@ -93,3 +99,44 @@ func TestNewMovie(tt *testing.T) {
 		})
 	}
 }
+
+func TestValidateRating(tt *testing.T) {
+	testCases := []struct {
+		rating  float64
+		isError bool
+	}{
+		{0, false},
+		{0.5, false},
+		{3, false},
+		{4.5, false},
+		{5, false},
+		{-0.5, true},
+		{5.5, true},
+		{3.2, true},
+	}
+
+	for _, test := range testCases {
+		err := ValidateRating(test.rating)
+
+		if test.isError {
+			if err == nil {
+				tt.Fatalf("for rating %v, want error, got nil", test.rating)
+			}
+		} else if err != nil {
+			tt.Fatal(err)
+		}
+	}
+}
+
+func TestMovieString(tt *testing.T) {
+	movie := Movie{ID: "123", Title: "a title", Director: "a director", YearMade: 2000}
+	if got := movie.String(); strings.Contains(got, "rating") || strings.Contains(got, "rewatch") {
+		tt.Fatalf("want no rating or rewatch for an unrated movie, got %q", got)
+	}
+
+	movie.Rating = 3.5
+	movie.Rewatch = true
+	if got := movie.String(); !strings.Contains(got, "\n  rating:   3.5") || !strings.Contains(got, "\n  rewatch:  yes") {
+		tt.Fatalf("want rating and rewatch, got %q", got)
+	}
+}
@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,13 +10,20 @@ import (
 )
 
 // Music contains information about a single piece of music.
-// DateListened is a Unix timestamp.
+// DateListened is a Unix timestamp. For music imported from a
+// listening history, DateListened is the first listen, LastListened
+// is the Unix timestamp of the last listen, and Plays is the number
+// of times it was played. Both are zero otherwise. YearMade is zero
+// if the year is not known, because listening histories do not
+// record it.
 type Music struct {
 	ID           string `json:"id"`
 	Title        string `json:"title"`
 	Artist       string `json:"artist"`
 	YearMade     int    `json:"year"`
 	DateListened int64  `json:"date"`
+	LastListened int64  `json:"last,omitempty"`
+	Plays        int    `json:"plays,omitempty"`
 }
 
 // Key returns the unique object key for storage in the database.
@@ -25,35 +33,62 @@ func (m Music) Key() string {
 }
 
 // String provides a standard interface to print Music to output.
+// The last listen and plays are only printed if they are set.
 func (m Music) String() string {
-	return fmt.Sprintf(`id: %s
+	year := "unknown"
+	if m.YearMade != 0 {
+		year = strconv.Itoa(m.YearMade)
+	}
+
+	s := fmt.Sprintf(`id: %s
   title:  %s
   artist: %s
-  year:   %d
-  date:	  %s`, m.ID, m.Title, m.Artist, m.YearMade, time.Unix(m.DateListened, 0).Format("2006-01-02"))
+  year:   %s
+  date:	  %s`, m.ID, m.Title, m.Artist, year, time.Unix(m.DateListened, 0).Format("2006-01-02"))
+
+	if m.LastListened != 0 {
+		s += fmt.Sprintf("\n  last:   %s", time.Unix(m.LastListened, 0).Format("2006-01-02"))
+	}
+	if m.Plays != 0 {
+		s += fmt.Sprintf("\n  plays:  %d", m.Plays)
+	}
+
+	return s
 }
 
 // NewMusic validates the given inputs and returns a pointer to a Music type.
 // The dateListened parameter should be in the format 'yyyy-mm-dd'.
-// If there are validation problems, a non-nil error is returned.
+// If there are validation problems, a *ValidationError is returned.
 func NewMusic(title, artist string, yearMade int, dateListened string) (*Music, error) {
+	if yearMade < 1 {
+		return nil, newValidationError("year", "must be positive, got %d", yearMade)
+	}
+
+	return newMusic(title, artist, yearMade, dateListened)
+}
+
+// NewMusicWithUnknownYear validates the given inputs in the same way as
+// NewMusic and returns a pointer to a Music type whose year is not known,
+// such as music read from a listening history.
+func NewMusicWithUnknownYear(title, artist, dateListened string) (*Music, error) {
+	return newMusic(title, artist, 0, dateListened)
+}
+
+// newMusic validates the inputs of NewMusic other than the year.
+func newMusic(title, artist string, yearMade int, dateListened string) (*Music, error) {
 	trim := strings.TrimSpace
 
 	title = trim(title)
 	if title == "" {
-		return nil, fmt.Errorf("title cannot be null, got %q", title)
+		return nil, newValidationError("title", "cannot be null, got %q", title)
 	}
 
 	artist = trim(artist)
 	if artist == "" {
-		return nil, fmt.Errorf("artist cannot be null, got %q", artist)
-	}
-
-	if yearMade < 1 {
-		return nil, fmt.Errorf("yearMade must be positive, got %d", yearMade)
+		return nil, newValidationError("artist", "cannot be null, got %q", artist)
 	}
 
-	unixTime, err := StringToUnixTime(trim(dateListened))
+	unixTime, err := validateDate("date", trim(dateListened))
 	if err != nil {
 		return nil, err
 	}
@@ -66,3 +101,27 @@ func NewMusic(title, artist string, yearMade int, dateListened string) (*Music,
 		DateListened: unixTime,
 	}, nil
 }
+
+// ValidatePlays returns a *ValidationError if plays is not a valid number
+// of plays of Music, which is zero for music not imported from a listening
+// history.
+func ValidatePlays(plays int) error {
+	if plays < 0 {
+		return newValidationError("plays", "cannot be negative, got %d", plays)
+	}
+
+	return nil
+}
+
+// ParseLastListened converts the date of the last listen of Music, in the
+// format 'yyyy-mm-dd', to a Unix timestamp. The empty string "" is zero,
+// for music not imported from a listening history. If the date is not
+// valid, a *ValidationError is returned.
+func ParseLastListened(date string) (int64, error) {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return 0, nil
+	}
+
+	return validateDate("last", date)
+}
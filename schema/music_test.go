@@ -1,9 +1,11 @@
 package schema
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -18,6 +20,7 @@ type newMusicInput struct {
 type newMusicOutput struct {
 	music   *Music
 	isError bool
+	field   string
 }
 
 func TestNewMusic(tt *testing.T) {
@@ -29,27 +32,27 @@ func TestNewMusic(tt *testing.T) {
 		{
 			"basic",
 			newMusicInput{"a title", "an artist", 2000, "2021-03-14"},
-			newMusicOutput{&Music{}, false},
+			newMusicOutput{&Music{}, false, ""},
 		},
 		{
 			"empty title",
 			newMusicInput{"", "an artist", 2000, "2021-03-14"},
-			newMusicOutput{nil, true},
+			newMusicOutput{nil, true, "title"},
 		},
 		{
 			"empty artist",
 			newMusicInput{"a title", "\t  \t\n", 2000, "2021-03-14"},
-			newMusicOutput{nil, true},
+			newMusicOutput{nil, true, "artist"},
 		},
 		{
 			"invalid year",
 			newMusicInput{"a title", "an artist", -100, "2021-03-14"},
-			newMusicOutput{nil, true},
+			newMusicOutput{nil, true, "year"},
 		},
 		{
 			"invalid date",
 			newMusicInput{"a title", "an artist", 2000, "2021-17-14"},
-			newMusicOutput{nil, true},
+			newMusicOutput{nil, true, "date"},
 		},
 	}
 
@@ -63,8 +66,12 @@ func TestNewMusic(tt *testing.T) {
 			}
 
 			if test.output.isError {
-				if err == nil {
-					subtt.Fatal("want error, got nil")
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					subtt.Fatalf("want *ValidationError, got %v", err)
+				}
+				if test.output.field != validationErr.Field {
+					subtt.Fatalf("want invalid field %s, got %s", test.output.field, validationErr.Field)
 				}
 				return
 			} else if err != nil {
@@ -93,3 +100,49 @@ func TestNewMusic(tt *testing.T) {
 		})
 	}
 }
+
+func TestParseLastListened(tt *testing.T) {
+	testCases := []struct {
+		date    string
+		want    int64
+		isError bool
+	}{
+		{"", 0, false},
+		{"2021-03-04", time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC).Unix(), false},
+		{"last week", 0, true},
+	}
+
+	for _, test := range testCases {
+		got, err := ParseLastListened(test.date)
+
+		if test.isError {
+			if err == nil {
+				tt.Fatalf("for date %q, want error, got nil", test.date)
+			}
+			continue
+		} else if err != nil {
+			tt.Fatal(err)
+		}
+
+		if got != test.want {
+			tt.Fatalf("for date %q, want %d, got %d", test.date, test.want, got)
+		}
+	}
+
+	if err := ValidatePlays(-1); err == nil {
+		tt.Fatal("for -1 plays, want error, got nil")
+	}
+}
+
+func TestMusicString(tt *testing.T) {
+	music := Music{ID: "123", Title: "a title", Artist: "an artist", YearMade: 2000}
+	if got := music.String(); strings.Contains(got, "last") || strings.Contains(got, "plays") {
+		tt.Fatalf("want no last listen or plays, got %q", got)
+	}
+
+	music.LastListened = 86400 * 365
+	music.Plays = 12
+	if got := music.String(); !strings.Contains(got, "\n  last:   ") || !strings.Contains(got, "\n  plays:  12") {
+		tt.Fatalf("want last listen and plays, got %q", got)
+	}
+}
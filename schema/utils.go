@@ -2,6 +2,7 @@ package schema
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -23,23 +24,82 @@ func getUnknownKey() string {
 	return "unknown"
 }
 
-// GetBaseKeyFromMediaType returns the base key string associated
-// with a particular type of media. A concrete media type appends
-// a UUID onto this base key with its Key() method before storage
-// in the database.
-func GetBaseKeyFromMediaType(media Media) string {
-	var typeKey string
+func getIndexKey() string {
+	return "index"
+}
+
+func getTrashKey() string {
+	return "trash"
+}
 
+func getTypeKey(media Media) string {
 	switch media.(type) {
 	case Movie:
-		typeKey = getMovieKey()
+		return getMovieKey()
 	case Music:
-		typeKey = getMusicKey()
+		return getMusicKey()
 	default:
-		typeKey = getUnknownKey()
+		return getUnknownKey()
 	}
+}
+
+// GetRootKey returns the key that the keys of every object
+// in the database begin with. For example, media
+func GetRootKey() string {
+	return getMediaKey()
+}
+
+// GetMediaTypeName returns the name of a particular type of media,
+// such as movie or music.
+func GetMediaTypeName(media Media) string {
+	return getTypeKey(media)
+}
+
+// GetMediaTypeFromName returns a concrete type that implements the media
+// interface given the name of a type of media, such as movie or music. It
+// returns a non-nil error if the name is not a valid type of media.
+func GetMediaTypeFromName(name string) (Media, error) {
+	for _, media := range GetAllMediaTypes() {
+		if GetMediaTypeName(media) == name {
+			return media, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%q is not a valid media type", name)
+}
 
-	return strings.Join([]string{getMediaKey(), typeKey}, "/")
+// GetAllMediaTypes returns a slice containing the zero
+// value of every concrete type of media in the database.
+func GetAllMediaTypes() []Media {
+	return []Media{Movie{}, Music{}}
+}
+
+// GetBaseKeyFromMediaType returns the base key string associated
+// with a particular type of media. A concrete media type appends
+// a UUID onto this base key with its Key() method before storage
+// in the database.
+func GetBaseKeyFromMediaType(media Media) string {
+	return strings.Join([]string{getMediaKey(), getTypeKey(media)}, "/")
+}
+
+// GetIndexKeyFromMediaType returns the key of the index object that
+// contains every entry of a particular type of media in the database.
+// For example, media/index/movie
+func GetIndexKeyFromMediaType(media Media) string {
+	return strings.Join([]string{getMediaKey(), getIndexKey(), getTypeKey(media)}, "/")
+}
+
+// GetTrashKeyFromMediaType returns the base key under which deleted entries
+// of a particular type of media are kept until they are purged.
+// For example, media/trash/movie
+func GetTrashKeyFromMediaType(media Media) string {
+	return strings.Join([]string{getMediaKey(), getTrashKey(), getTypeKey(media)}, "/")
+}
+
+// GetIDFromKey returns the id portion of a media entry key.
+// For example, the id of media/movie/<id> is <id>.
+func GetIDFromKey(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
 }
 
 // GetMediaTypeFromKey returns a concrete type that implements the media interface
@@ -102,3 +162,137 @@ func StringToUnixTime(s string) (int64, error) {
 
 	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Unix(), nil
 }
+
+// FieldChange is a change to the value of a single field of a media entry.
+// Old is the empty string "" for a field that was added, and New is the
+// empty string "" for a field that was removed.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// field is the name and value of a single field of a media entry.
+type field struct {
+	name  string
+	value string
+}
+
+// getFields returns the fields of media in the order they are printed,
+// with the names used in the stored data. Dates are yyyy-mm-dd in UTC,
+// which is the time zone that they are stored in. The optional fields,
+// such as the rating of a movie, are left out when they are not set.
+func getFields(media Media) []field {
+	formatDate := func(unixTime int64) string {
+		return time.Unix(unixTime, 0).UTC().Format("2006-01-02")
+	}
+
+	fields := make([]field, 0)
+
+	switch m := media.(type) {
+	case Movie:
+		fields = append(fields,
+			field{"id", m.ID},
+			field{"title", m.Title},
+			field{"director", m.Director},
+			field{"year", strconv.Itoa(m.YearMade)},
+			field{"date", formatDate(m.DateWatched)},
+		)
+		if m.Rating != 0 {
+			fields = append(fields, field{"rating", strconv.FormatFloat(m.Rating, 'f', -1, 64)})
+		}
+		if m.Rewatch {
+			fields = append(fields, field{"rewatch", strconv.FormatBool(m.Rewatch)})
+		}
+	case Music:
+		fields = append(fields,
+			field{"id", m.ID},
+			field{"title", m.Title},
+			field{"artist", m.Artist},
+		)
+		if m.YearMade != 0 {
+			fields = append(fields, field{"year", strconv.Itoa(m.YearMade)})
+		}
+		fields = append(fields, field{"date", formatDate(m.DateListened)})
+		if m.LastListened != 0 {
+			fields = append(fields, field{"last", formatDate(m.LastListened)})
+		}
+		if m.Plays != 0 {
+			fields = append(fields, field{"plays", strconv.Itoa(m.Plays)})
+		}
+	}
+
+	return fields
+}
+
+// DiffFields compares two versions of a media entry field by field and
+// returns the fields whose values differ, in the order that the fields
+// are printed. Either version may be nil, for an entry that did not exist.
+func DiffFields(oldMedia, newMedia Media) []FieldChange {
+	oldFields, newFields := getFields(oldMedia), getFields(newMedia)
+
+	oldValues := make(map[string]string, len(oldFields))
+	for _, f := range oldFields {
+		oldValues[f.name] = f.value
+	}
+	newValues := make(map[string]string, len(newFields))
+	for _, f := range newFields {
+		newValues[f.name] = f.value
+	}
+
+	changes := make([]FieldChange, 0)
+	for _, f := range newFields {
+		if oldValue := oldValues[f.name]; oldValue != f.value {
+			changes = append(changes, FieldChange{Field: f.name, Old: oldValue, New: f.value})
+		}
+	}
+	for _, f := range oldFields {
+		if _, ok := newValues[f.name]; !ok {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.value})
+		}
+	}
+
+	return changes
+}
+
+// KeepFields returns media with the named fields copied from stored, so
+// that an update can leave the fields it does not set as they are. The
+// names are those used in the stored data, such as "rating". It returns a
+// non-nil error if media and stored are not the same type of media or a
+// field cannot be kept.
+func KeepFields(media, stored Media, fields []string) (Media, error) {
+	if reflect.TypeOf(media) != reflect.TypeOf(stored) {
+		return nil, fmt.Errorf("cannot keep the fields of %T in %T", stored, media)
+	}
+
+	for _, field := range fields {
+		switch m := media.(type) {
+		case Movie:
+			s := stored.(Movie)
+			switch field {
+			case "rating":
+				m.Rating = s.Rating
+			case "rewatch":
+				m.Rewatch = s.Rewatch
+			default:
+				return nil, fmt.Errorf("cannot keep the %q field of a movie", field)
+			}
+			media = m
+		case Music:
+			s := stored.(Music)
+			switch field {
+			case "plays":
+				m.Plays = s.Plays
+			case "last":
+				m.LastListened = s.LastListened
+			default:
+				return nil, fmt.Errorf("cannot keep the %q field of music", field)
+			}
+			media = m
+		default:
+			return nil, fmt.Errorf("cannot keep the %q field of %T", field, media)
+		}
+	}
+
+	return media, nil
+}
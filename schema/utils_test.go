@@ -26,6 +26,67 @@ func TestGetBaseKeyFromMediaType(tt *testing.T) {
 	}
 }
 
+func TestGetIndexKeyFromMediaType(tt *testing.T) {
+	testCases := []struct {
+		media Media
+		want  string
+	}{
+		{Movie{}, getMediaKey() + "/" + getIndexKey() + "/" + getMovieKey()},
+		{Music{}, getMediaKey() + "/" + getIndexKey() + "/" + getMusicKey()},
+	}
+
+	for _, test := range testCases {
+		if got := GetIndexKeyFromMediaType(test.media); test.want != got {
+			tt.Fatalf("for type %T, want %s, got %s", test.media, test.want, got)
+		}
+
+		// An index key must never be mistaken for a media entry key.
+		if _, err := GetMediaTypeFromKey(GetIndexKeyFromMediaType(test.media)); err == nil {
+			tt.Fatalf("for type %T, want error, got nil", test.media)
+		}
+	}
+}
+
+func TestGetTrashKeyFromMediaType(tt *testing.T) {
+	testCases := []struct {
+		media Media
+		want  string
+	}{
+		{Movie{}, getMediaKey() + "/" + getTrashKey() + "/" + getMovieKey()},
+		{Music{}, getMediaKey() + "/" + getTrashKey() + "/" + getMusicKey()},
+	}
+
+	for _, test := range testCases {
+		if got := GetTrashKeyFromMediaType(test.media); test.want != got {
+			tt.Fatalf("for type %T, want %s, got %s", test.media, test.want, got)
+		}
+
+		// A deleted entry must never be mistaken for a media entry.
+		if _, err := GetMediaTypeFromKey(GetTrashKeyFromMediaType(test.media) + "/" + uuid.NewString()); err == nil {
+			tt.Fatalf("for type %T, want error, got nil", test.media)
+		}
+	}
+}
+
+func TestGetIDFromKey(tt *testing.T) {
+	id := uuid.NewString()
+
+	testCases := []struct {
+		key  string
+		want string
+	}{
+		{Movie{ID: id}.Key(), id},
+		{Music{ID: id}.Key(), id},
+		{id, id},
+	}
+
+	for _, test := range testCases {
+		if got := GetIDFromKey(test.key); test.want != got {
+			tt.Fatalf("want %s, got %s", test.want, got)
+		}
+	}
+}
+
 func TestGetMediaTypeFromKey(tt *testing.T) {
 	testCases := []struct {
 		key     string
@@ -55,6 +116,39 @@ func TestGetMediaTypeFromKey(tt *testing.T) {
 	}
 }
 
+func TestGetMediaTypeFromName(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		want    Media
+		isError bool
+	}{
+		{getMovieKey(), Movie{}, false},
+		{getMusicKey(), Music{}, false},
+		{getUnknownKey(), nil, true},
+		{"", nil, true},
+	}
+
+	for _, test := range testCases {
+		got, err := GetMediaTypeFromName(test.name)
+
+		if test.isError {
+			if err == nil {
+				tt.Fatal("want error, got nil")
+			}
+		} else if err != nil {
+			tt.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(test.want, got) {
+			tt.Fatalf("want %v, got %v", test.want, got)
+		}
+
+		if !test.isError && GetMediaTypeName(got) != test.name {
+			tt.Fatalf("want name %s, got %s", test.name, GetMediaTypeName(got))
+		}
+	}
+}
+
 func TestStringToUnixTime(tt *testing.T) {
 	testCases := []struct {
 		input   string
@@ -101,3 +195,112 @@ func TestStringToUnixTime(tt *testing.T) {
 		})
 	}
 }
+
+func TestDiffFields(tt *testing.T) {
+	oldMovie := Movie{
+		ID:          "123",
+		Title:       "A Title",
+		Director:    "A Director",
+		YearMade:    1999,
+		DateWatched: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC).Unix(),
+	}
+
+	newMovie := oldMovie
+	newMovie.Title = "A New Title"
+	newMovie.DateWatched = time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC).Unix()
+
+	formatDate := func(unixTime int64) string {
+		return time.Unix(unixTime, 0).UTC().Format("2006-01-02")
+	}
+
+	// Titles can contain anything that is part of the printed format.
+	awkwardMovie := oldMovie
+	awkwardMovie.Title = "A Title:\n  director: Someone Else"
+	awkwardMovie.Rating = 3.5
+
+	testCases := []struct {
+		name     string
+		oldMedia Media
+		newMedia Media
+		want     []FieldChange
+	}{
+		{"unchanged", oldMovie, oldMovie, []FieldChange{}},
+		{"changed", oldMovie, newMovie, []FieldChange{
+			{Field: "title", Old: "A Title", New: "A New Title"},
+			{Field: "date", Old: formatDate(oldMovie.DateWatched), New: formatDate(newMovie.DateWatched)},
+		}},
+		{"awkward-title", oldMovie, awkwardMovie, []FieldChange{
+			{Field: "title", Old: "A Title", New: "A Title:\n  director: Someone Else"},
+			{Field: "rating", New: "3.5"},
+		}},
+		{"unknown-year", Music{ID: "456", YearMade: 2001}, Music{ID: "456", Plays: 3}, []FieldChange{
+			{Field: "plays", New: "3"},
+			{Field: "year", Old: "2001"},
+		}},
+		{"created", nil, Music{ID: "456", Title: "A Title", Artist: "An Artist", YearMade: 2001, DateListened: 0}, []FieldChange{
+			{Field: "id", New: "456"},
+			{Field: "title", New: "A Title"},
+			{Field: "artist", New: "An Artist"},
+			{Field: "year", New: "2001"},
+			{Field: "date", New: formatDate(0)},
+		}},
+		{"deleted", oldMovie, nil, []FieldChange{
+			{Field: "id", Old: "123"},
+			{Field: "title", Old: "A Title"},
+			{Field: "director", Old: "A Director"},
+			{Field: "year", Old: "1999"},
+			{Field: "date", Old: formatDate(oldMovie.DateWatched)},
+		}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			if got := DiffFields(test.oldMedia, test.newMedia); !reflect.DeepEqual(test.want, got) {
+				subtt.Fatalf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestKeepFields(tt *testing.T) {
+	storedMovie := Movie{ID: "123", Title: "A Title", Director: "A Director", YearMade: 1999, Rating: 4.5, Rewatch: true}
+	updatedMovie := Movie{ID: "123", Title: "A New Title", Director: "A Director", YearMade: 1999, Rating: 3}
+	storedMusic := Music{ID: "456", Title: "A Song", Artist: "An Artist", YearMade: 2001, Plays: 12, LastListened: 1620000000}
+	updatedMusic := Music{ID: "456", Title: "A New Song", Artist: "An Artist", YearMade: 2001}
+
+	testCases := []struct {
+		name    string
+		media   Media
+		stored  Media
+		fields  []string
+		want    Media
+		isError bool
+	}{
+		{"none", updatedMovie, storedMovie, nil, updatedMovie, false},
+		{"rating", updatedMovie, storedMovie, []string{"rating"}, Movie{ID: "123", Title: "A New Title", Director: "A Director", YearMade: 1999, Rating: 4.5}, false},
+		{"rating-rewatch", updatedMovie, storedMovie, []string{"rating", "rewatch"}, Movie{ID: "123", Title: "A New Title", Director: "A Director", YearMade: 1999, Rating: 4.5, Rewatch: true}, false},
+		{"plays-last", updatedMusic, storedMusic, []string{"plays", "last"}, Music{ID: "456", Title: "A New Song", Artist: "An Artist", YearMade: 2001, Plays: 12, LastListened: 1620000000}, false},
+		{"unknown-movie-field", updatedMovie, storedMovie, []string{"title"}, nil, true},
+		{"unknown-music-field", updatedMusic, storedMusic, []string{"rating"}, nil, true},
+		{"different-type", updatedMusic, storedMovie, []string{"rating"}, nil, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			got, err := KeepFields(test.media, test.stored, test.fields)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				subtt.Fatalf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// getSchemaVersionField returns the name of the field in every stored
+// document that holds the version of the document format.
+func getSchemaVersionField() string {
+	return "schema"
+}
+
+// Document is a stored media document decoded into its fields. The value of
+// each field is left as JSON, so that an upgrade only changes the fields
+// that it is about, and every other field is kept exactly as it was.
+type Document map[string]json.RawMessage
+
+// upgradeFunc changes a Document for the given type of media from one
+// version of the document format to the next.
+type upgradeFunc func(mediaType Media, doc Document) error
+
+// getUpgrades returns the upgrade from each version of the document format
+// to the next, in order, so that the upgrade at index i changes a document
+// from version i to version i+1. Version 0 is a document written before
+// the format had versions. The format is changed by adding an upgrade to
+// the end of the list, and is never changed in any other way.
+func getUpgrades() []upgradeFunc {
+	return []upgradeFunc{
+		// Version 1 added the version field, and nothing else changed.
+		func(mediaType Media, doc Document) error {
+			return nil
+		},
+	}
+}
+
+// GetSchemaVersion returns the current version of the
+// format that media documents are stored in.
+func GetSchemaVersion() int {
+	return len(getUpgrades())
+}
+
+// MarshalMedia returns the JSON document to store for the given media,
+// with the version field set to the current version.
+func MarshalMedia(media Media) ([]byte, error) {
+	jsonData, err := json.Marshal(media)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jsonData) < 2 || jsonData[0] != '{' {
+		return nil, fmt.Errorf("media must be stored as a JSON object, got %s", jsonData)
+	}
+
+	// The version goes first, and the other fields keep their order.
+	versionField := fmt.Sprintf("{%q:%d", getSchemaVersionField(), GetSchemaVersion())
+	if jsonData[1] != '}' {
+		versionField += ","
+	}
+
+	return append([]byte(versionField), jsonData[1:]...), nil
+}
+
+// getDocumentVersion returns the version of the document format of doc,
+// which is 0 if it has no version field.
+func getDocumentVersion(doc Document) (int, error) {
+	versionData, ok := doc[getSchemaVersionField()]
+	if !ok {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(versionData))
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("document version must be a non-negative integer, got %s", versionData)
+	}
+
+	return version, nil
+}
+
+// GetDocumentVersion returns the version of the document format of the
+// stored JSON document in jsonData, which is 0 if it has no version. It
+// returns a non-nil error if jsonData is not a valid document.
+func GetDocumentVersion(jsonData []byte) (int, error) {
+	doc := Document{}
+	err := json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		return 0, err
+	}
+
+	return getDocumentVersion(doc)
+}
+
+// UpgradeDocument changes the stored JSON document in jsonData, for the
+// given type of media, to the current version of the document format by
+// applying each upgrade from its version in turn. A document that is
+// already the current version is returned unchanged. It returns a non-nil
+// error if jsonData is not a valid document, or if its version is newer
+// than the current version, which means it was written by a newer release.
+func UpgradeDocument(mediaType Media, jsonData []byte) ([]byte, error) {
+	return upgradeDocument(mediaType, jsonData, getUpgrades())
+}
+
+// upgradeDocument is UpgradeDocument with the given upgrades,
+// where the current version is the number of upgrades.
+func upgradeDocument(mediaType Media, jsonData []byte, upgrades []upgradeFunc) ([]byte, error) {
+	doc := Document{}
+	err := json.Unmarshal(jsonData, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := getDocumentVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch currentVersion := len(upgrades); {
+	case version == currentVersion:
+		return jsonData, nil
+	case version > currentVersion:
+		return nil, fmt.Errorf("document version %d is newer than the latest version %d, upgrade media-db to read it", version, currentVersion)
+	}
+
+	for _, upgrade := range upgrades[version:] {
+		err = upgrade(mediaType, doc)
+		if err != nil {
+			return nil, fmt.Errorf("upgrading document from version %d: %w", version, err)
+		}
+		version++
+	}
+
+	doc[getSchemaVersionField()] = json.RawMessage(strconv.Itoa(version))
+
+	return json.Marshal(doc)
+}
@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalMedia(tt *testing.T) {
+	movie := Movie{ID: "123", Title: "a title", Director: "a director", YearMade: 2000, DateWatched: 1609459200}
+
+	got, err := MarshalMedia(movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	want := `{"schema":1,"id":"123","title":"a title","director":"a director","year":2000,"date":1609459200}`
+	if want != string(got) {
+		tt.Fatalf("want %s, got %s", want, got)
+	}
+
+	version, err := GetDocumentVersion(got)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if version != GetSchemaVersion() {
+		tt.Fatalf("want version %d, got %d", GetSchemaVersion(), version)
+	}
+
+	// The version field is ignored when the document is decoded.
+	decoded := Movie{}
+	err = json.Unmarshal(got, &decoded)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(movie, decoded) {
+		tt.Fatalf("want %v, got %v", movie, decoded)
+	}
+}
+
+func TestUpgradeDocument(tt *testing.T) {
+	// A rename of the date field in version 2, only for movies.
+	upgrades := []upgradeFunc{
+		getUpgrades()[0],
+		func(mediaType Media, doc Document) error {
+			if _, ok := mediaType.(Movie); !ok {
+				return nil
+			}
+			if _, ok := doc["watched"]; !ok {
+				return errors.New("missing watched date")
+			}
+			doc["date"] = doc["watched"]
+			delete(doc, "watched")
+			return nil
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		mediaType Media
+		input     string
+		want      string
+		isError   bool
+	}{
+		{"unversioned", Movie{}, `{"id":"123","watched":1609459200}`, `{"date":1609459200,"id":"123","schema":2}`, false},
+		{"version-1", Movie{}, `{"schema":1,"id":"123","watched":1609459200}`, `{"date":1609459200,"id":"123","schema":2}`, false},
+		{"current", Movie{}, `{"schema":2,"id":"123","date":1609459200}`, `{"schema":2,"id":"123","date":1609459200}`, false},
+		{"other-type", Music{}, `{"id":"123","date":1609459200}`, `{"date":1609459200,"id":"123","schema":2}`, false},
+		{"newer", Movie{}, `{"schema":3,"id":"123","date":1609459200}`, "", true},
+		{"invalid-version", Movie{}, `{"schema":"one","id":"123"}`, "", true},
+		{"failed-upgrade", Movie{}, `{"schema":1,"id":"123"}`, "", true},
+		{"invalid-json", Movie{}, `{"id":`, "", true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			got, err := upgradeDocument(test.mediaType, []byte(test.input), upgrades)
+
+			if test.isError {
+				if err == nil {
+					subtt.Fatal("want error, got nil")
+				}
+				return
+			} else if err != nil {
+				subtt.Fatal(err)
+			}
+
+			if test.want != string(got) {
+				subtt.Fatalf("want %s, got %s", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	cfg "github.com/alexpcook/media-db/config"
+)
+
+var (
+	// ErrNotFound is returned, possibly wrapped, by a Backend
+	// when there is no object stored under a key.
+	ErrNotFound = errors.New("not found")
+
+	// ErrPreconditionFailed is returned, possibly wrapped, by a Backend when
+	// a conditional request is made and the object stored under the key does
+	// not have the expected ETag.
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrVersioningUnsupported is returned, possibly wrapped, when the
+	// previous versions of an object are requested from a Backend that
+	// does not keep them.
+	ErrVersioningUnsupported = errors.New("the backend does not keep previous versions of objects")
+)
+
+// Backend defines the storage operations that the database is built on.
+// Objects are addressed by slash-separated keys such as media/movie/<id>.
+// Every object has an ETag, an opaque string that changes whenever the
+// object changes, which is used to make conditional requests.
+type Backend interface {
+	// Put stores data under key and returns the ETag of the new object. If
+	// ifMatch is the empty string "", any existing object is replaced. If
+	// it is getNoObjectETag(), the object is only stored if there is no
+	// object under key. Otherwise, the object is only replaced if its current
+	// ETag is ifMatch. ErrPreconditionFailed is returned if the condition
+	// does not hold.
+	Put(ctx context.Context, key string, data []byte, ifMatch string) (string, error)
+
+	// Get returns the data stored under key and its ETag. It returns
+	// ErrNotFound if there is no object stored under key.
+	Get(ctx context.Context, key string) ([]byte, string, error)
+
+	// List returns up to maxKeys keys of objects that begin with prefix, in
+	// lexical order, resuming after the position encoded in token. The empty
+	// token starts from the first key. The returned token resumes listing
+	// after the last returned key, and is "" when there are no more keys.
+	List(ctx context.Context, prefix, token string, maxKeys int) ([]string, string, error)
+
+	// Head returns the ETag of the object stored under key. It returns
+	// ErrNotFound if there is no object stored under key.
+	Head(ctx context.Context, key string) (string, error)
+
+	// LastModified returns the time that the object stored under key was
+	// last written. It returns ErrNotFound if there is no object stored
+	// under key.
+	LastModified(ctx context.Context, key string) (time.Time, error)
+
+	// Delete removes the object stored under key. If ifMatch is not the
+	// empty string "", the object is only removed if its current ETag is
+	// ifMatch, and ErrPreconditionFailed is returned if it is not.
+	Delete(ctx context.Context, key string, ifMatch string) error
+}
+
+// ObjectVersion describes a single stored version of an object.
+type ObjectVersion struct {
+	ID           string
+	LastModified time.Time
+	IsLatest     bool
+
+	// IsDeleteMarker is true for a version that records the object being
+	// deleted. There is no data stored for a delete marker.
+	IsDeleteMarker bool
+}
+
+// VersionedBackend is a Backend that keeps the previous versions of an
+// object when it is replaced or deleted, such as an S3 bucket with
+// versioning enabled.
+type VersionedBackend interface {
+	Backend
+
+	// ListVersions returns every version of the object stored under key,
+	// from the most recent to the oldest. It returns an empty slice if
+	// there has never been an object stored under key.
+	ListVersions(ctx context.Context, key string) ([]ObjectVersion, error)
+
+	// GetVersion returns the data of the given version of the object stored
+	// under key. It returns ErrNotFound if there is no such version.
+	GetVersion(ctx context.Context, key, versionID string) ([]byte, error)
+}
+
+// NewBackend returns the storage backend selected by the given MediaDbConfig.
+// It returns a non-nil error if the backend type is unknown or the backend
+// cannot be initialized.
+func NewBackend(mediaDbConfig *cfg.MediaDbConfig) (Backend, error) {
+	switch backendType := mediaDbConfig.BackendType(); backendType {
+	case cfg.S3BackendType():
+		return newS3Backend(mediaDbConfig)
+	case cfg.LocalBackendType():
+		return newLocalBackend(mediaDbConfig)
+	default:
+		return nil, fmt.Errorf("backend %q is not a supported backend type", backendType)
+	}
+}
+
+// getMaxPageSize returns the largest number of keys that
+// a backend will return in a single call to List.
+func getMaxPageSize() int {
+	return 1000
+}
+
+// listAllKeys follows the continuation tokens returned by the backend
+// to list every key that begins with prefix.
+func listAllKeys(ctx context.Context, backend Backend, prefix string) ([]string, error) {
+	allKeys := make([]string, 0)
+	token := ""
+
+	for {
+		keys, nextToken, err := backend.List(ctx, prefix, token, getMaxPageSize())
+		if err != nil {
+			return nil, err
+		}
+		allKeys = append(allKeys, keys...)
+
+		if nextToken == "" {
+			return allKeys, nil
+		}
+		token = nextToken
+	}
+}
+
+// getNoObjectETag returns the ifMatch value of a conditional request that
+// only succeeds if there is no object stored under the key, in the same
+// way as an If-None-Match: * header.
+func getNoObjectETag() string {
+	return "*"
+}
+
+// checkETag returns ErrPreconditionFailed if the ETag of the object
+// stored under key is not eTag, or ErrNotFound if there is no object. If
+// eTag is getNoObjectETag(), it returns ErrPreconditionFailed if there is
+// an object instead.
+func checkETag(ctx context.Context, backend Backend, key, eTag string) error {
+	currentETag, err := backend.Head(ctx, key)
+	if eTag == getNoObjectETag() {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return nil
+		case err == nil:
+			return fmt.Errorf("%w: %s already exists", ErrPreconditionFailed, key)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if currentETag != eTag {
+		return fmt.Errorf("%w: %s has ETag %s, want %s", ErrPreconditionFailed, key, currentETag, eTag)
+	}
+
+	return nil
+}
+
+// computeETag returns the hex-encoded MD5 hash of data, which is the ETag
+// that S3 gives an object uploaded in a single request.
+func computeETag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// unquoteETag removes the double quotes that HTTP places around an ETag.
+func unquoteETag(eTag string) string {
+	return strings.Trim(eTag, `"`)
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// getBackupPrefix returns the prefix of the keys of every object that is
+// part of the database, which are the objects captured in a backup.
+func getBackupPrefix() string {
+	return schema.GetRootKey() + "/"
+}
+
+// getManifestName returns the name of the manifest file in a backup archive.
+func getManifestName() string {
+	return "manifest.json"
+}
+
+// getArchiveObjectsDir returns the directory that holds the objects in a
+// backup archive. Each object is stored under its key in the directory.
+func getArchiveObjectsDir() string {
+	return "objects"
+}
+
+// getBackupVersion returns the version of the backup archive format.
+func getBackupVersion() int {
+	return 1
+}
+
+// backupManifest describes the contents of a backup archive.
+type backupManifest struct {
+	Version int                    `json:"version"`
+	Created int64                  `json:"created"`
+	Objects []backupManifestObject `json:"objects"`
+}
+
+// backupManifestObject describes a single object in a backup archive.
+// SHA256 is the hex-encoded SHA-256 checksum of the object's data.
+type backupManifestObject struct {
+	Key    string `json:"key"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// checksum returns the hex-encoded SHA-256 checksum of data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Backup writes every object in the database to w as a gzipped tar
+// archive, including deleted entries in the trash. The objects are read a
+// few at a time and written to the archive as they are read, so the
+// database is never held in memory at once. The archive ends with a
+// manifest that lists the key, size, and checksum of each object. The
+// objects are backed up as they are stored, so the entries of an encrypted
+// database stay encrypted in the archive. It returns the number of objects
+// backed up and a non-nil error if the database cannot be read or the
+// archive cannot be written.
+func (cl *MediaDbClient) Backup(ctx context.Context, w io.Writer) (int, error) {
+	rawBackend := unwrapBackend(cl.backend)
+
+	keys, err := listAllKeys(ctx, rawBackend, getBackupPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	manifest := backupManifest{
+		Version: getBackupVersion(),
+		Created: time.Now().Unix(),
+		Objects: make([]backupManifestObject, 0, len(keys)),
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Unix(manifest.Created, 0)
+
+	writeFile := func(name string, data []byte) error {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: modTime,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tarWriter.Write(data)
+		return err
+	}
+
+	for start := 0; start < len(keys); start += cl.concurrency {
+		batch := keys[start:]
+		if len(batch) > cl.concurrency {
+			batch = batch[:cl.concurrency]
+		}
+
+		objects := make([][]byte, len(batch))
+		err = cl.runConcurrently(ctx, len(batch), func(ctx context.Context, i int) error {
+			data, _, err := rawBackend.Get(ctx, batch[i])
+			objects[i] = data
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for i, key := range batch {
+			err = writeFile(path.Join(getArchiveObjectsDir(), key), objects[i])
+			if err != nil {
+				return 0, err
+			}
+
+			manifest.Objects = append(manifest.Objects, backupManifestObject{
+				Key:    key,
+				Size:   len(objects[i]),
+				SHA256: checksum(objects[i]),
+			})
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	err = writeFile(getManifestName(), manifestData)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(keys), gzipWriter.Close()
+}
+
+// readBackup reads a backup archive written by Backup, calling object with
+// the key and data of each object in the order they are stored. Only one
+// object is held in memory at a time. Since the manifest may come after
+// the objects, each object is checked against the manifest once the whole
+// archive is read. It returns the manifest, and a non-nil error if the
+// archive is not valid, if any object is missing, unexpected, or does not
+// match its checksum, or if object returns one.
+func readBackup(r io.Reader, object func(key string, data []byte) error) (*backupManifest, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	var manifest *backupManifest
+	checksums := make(map[string]backupManifestObject)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Name == getManifestName() {
+			manifest = &backupManifest{}
+			err = json.Unmarshal(data, manifest)
+			if err != nil {
+				return nil, fmt.Errorf("the backup manifest is not valid: %w", err)
+			}
+			continue
+		}
+
+		key := strings.TrimPrefix(header.Name, getArchiveObjectsDir()+"/")
+		if key == header.Name || !strings.HasPrefix(key, getBackupPrefix()) || path.Clean(key) != key {
+			return nil, fmt.Errorf("the backup contains an unexpected file %s", header.Name)
+		}
+		if _, ok := checksums[key]; ok {
+			return nil, fmt.Errorf("the backup contains the object %s more than once", key)
+		}
+		checksums[key] = backupManifestObject{Key: key, Size: len(data), SHA256: checksum(data)}
+
+		err = object(key, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest == nil {
+		return nil, errors.New("the backup does not contain a manifest")
+	}
+	if manifest.Version != getBackupVersion() {
+		return nil, fmt.Errorf("the backup has format version %d, want %d", manifest.Version, getBackupVersion())
+	}
+
+	for _, obj := range manifest.Objects {
+		sum, ok := checksums[obj.Key]
+		if !ok {
+			return nil, fmt.Errorf("the backup is missing the object %s", obj.Key)
+		}
+		if sum != obj {
+			return nil, fmt.Errorf("the object %s in the backup does not match its checksum", obj.Key)
+		}
+	}
+	if len(checksums) != len(manifest.Objects) {
+		return nil, errors.New("the backup contains objects that are not in its manifest")
+	}
+
+	return manifest, nil
+}
+
+// RestoreMode selects what happens to the objects already in the database
+// when a backup is restored.
+type RestoreMode int
+
+const (
+	// RestoreIntoEmpty only restores a backup into a database with no
+	// entries, so that nothing in the database is changed.
+	RestoreIntoEmpty RestoreMode = iota
+
+	// RestoreMerge adds the objects in the backup that are not already in
+	// the database, and keeps the existing object wherever both have one.
+	RestoreMerge
+
+	// RestoreOverwrite adds every object in the backup, replacing the
+	// existing object wherever both have one. Objects in the database
+	// that are not in the backup are kept.
+	RestoreOverwrite
+)
+
+// RestoreResult summarizes a restore. Restored is the number of objects
+// written from the backup, and Skipped is the number that were already in
+// the database and kept.
+type RestoreResult struct {
+	Restored int
+	Skipped  int
+}
+
+// RestoreBackup restores the objects in a backup archive written by Backup
+// into the database, according to mode. The objects are written back
+// exactly as they were stored, so an encrypted backup can only be restored
+// into a database that uses the same key, and an unencrypted backup into
+// one that is not encrypted. The archive is read twice, one object at a
+// time: first to check every object against its checksum, and against the
+// key of the database, before anything is written, and then to write the
+// objects, checking each again in case the archive changed in between.
+// The indexes in the backup are not restored, and instead every index is
+// rebuilt once the entries are restored. It returns a non-nil error if the
+// archive is not valid, wrapping ErrDecryption if it does not match the
+// key of the database, if mode is RestoreIntoEmpty and the database is not
+// empty, or if any object cannot be restored, in which case the result
+// counts the objects that were restored before the error.
+func (cl *MediaDbClient) RestoreBackup(ctx context.Context, r io.ReadSeeker, mode RestoreMode) (RestoreResult, error) {
+	result := RestoreResult{}
+
+	manifest, err := readBackup(r, func(key string, data []byte) error {
+		_, err := readStoredData(cl.backend, key, data)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	checksums := make(map[string]string, len(manifest.Objects))
+	for _, obj := range manifest.Objects {
+		checksums[obj.Key] = obj.SHA256
+	}
+
+	rawBackend := unwrapBackend(cl.backend)
+
+	existingKeys, err := listAllKeys(ctx, rawBackend, getBackupPrefix())
+	if err != nil {
+		return result, err
+	}
+
+	existing := make(map[string]bool, len(existingKeys))
+	for _, key := range existingKeys {
+		if !isIndexKey(key) {
+			existing[key] = true
+		}
+	}
+
+	if mode == RestoreIntoEmpty && len(existing) != 0 {
+		return result, fmt.Errorf("the database is not empty, it has %d objects", len(existing))
+	}
+
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return result, err
+	}
+
+	keys := make([]string, 0, cl.concurrency)
+	objects := make([][]byte, 0, cl.concurrency)
+
+	// restoreBatch writes the objects read since the last batch.
+	restoreBatch := func() error {
+		isRestored := make([]bool, len(keys))
+		err := cl.runConcurrently(ctx, len(keys), func(ctx context.Context, i int) error {
+			_, err := rawBackend.Put(ctx, keys[i], objects[i], "")
+			isRestored[i] = err == nil
+			return err
+		})
+		for _, restored := range isRestored {
+			if restored {
+				result.Restored++
+			}
+		}
+
+		keys, objects = keys[:0], objects[:0]
+		return err
+	}
+
+	_, restoreErr := readBackup(r, func(key string, data []byte) error {
+		if checksum(data) != checksums[key] {
+			return fmt.Errorf("the object %s in the backup changed while it was restored", key)
+		}
+		if isIndexKey(key) {
+			return nil
+		}
+		if mode == RestoreMerge && existing[key] {
+			result.Skipped++
+			return nil
+		}
+
+		keys = append(keys, key)
+		objects = append(objects, data)
+		if len(keys) < cl.concurrency {
+			return nil
+		}
+		return restoreBatch()
+	})
+	if restoreErr == nil {
+		restoreErr = restoreBatch()
+	}
+	if result.Restored == 0 {
+		return result, restoreErr
+	}
+
+	// The index is rebuilt for the objects that were restored,
+	// even if the restore failed or ctx was cancelled.
+	_, err = cl.Reindex(detach(ctx))
+	if err != nil {
+		return result, indexUpdateError(err)
+	}
+
+	return result, restoreErr
+}
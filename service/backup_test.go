@@ -0,0 +1,362 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestBackup(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("restores into a second, empty database")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Backed Up Title", "A Director", 1999, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	music, err := schema.NewMusic("A Backed Up Title", "An Artist", 1977, "2021-06-02")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	deletedMovie, err := schema.NewMovie("A Deleted Title", "A Director", 2001, "2021-06-03")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	for _, media := range []schema.Media{movie, music, deletedMovie} {
+		err = client.Create(context.TODO(), media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	err = client.Delete(context.TODO(), deletedMovie.ID, *deletedMovie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	archive := new(bytes.Buffer)
+	numObjects, err := client.Backup(context.TODO(), archive)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Two entries, one entry in the trash, and an index for each type.
+	if numObjects != 5 {
+		tt.Fatalf("want 5 objects backed up, got %d", numObjects)
+	}
+
+	restoreClient, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	result, err := restoreClient.RestoreBackup(context.TODO(), bytes.NewReader(archive.Bytes()), RestoreIntoEmpty)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := (RestoreResult{Restored: 3}); result != want {
+		tt.Fatalf("want %+v, got %+v", want, result)
+	}
+
+	for _, client := range []*MediaDbClient{client, restoreClient} {
+		res, err := client.Read(context.TODO(), "", nil)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if want := []schema.Media{*movie, *music}; !reflect.DeepEqual(want, res) {
+			tt.Fatalf("want %v, got %v", want, res)
+		}
+
+		trashEntries, err := client.ReadTrash(context.TODO(), nil)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if len(trashEntries) != 1 || !reflect.DeepEqual(*deletedMovie, trashEntries[0].Media) {
+			tt.Fatalf("want %v in the trash, got %v", *deletedMovie, trashEntries)
+		}
+	}
+
+	_, err = restoreClient.RestoreBackup(context.TODO(), bytes.NewReader(archive.Bytes()), RestoreIntoEmpty)
+	if err == nil {
+		tt.Fatal("want error restoring into a database that is not empty, got nil")
+	}
+
+	updatedMovie := *movie
+	updatedMovie.Title = "An Updated Title"
+	err = restoreClient.Update(context.TODO(), movie.ID, updatedMovie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	result, err = restoreClient.RestoreBackup(context.TODO(), bytes.NewReader(archive.Bytes()), RestoreMerge)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := (RestoreResult{Skipped: 3}); result != want {
+		tt.Fatalf("want %+v, got %+v", want, result)
+	}
+
+	res, err := restoreClient.Read(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []schema.Media{updatedMovie}; !reflect.DeepEqual(want, res) {
+		tt.Fatalf("want the merge to keep %v, got %v", want, res)
+	}
+
+	result, err = restoreClient.RestoreBackup(context.TODO(), bytes.NewReader(archive.Bytes()), RestoreOverwrite)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := (RestoreResult{Restored: 3}); result != want {
+		tt.Fatalf("want %+v, got %+v", want, result)
+	}
+
+	res, err = restoreClient.Read(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []schema.Media{*movie}; !reflect.DeepEqual(want, res) {
+		tt.Fatalf("want the overwrite to restore %v, got %v", want, res)
+	}
+}
+
+func TestBackupEncrypted(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("restores into in-memory databases")
+	}
+
+	newClient := func(secret string) *MediaDbClient {
+		bucket := "media-db-test-bucket"
+		rawBackend, err := newS3BackendFromAPI(newFakeS3Client(bucket), bucket, 0)
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		var backend Backend = rawBackend
+		if secret != "" {
+			backend, err = newEncryptedBackend(backend, []byte(secret), nil)
+			if err != nil {
+				tt.Fatal(err)
+			}
+		}
+
+		return NewMediaDbClientFromBackend(backend)
+	}
+
+	client := newClient("a secret")
+
+	movie, err := schema.NewMovie("A Secret Backed Up Title", "A Director", 1999, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	archive := new(bytes.Buffer)
+	_, err = client.Backup(context.TODO(), archive)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// The entries are still encrypted in the archive.
+	_, err = rewriteArchive(archive.Bytes(), func(name string, data []byte) []byte {
+		if name != getManifestName() && !bytes.HasPrefix(data, getEncryptionHeader()) {
+			tt.Fatalf("want %s to be encrypted, got %q", name, data)
+		}
+		return data
+	})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// A database with another key, or with no key, cannot restore the backup.
+	for _, secret := range []string{"another secret", ""} {
+		otherClient := newClient(secret)
+
+		_, err = otherClient.RestoreBackup(context.TODO(), bytes.NewReader(archive.Bytes()), RestoreIntoEmpty)
+		if !errors.Is(err, ErrDecryption) {
+			tt.Fatalf("for secret %q, want %v, got %v", secret, ErrDecryption, err)
+		}
+
+		keys, err := listAllKeys(context.TODO(), unwrapBackend(otherClient.backend), getBackupPrefix())
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if len(keys) != 0 {
+			tt.Fatalf("for secret %q, want nothing restored, got %v", secret, keys)
+		}
+	}
+
+	// A database with the same key, but another salt, can.
+	restoreClient := newClient("a secret")
+	result, err := restoreClient.RestoreBackup(context.TODO(), bytes.NewReader(archive.Bytes()), RestoreIntoEmpty)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := (RestoreResult{Restored: 1}); result != want {
+		tt.Fatalf("want %+v, got %+v", want, result)
+	}
+
+	res, err := restoreClient.Read(context.TODO(), "", nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []schema.Media{*movie}; !reflect.DeepEqual(want, res) {
+		tt.Fatalf("want %v, got %v", want, res)
+	}
+}
+
+// rewriteArchive copies a backup archive, passing the data of each file
+// through change. A file is left out of the copy if change returns nil.
+func rewriteArchive(archive []byte, change func(name string, data []byte) []byte) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	out := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+
+		data = change(header.Name, data)
+		if data == nil {
+			continue
+		}
+
+		header.Size = int64(len(data))
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tarWriter.Write(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+func TestRestoreBackupInvalid(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Backed Up Title", "A Director", 1999, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err = client.Delete(context.TODO(), movie.ID, *movie, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	archive := new(bytes.Buffer)
+	_, err = client.Backup(context.TODO(), archive)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		change func(name string, data []byte) []byte
+	}{
+		{"changed-object", func(name string, data []byte) []byte {
+			if name == "objects/"+movie.Key() {
+				return bytes.Replace(data, []byte("A Backed Up Title"), []byte("A Changed Title!!"), 1)
+			}
+			return data
+		}},
+		{"missing-object", func(name string, data []byte) []byte {
+			if name == "objects/"+movie.Key() {
+				return nil
+			}
+			return data
+		}},
+		{"missing-manifest", func(name string, data []byte) []byte {
+			if name == getManifestName() {
+				return nil
+			}
+			return data
+		}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			invalidArchive, err := rewriteArchive(archive.Bytes(), test.change)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			_, err = client.RestoreBackup(context.TODO(), bytes.NewReader(invalidArchive), RestoreOverwrite)
+			if err == nil {
+				subtt.Fatal("want error, got nil")
+			}
+
+			// Nothing is written from an archive that is not valid.
+			res, err := client.Read(context.TODO(), movie.ID, schema.Movie{})
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			if want := []schema.Media{*movie}; !reflect.DeepEqual(want, res) {
+				subtt.Fatalf("want %v, got %v", want, res)
+			}
+		})
+	}
+
+	_, err = client.RestoreBackup(context.TODO(), bytes.NewReader([]byte("not an archive")), RestoreOverwrite)
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
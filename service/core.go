@@ -2,43 +2,151 @@ package service
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	cfg "github.com/alexpcook/media-db/config"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// MediaDbClient contains the AWS S3 client and bucket name
-// to use for the database.
+// MediaDbClient contains the storage backend to use for the database and
+// the maximum number of entries to fetch from the backend at once. Every
+// method takes a context, and stops making requests to the backend once
+// the context is cancelled. A change that has already written an entry is
+// still finished, so that the index is not left out of date.
 type MediaDbClient struct {
-	s3Client *s3.Client
-	s3Bucket string
+	backend     Backend
+	concurrency int
+}
+
+// getDefaultConcurrency returns the number of entries that
+// are fetched from the backend at once unless configured.
+func getDefaultConcurrency() int {
+	return 8
 }
 
 // NewMediaDbClient creates a MediaDbClient from the settings in the given
-// MediaDbConfig. Any problem loading the AWS credentials, configuration,
-// or accessing the S3 bucket will return a non-nil error.
+// MediaDbConfig. Entries are encrypted if the configuration has a key. Any
+// problem initializing the storage backend selected by the configuration,
+// or reading its key, will return a non-nil error.
 func NewMediaDbClient(mediaDbConfig *cfg.MediaDbConfig) (*MediaDbClient, error) {
-	awsConfig, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithSharedConfigProfile(mediaDbConfig.AWSProfile),
-		config.WithRegion(mediaDbConfig.AWSRegion))
+	backend, err := newBackendFromConfig(mediaDbConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	s3Client := s3.NewFromConfig(awsConfig)
-	mediaDbClient := MediaDbClient{
-		s3Client: s3Client,
-		s3Bucket: mediaDbConfig.S3Bucket,
+	client := NewMediaDbClientFromBackend(backend)
+	client.SetConcurrency(mediaDbConfig.Concurrency)
+
+	return client, nil
+}
+
+// NewMediaDbClientFromBackend creates a MediaDbClient that stores
+// its data in the given backend.
+func NewMediaDbClientFromBackend(backend Backend) *MediaDbClient {
+	return &MediaDbClient{
+		backend:     backend,
+		concurrency: getDefaultConcurrency(),
 	}
+}
 
-	// Validate access to the S3 bucket.
-	_, err = mediaDbClient.s3Client.HeadBucket(context.TODO(), &s3.HeadBucketInput{
-		Bucket: &mediaDbClient.s3Bucket,
-	})
-	if err != nil {
-		return nil, err
+// SetConcurrency sets the maximum number of entries that the client fetches
+// from the backend at once. A value that is not positive restores the default.
+func (cl *MediaDbClient) SetConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = getDefaultConcurrency()
 	}
+	cl.concurrency = concurrency
+}
+
+// runConcurrently calls task for every index from 0 to n-1, running up to
+// cl.concurrency tasks at once. The first error returned by a task cancels
+// the context passed to the remaining tasks, stops any more from starting,
+// and is returned once the running tasks have finished.
+func (cl *MediaDbClient) runConcurrently(ctx context.Context, n int, task func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indices := make(chan int)
+	firstErr := make(chan error, 1)
+
+	numWorkers := cl.concurrency
+	if numWorkers > n {
+		numWorkers = n
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indices {
+				// The send loop below picks at random between sending an
+				// index and stopping, so ctx may already be done.
+				if ctx.Err() != nil {
+					return
+				}
+
+				err := task(ctx, i)
+				if err != nil {
+					select {
+					case firstErr <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+sendLoop:
+	for i := 0; i < n; i++ {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break sendLoop
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	select {
+	case err := <-firstErr:
+		return err
+	default:
+	}
+
+	// The parent context may have been cancelled without any task failing.
+	return ctx.Err()
+}
+
+// detachedContext is a context that carries the values of the context it
+// wraps, but is never cancelled and has no deadline.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline returns no deadline.
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// Done returns nil, since a detachedContext is never cancelled.
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err returns nil, since a detachedContext is never cancelled.
+func (detachedContext) Err() error {
+	return nil
+}
 
-	return &mediaDbClient, nil
+// detach returns a context with the values of ctx that is not cancelled
+// when ctx is. It is used to finish a change, such as updating an index,
+// once an entry has already been written, so that cancelling ctx does not
+// leave the database half changed. Each request to the backend is still
+// limited by the backend's own timeout.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
 }
@@ -1,10 +1,15 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/schema"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 func TestMain(m *testing.M) {
@@ -13,6 +18,10 @@ func TestMain(m *testing.M) {
 }
 
 func TestNewMediaDbClient(tt *testing.T) {
+	if !isLiveTest() {
+		tt.Skip("requires a live database, run with -config=<file>")
+	}
+
 	cfg, err := config.LoadMediaDbConfig()
 	if err != nil {
 		tt.Fatal(err)
@@ -50,9 +59,139 @@ func TestNewMediaDbClient(tt *testing.T) {
 				subtt.Fatal(err)
 			}
 
-			if cfg.S3Bucket != client.s3Bucket {
-				subtt.Fatalf("wrong s3 bucket name: want %s, got %s", cfg.S3Bucket, client.s3Bucket)
+			if cfg.S3Bucket != client.backend.(*s3Backend).bucket {
+				subtt.Fatalf("wrong s3 bucket name: want %s, got %s", cfg.S3Bucket, client.backend.(*s3Backend).bucket)
 			}
 		})
 	}
 }
+
+// hangingS3Client is a fakeS3Client whose GetObject
+// never responds until its context is done.
+type hangingS3Client struct {
+	*fakeS3Client
+}
+
+func (c hangingS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestS3BackendTimeout(tt *testing.T) {
+	bucket := "media-db-test-bucket"
+	backend, err := newS3BackendFromAPI(hangingS3Client{newFakeS3Client(bucket)}, bucket, 10*time.Millisecond)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, _, err = backend.Get(context.TODO(), "media/movie/123")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		tt.Fatalf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	backend, err = newS3BackendFromAPI(newFakeS3Client(bucket), bucket, 0)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if getDefaultTimeout() != backend.timeout {
+		tt.Fatalf("want default timeout %s, got %s", getDefaultTimeout(), backend.timeout)
+	}
+}
+
+// cancelingBackend wraps a Backend to cancel a context
+// once an object has been put under a particular key.
+type cancelingBackend struct {
+	Backend
+	cancel    context.CancelFunc
+	cancelKey string
+}
+
+func (b *cancelingBackend) Put(ctx context.Context, key string, data []byte, ifMatch string) (string, error) {
+	eTag, err := b.Backend.Put(ctx, key, data, ifMatch)
+	if key == b.cancelKey {
+		b.cancel()
+	}
+	return eTag, err
+}
+
+func TestCancel(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("cancels writes part of the way through")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Cancelled Title", "A Cancelled Director", 1999, "2021-05-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Once the entry is written, the index is still updated.
+	ctx, cancel := context.WithCancel(context.Background())
+	canceling := &cancelingBackend{Backend: client.backend, cancel: cancel, cancelKey: movie.Key()}
+
+	err = NewMediaDbClientFromBackend(canceling).Create(ctx, movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		tt.Fatal("want the context to be cancelled")
+	}
+
+	idx, _, err := client.loadIndex(context.TODO(), schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if _, ok := idx.Entries[movie.ID]; !ok {
+		tt.Fatalf("want movie %s in index, got %v", movie.ID, idx.Entries)
+	}
+
+	// A batch that is cancelled reports which entries were not written,
+	// and every entry that was written is in the index.
+	batch := make([]schema.Media, 20)
+	for i := range batch {
+		batch[i], err = schema.NewMusic("A Cancelled Song", "A Cancelled Artist", 1985, "2021-05-02")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	canceling = &cancelingBackend{Backend: client.backend, cancel: cancel, cancelKey: batch[0].Key()}
+
+	batchClient := NewMediaDbClientFromBackend(canceling)
+	batchClient.SetConcurrency(1)
+
+	errs, err := batchClient.CreateBatch(ctx, batch)
+	if !errors.Is(err, context.Canceled) {
+		tt.Fatalf("want %v, got %v", context.Canceled, err)
+	}
+
+	res, err := client.Read(context.TODO(), "", schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	indexed := make(map[string]bool, len(res))
+	for _, media := range res {
+		indexed[media.Key()] = true
+	}
+
+	numCreated := 0
+	for i := range batch {
+		if (errs[i] == nil) != indexed[batch[i].Key()] {
+			tt.Fatalf("entry %d: got error %v, but indexed is %t", i, errs[i], indexed[batch[i].Key()])
+		}
+		if errs[i] == nil {
+			numCreated++
+		} else if !errors.Is(errs[i], context.Canceled) {
+			tt.Fatalf("entry %d: want %v, got %v", i, context.Canceled, errs[i])
+		}
+	}
+	if numCreated == 0 || numCreated == len(batch) {
+		tt.Fatalf("want some of the %d entries created, got %d", len(batch), numCreated)
+	}
+}
@@ -1,31 +1,91 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 
 	"github.com/alexpcook/media-db/schema"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// Create makes a single new media object in the database.
-// It returns a non-nil error if the object cannot be added.
-func (cl *MediaDbClient) Create(media schema.Media) error {
-	jsonData, err := json.Marshal(media)
+// Create makes a single new media object in the database and adds it to
+// the index for its type. It returns a non-nil error if the object cannot
+// be added.
+func (cl *MediaDbClient) Create(ctx context.Context, media schema.Media) error {
+	jsonData, err := schema.MarshalMedia(media)
 	if err != nil {
 		return err
 	}
 
 	key := media.Key()
-	_, err = cl.s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: &cl.s3Bucket,
-		Key:    &key,
-		Body:   bytes.NewReader(jsonData),
-	})
+	mediaType, err := schema.GetMediaTypeFromKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.backend.Put(ctx, key, jsonData, "")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return cl.updateIndex(detach(ctx), mediaType, func(idx *mediaIndex) {
+		idx.Entries[schema.GetIDFromKey(key)] = jsonData
+	})
+}
+
+// CreateBatch makes many new media objects in the database. Up to
+// cl.concurrency objects are written at once, and then the index for each
+// type is updated a single time with every object that was written. It
+// returns an error for each object in the same order as media, which is
+// nil if the object was created, and a non-nil error if an index cannot
+// be updated or ctx is cancelled. If ctx is cancelled, the objects that
+// were not written have the error of ctx, and the objects that were
+// written are still added to the index.
+func (cl *MediaDbClient) CreateBatch(ctx context.Context, media []schema.Media) ([]error, error) {
+	errs := make([]error, len(media))
+	jsonData := make([][]byte, len(media))
+	isStarted := make([]bool, len(media))
+
+	// Each object is written independently, so the tasks record their
+	// errors rather than returning them and stopping the other writes.
+	cancelErr := cl.runConcurrently(ctx, len(media), func(ctx context.Context, i int) error {
+		isStarted[i] = true
+
+		jsonData[i], errs[i] = schema.MarshalMedia(media[i])
+		if errs[i] != nil {
+			return nil
+		}
+
+		_, errs[i] = cl.backend.Put(ctx, media[i].Key(), jsonData[i], "")
+		return nil
+	})
+	if cancelErr != nil {
+		for i := range errs {
+			if !isStarted[i] {
+				errs[i] = cancelErr
+			}
+		}
+	}
+
+	for _, mediaType := range schema.GetAllMediaTypes() {
+		entries := make(map[string]json.RawMessage)
+		for i := range media {
+			if errs[i] == nil && schema.GetBaseKeyFromMediaType(media[i]) == schema.GetBaseKeyFromMediaType(mediaType) {
+				entries[schema.GetIDFromKey(media[i].Key())] = jsonData[i]
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+
+		err := cl.updateIndex(detach(ctx), mediaType, func(idx *mediaIndex) {
+			for id, entry := range entries {
+				idx.Entries[id] = entry
+			}
+		})
+		if err != nil {
+			return errs, err
+		}
+	}
+
+	return errs, cancelErr
 }
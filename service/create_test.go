@@ -1,19 +1,15 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"testing"
 
-	"github.com/alexpcook/media-db/config"
 	"github.com/alexpcook/media-db/schema"
 )
 
 func TestCreate(tt *testing.T) {
-	cfg, err := config.LoadMediaDbConfig()
-	if err != nil {
-		tt.Fatal(err)
-	}
-
-	client, err := NewMediaDbClient(cfg)
+	client, err := newTestMediaDbClient()
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -23,12 +19,12 @@ func TestCreate(tt *testing.T) {
 		tt.Fatal(err)
 	}
 
-	err = client.Create(movie)
+	err = client.Create(context.TODO(), movie)
 	if err != nil {
 		tt.Fatal(err)
 	}
 	defer func() {
-		err = client.Delete(movie.ID, *movie)
+		err = client.Delete(context.TODO(), movie.ID, *movie, "")
 		if err != nil {
 			tt.Fatal(err)
 		}
@@ -39,25 +35,105 @@ func TestCreate(tt *testing.T) {
 		tt.Fatal(err)
 	}
 
-	err = client.Create(music)
+	err = client.Create(context.TODO(), music)
 	if err != nil {
 		tt.Fatal(err)
 	}
 	defer func() {
-		err = client.Delete(music.ID, *music)
+		err = client.Delete(context.TODO(), music.ID, *music, "")
 		if err != nil {
 			tt.Fatal(err)
 		}
 	}()
 
 	// Mock a failed communication with the S3 bucket.
-	originalS3Bucket := client.s3Bucket
-	client.s3Bucket = "this-is-an-invalid-bucket-name"
-	err = client.Create(music)
+	originalS3Bucket := client.backend.(*s3Backend).bucket
+	client.backend.(*s3Backend).bucket = "this-is-an-invalid-bucket-name"
+	err = client.Create(context.TODO(), music)
 	if err == nil {
 		tt.Fatal("want error, got nil")
 	}
 	defer func() {
-		client.s3Bucket = originalS3Bucket
+		client.backend.(*s3Backend).bucket = originalS3Bucket
 	}()
 }
+
+// failPutBackend wraps a Backend to fail Put calls for a particular key.
+type failPutBackend struct {
+	Backend
+	failKey string
+}
+
+func (b *failPutBackend) Put(ctx context.Context, key string, data []byte, ifMatch string) (string, error) {
+	if key == b.failKey {
+		return "", errors.New("simulated put failure")
+	}
+
+	return b.Backend.Put(ctx, key, data, ifMatch)
+}
+
+func TestCreateBatch(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	media := make([]schema.Media, 0)
+	for i := 0; i < 10; i++ {
+		movie, err := schema.NewMovie("A Batch Movie Title", "A Movie Director", 2010, "2021-02-16")
+		if err != nil {
+			tt.Fatal(err)
+		}
+		media = append(media, *movie)
+	}
+
+	music, err := schema.NewMusic("A Batch Album Title", "An Artist", 1980, "2020-03-16")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	media = append(media, *music)
+
+	batchClient := NewMediaDbClientFromBackend(&failPutBackend{
+		Backend: client.backend,
+		failKey: media[3].Key(),
+	})
+
+	errs, err := batchClient.CreateBatch(context.TODO(), media)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		for i := range media {
+			if errs[i] == nil {
+				err = client.Delete(context.TODO(), schema.GetIDFromKey(media[i].Key()), media[i], "")
+				if err != nil {
+					tt.Fatal(err)
+				}
+			}
+		}
+	}()
+
+	for i := range errs {
+		if i == 3 && errs[i] == nil {
+			tt.Fatal("want error for the failed entry, got nil")
+		} else if i != 3 && errs[i] != nil {
+			tt.Fatal(errs[i])
+		}
+	}
+
+	movies, err := client.Read(context.TODO(), "", schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(movies) != 9 {
+		tt.Fatalf("want 9 movies, got %d", len(movies))
+	}
+
+	musicRes, err := client.Read(context.TODO(), music.ID, schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(musicRes) != 1 {
+		tt.Fatalf("want 1 music entry, got %d", len(musicRes))
+	}
+}
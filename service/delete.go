@@ -2,24 +2,61 @@ package service
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/alexpcook/media-db/schema"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// Delete removes the given media from the database. It returns a non-nil
-// error if the entry cannot be deleted.
-func (cl *MediaDbClient) Delete(id string, media schema.Media) error {
+// Delete moves the given media from the database to the trash and removes it
+// from the index for its type. Deleted entries can be listed with ReadTrash,
+// restored with Restore, and removed permanently with PurgeTrash. If
+// expectedVersion is not the empty string "", the entry is only deleted if
+// its current version is expectedVersion, and a *ConflictError is returned
+// if it is not. It returns a non-nil error if the entry cannot be deleted,
+// wrapping ErrNotFound if there is no such entry.
+func (cl *MediaDbClient) Delete(ctx context.Context, id string, media schema.Media, expectedVersion string) error {
 	objKey := strings.Join([]string{schema.GetBaseKeyFromMediaType(media), id}, "/")
 
-	_, err := cl.s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: &cl.s3Bucket,
-		Key:    &objKey,
-	})
+	mediaType, err := schema.GetMediaTypeFromKey(objKey)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	jsonData, version, err := cl.backend.Get(ctx, objKey)
+	if errors.Is(err, ErrNotFound) {
+		return entryNotFoundError(id, mediaType)
+	} else if err != nil {
+		return err
+	}
+
+	if expectedVersion != "" && expectedVersion != version {
+		return cl.newConflictError(ctx, objKey, expectedVersion)
+	}
+
+	err = cl.moveToTrash(ctx, id, mediaType, jsonData)
+	if err != nil {
+		return err
+	}
+
+	// The entry is in the trash, so the rest of the delete is
+	// finished even if ctx is cancelled.
+	ctx = detach(ctx)
+
+	err = cl.backend.Delete(ctx, objKey, expectedVersion)
+	if errors.Is(err, ErrPreconditionFailed) {
+		// The entry changed after it was copied to the trash, so
+		// the trash copy is out of date and the entry stays put.
+		err = cl.backend.Delete(ctx, getTrashObjKey(id, mediaType), "")
+		if err != nil {
+			return err
+		}
+		return cl.newConflictError(ctx, objKey, expectedVersion)
+	} else if err != nil {
+		return err
+	}
+
+	return cl.updateIndex(ctx, mediaType, func(idx *mediaIndex) {
+		delete(idx.Entries, id)
+	})
 }
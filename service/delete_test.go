@@ -1,21 +1,16 @@
 package service
 
 import (
+	"context"
 	"testing"
 
-	"github.com/alexpcook/media-db/config"
 	"github.com/alexpcook/media-db/schema"
 )
 
 func TestDelete(tt *testing.T) {
 	// Simulate a failed delete.
 	// Successful deletes are tested elsewhere in the package.
-	cfg, err := config.LoadMediaDbConfig()
-	if err != nil {
-		tt.Fatal(err)
-	}
-
-	client, err := NewMediaDbClient(cfg)
+	client, err := newTestMediaDbClient()
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -25,8 +20,8 @@ func TestDelete(tt *testing.T) {
 		tt.Fatal(err)
 	}
 
-	client.s3Bucket = "this-is-an-invalid-bucket-name"
-	err = client.Delete(movie.ID, *movie)
+	client.backend.(*s3Backend).bucket = "this-is-an-invalid-bucket-name"
+	err = client.Delete(context.TODO(), movie.ID, *movie, "")
 	if err == nil {
 		tt.Fatal("want error, got nil")
 	}
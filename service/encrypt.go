@@ -0,0 +1,362 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	cfg "github.com/alexpcook/media-db/config"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrDecryption is returned, possibly wrapped, when an object read through
+// an encrypted backend is not encrypted or cannot be decrypted with its key.
+var ErrDecryption = errors.New("the object cannot be decrypted with the configured key")
+
+// getEncryptionHeader returns the bytes that every encrypted object starts
+// with, which identify the format of the rest of the object.
+func getEncryptionHeader() []byte {
+	return []byte("media-db:aes-256-gcm:1\n")
+}
+
+// getKeyDerivationIterations returns the number of iterations of
+// PBKDF2-HMAC-SHA256 used to derive an encryption key from a secret.
+func getKeyDerivationIterations() int {
+	return 200000
+}
+
+// getSaltSize returns the size in bytes of a salt used
+// to derive an encryption key from a secret.
+func getSaltSize() int {
+	return 16
+}
+
+// deriveKey derives a 256-bit encryption key from secret and salt with the
+// given number of iterations of PBKDF2-HMAC-SHA256.
+func deriveKey(secret, salt []byte, iterations int) []byte {
+	return pbkdf2.Key(secret, salt, iterations, 32, sha256.New)
+}
+
+// encryptedBackend is a Backend that encrypts the data of every object
+// before storing it in another Backend, and decrypts it when it is read.
+// Each object is encrypted with AES-256-GCM under a key derived from a
+// secret and a salt. The salt is stored in the object, so that objects
+// written with a different salt can still be decrypted with the secret.
+// The object key is authenticated along with the data, so that an object
+// cannot be copied to another key without being detected.
+type encryptedBackend struct {
+	Backend
+
+	secret []byte
+	salt   []byte
+
+	// keys caches the AES-256-GCM cipher for each salt,
+	// since deriving a key is deliberately slow.
+	mu   sync.Mutex
+	keys map[string]cipher.AEAD
+}
+
+// encryptedVersionedBackend is an encryptedBackend
+// for a Backend that keeps previous versions of objects.
+type encryptedVersionedBackend struct {
+	*encryptedBackend
+}
+
+// newEncryptedBackend returns a Backend that encrypts the objects stored
+// in backend with a key derived from secret and salt. If salt is nil, a
+// random salt is used. The returned Backend is a VersionedBackend if
+// backend is one.
+func newEncryptedBackend(backend Backend, secret, salt []byte) (Backend, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("the encryption secret cannot be empty")
+	}
+
+	if salt == nil {
+		salt = make([]byte, getSaltSize())
+		_, err := rand.Read(salt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(salt) != getSaltSize() {
+		return nil, fmt.Errorf("the encryption salt must be %d bytes, got %d", getSaltSize(), len(salt))
+	}
+
+	encrypted := &encryptedBackend{
+		Backend: backend,
+		secret:  secret,
+		salt:    salt,
+		keys:    make(map[string]cipher.AEAD),
+	}
+
+	if _, ok := backend.(VersionedBackend); ok {
+		return encryptedVersionedBackend{encrypted}, nil
+	}
+	return encrypted, nil
+}
+
+// newBackendFromConfig returns the storage backend selected by the given
+// MediaDbConfig, which encrypts entries if the configuration says to.
+func newBackendFromConfig(mediaDbConfig *cfg.MediaDbConfig) (Backend, error) {
+	// The key is checked first, so that a key that cannot be read is
+	// reported even when the backend cannot be reached.
+	if mediaDbConfig.IsEncrypted() {
+		_, err := mediaDbConfig.EncryptionSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	backend, err := NewBackend(mediaDbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapEncryptedBackend(backend, mediaDbConfig)
+}
+
+// wrapEncryptedBackend returns backend, wrapped to encrypt entries
+// with the key in the given MediaDbConfig if there is one.
+func wrapEncryptedBackend(backend Backend, mediaDbConfig *cfg.MediaDbConfig) (Backend, error) {
+	if !mediaDbConfig.IsEncrypted() {
+		return backend, nil
+	}
+
+	secret, err := mediaDbConfig.EncryptionSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := mediaDbConfig.GetKeySalt()
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncryptedBackend(backend, secret, salt)
+}
+
+// unwrapBackend returns the Backend that stores the
+// objects of backend, without any encryption.
+func unwrapBackend(backend Backend) Backend {
+	switch b := backend.(type) {
+	case *encryptedBackend:
+		return b.Backend
+	case encryptedVersionedBackend:
+		return b.Backend
+	default:
+		return backend
+	}
+}
+
+// readStoredData returns the data of an object as it is read through
+// backend, given the data stored under key in the Backend it wraps. It
+// returns ErrDecryption if backend encrypts entries and the data cannot be
+// decrypted with its key, or if it does not and the data is encrypted.
+func readStoredData(backend Backend, key string, data []byte) ([]byte, error) {
+	switch b := backend.(type) {
+	case *encryptedBackend:
+		return b.decrypt(key, data)
+	case encryptedVersionedBackend:
+		return b.decrypt(key, data)
+	}
+
+	if bytes.HasPrefix(data, getEncryptionHeader()) {
+		return nil, fmt.Errorf("%w: %s is encrypted, but the database is not", ErrDecryption, key)
+	}
+
+	return data, nil
+}
+
+// aead returns the AES-256-GCM cipher for the key derived from salt.
+func (b *encryptedBackend) aead(salt []byte) (cipher.AEAD, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if aead, ok := b.keys[string(salt)]; ok {
+		return aead, nil
+	}
+
+	block, err := aes.NewCipher(deriveKey(b.secret, salt, getKeyDerivationIterations()))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	b.keys[string(salt)] = aead
+	return aead, nil
+}
+
+// encrypt returns data encrypted for storage under key. An encrypted
+// object is the header, the salt, a random nonce, and the ciphertext.
+func (b *encryptedBackend) encrypt(key string, data []byte) ([]byte, error) {
+	aead, err := b.aead(b.salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := getEncryptionHeader()
+	out := make([]byte, 0, len(header)+len(b.salt)+aead.NonceSize()+len(data)+aead.Overhead())
+	out = append(out, header...)
+	out = append(out, b.salt...)
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+
+	return aead.Seal(out, nonce, data, []byte(key)), nil
+}
+
+// decrypt returns the data of an object stored under key, which was
+// encrypted by encrypt. It returns ErrDecryption if the object is not
+// encrypted, has been changed, or was encrypted with another secret.
+func (b *encryptedBackend) decrypt(key string, data []byte) ([]byte, error) {
+	header := getEncryptionHeader()
+	if !bytes.HasPrefix(data, header) || len(data) < len(header)+getSaltSize() {
+		return nil, fmt.Errorf("%w: %s is not encrypted", ErrDecryption, key)
+	}
+	data = data[len(header):]
+
+	aead, err := b.aead(data[:getSaltSize()])
+	if err != nil {
+		return nil, err
+	}
+	data = data[getSaltSize():]
+
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: %s is too short", ErrDecryption, key)
+	}
+
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryption, key)
+	}
+
+	return plaintext, nil
+}
+
+// Put encrypts data and stores it in the underlying backend.
+func (b *encryptedBackend) Put(ctx context.Context, key string, data []byte, ifMatch string) (string, error) {
+	encrypted, err := b.encrypt(key, data)
+	if err != nil {
+		return "", err
+	}
+
+	return b.Backend.Put(ctx, key, encrypted, ifMatch)
+}
+
+// Get reads the data stored under key in the underlying backend and
+// decrypts it. The ETag is the ETag of the encrypted object.
+func (b *encryptedBackend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	encrypted, eTag, err := b.Backend.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := b.decrypt(key, encrypted)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, eTag, nil
+}
+
+// ListVersions lists the versions of the object stored under key in the
+// underlying backend.
+func (b encryptedVersionedBackend) ListVersions(ctx context.Context, key string) ([]ObjectVersion, error) {
+	return b.Backend.(VersionedBackend).ListVersions(ctx, key)
+}
+
+// GetVersion reads the given version of the object stored under key in the
+// underlying backend and decrypts it with the key derived from the salt of
+// that version. A version written before the database was encrypted is
+// returned as it is stored. It returns ErrDecryption if the version was
+// encrypted with another secret, such as the one used before a rekey.
+func (b encryptedVersionedBackend) GetVersion(ctx context.Context, key, versionID string) ([]byte, error) {
+	data, err := b.Backend.(VersionedBackend).GetVersion(ctx, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, getEncryptionHeader()) {
+		return data, nil
+	}
+	return b.decrypt(key, data)
+}
+
+// Rekey re-encrypts every object in the database with the key in
+// newConfig, or decrypts every object if newConfig does not encrypt
+// entries, and the client uses the new key from then on. Objects that
+// already use the new key are left as they are, so that a rekey that was
+// interrupted can be run again with the same keys. It returns the number
+// of objects changed and a non-nil error if any object cannot be read
+// with the current key or written with the new one.
+func (cl *MediaDbClient) Rekey(ctx context.Context, newConfig *cfg.MediaDbConfig) (int, error) {
+	rawBackend := unwrapBackend(cl.backend)
+
+	newBackend, err := wrapEncryptedBackend(rawBackend, newConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, err := listAllKeys(ctx, rawBackend, getBackupPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	isRekeyed := make([]bool, len(keys))
+	err = cl.runConcurrently(ctx, len(keys), func(ctx context.Context, i int) error {
+		if newConfig.IsEncrypted() {
+			_, _, err := newBackend.Get(ctx, keys[i])
+			if err == nil {
+				return nil
+			} else if !errors.Is(err, ErrDecryption) {
+				return err
+			}
+		}
+
+		data, eTag, err := cl.backend.Get(ctx, keys[i])
+		if errors.Is(err, ErrDecryption) && !newConfig.IsEncrypted() {
+			rawData, _, rawErr := rawBackend.Get(ctx, keys[i])
+			if rawErr == nil && !bytes.HasPrefix(rawData, getEncryptionHeader()) {
+				return nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = newBackend.Put(ctx, keys[i], data, eTag)
+		if err != nil {
+			return err
+		}
+
+		isRekeyed[i] = true
+		return nil
+	})
+
+	numRekeyed := 0
+	for _, rekeyed := range isRekeyed {
+		if rekeyed {
+			numRekeyed++
+		}
+	}
+	if err != nil {
+		return numRekeyed, err
+	}
+
+	cl.backend = newBackend
+	return numRekeyed, nil
+}
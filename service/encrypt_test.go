@@ -0,0 +1,335 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestDeriveKey(tt *testing.T) {
+	// Test vectors for PBKDF2-HMAC-SHA256 from RFC 7914.
+	testCases := []struct {
+		secret     string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+
+	for _, test := range testCases {
+		got := hex.EncodeToString(deriveKey([]byte(test.secret), []byte(test.salt), test.iterations))
+		if test.want != got {
+			tt.Fatalf("for %d iterations, want %s, got %s", test.iterations, test.want, got)
+		}
+	}
+}
+
+func TestEncryptedBackend(tt *testing.T) {
+	bucket := "media-db-test-bucket"
+	rawBackend, err := newS3BackendFromAPI(newFakeS3Client(bucket), bucket, 0)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	backend, err := newEncryptedBackend(rawBackend, []byte("a secret"), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if _, ok := backend.(VersionedBackend); !ok {
+		tt.Fatal("want an encrypted S3 backend to keep versions")
+	}
+
+	ctx := context.TODO()
+	key := "media/movie/123"
+	data := []byte(`{"id": "123", "title": "A Secret Title"}`)
+
+	putETag, err := backend.Put(ctx, key, data, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	got, getETag, err := backend.Get(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !bytes.Equal(data, got) {
+		tt.Fatalf("want %s, got %s", data, got)
+	}
+	if putETag != getETag {
+		tt.Fatalf("want ETag %s, got %s", putETag, getETag)
+	}
+
+	rawData, _, err := rawBackend.Get(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if bytes.Contains(rawData, []byte("A Secret Title")) {
+		tt.Fatalf("want the stored object to be encrypted, got %s", rawData)
+	}
+
+	versions, err := backend.(VersionedBackend).ListVersions(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	got, err = backend.(VersionedBackend).GetVersion(ctx, key, versions[0].ID)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !bytes.Equal(data, got) {
+		tt.Fatalf("want %s, got %s", data, got)
+	}
+
+	// The object can be decrypted with the same secret and any salt,
+	// but not with another secret.
+	sameSecretBackend, err := newEncryptedBackend(rawBackend, []byte("a secret"), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	_, _, err = sameSecretBackend.Get(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	otherSecretBackend, err := newEncryptedBackend(rawBackend, []byte("another secret"), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	_, _, err = otherSecretBackend.Get(ctx, key)
+	if !errors.Is(err, ErrDecryption) {
+		tt.Fatalf("want %v, got %v", ErrDecryption, err)
+	}
+
+	// An object copied to another key, or that is not encrypted, is rejected.
+	for otherKey, otherData := range map[string][]byte{"media/movie/456": rawData, "media/movie/789": data} {
+		_, err = rawBackend.Put(ctx, otherKey, otherData, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		_, _, err = backend.Get(ctx, otherKey)
+		if !errors.Is(err, ErrDecryption) {
+			tt.Fatalf("for %s, want %v, got %v", otherKey, ErrDecryption, err)
+		}
+	}
+
+	localConfig, err := config.NewLocalMediaDbConfig(tt.TempDir())
+	if err != nil {
+		tt.Fatal(err)
+	}
+	localBackend, err := newLocalBackend(localConfig)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	backend, err = newEncryptedBackend(localBackend, []byte("a secret"), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if _, ok := backend.(VersionedBackend); ok {
+		tt.Fatal("want an encrypted local backend not to keep versions")
+	}
+}
+
+func TestRekey(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("rekeys an in-memory database")
+	}
+
+	keyDir := tt.TempDir()
+	newKeyConfig := func(secret string) *config.MediaDbConfig {
+		keyFile := filepath.Join(keyDir, secret)
+		err := os.WriteFile(keyFile, []byte(secret+"\n"), 0600)
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		keyConfig := &config.MediaDbConfig{}
+		err = keyConfig.SetEncryption(keyFile, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+		return keyConfig
+	}
+
+	bucket := "media-db-test-bucket"
+	rawBackend, err := newS3BackendFromAPI(newFakeS3Client(bucket), bucket, 0)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	oldConfig := newKeyConfig("old secret")
+	backend, err := wrapEncryptedBackend(rawBackend, oldConfig)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	client := NewMediaDbClientFromBackend(backend)
+
+	movie, err := schema.NewMovie("A Secret Title", "A Director", 1999, "2021-09-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	music, err := schema.NewMusic("A Secret Title", "An Artist", 1977, "2021-09-02")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	for _, media := range []schema.Media{movie, music} {
+		err = client.Create(context.TODO(), media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	checkRead := func(client *MediaDbClient) {
+		res, err := client.Read(context.TODO(), "", nil)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if want := []schema.Media{*movie, *music}; !reflect.DeepEqual(want, res) {
+			tt.Fatalf("want %v, got %v", want, res)
+		}
+	}
+
+	// Two entries and an index for each type.
+	newConfig := newKeyConfig("new secret")
+	numRekeyed, err := client.Rekey(context.TODO(), newConfig)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if numRekeyed != 4 {
+		tt.Fatalf("want 4 objects rekeyed, got %d", numRekeyed)
+	}
+	checkRead(client)
+
+	_, err = NewMediaDbClientFromBackend(backend).Read(context.TODO(), "", nil)
+	if !errors.Is(err, ErrDecryption) {
+		tt.Fatalf("want %v with the old key, got %v", ErrDecryption, err)
+	}
+
+	newBackend, err := wrapEncryptedBackend(rawBackend, newConfig)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	checkRead(NewMediaDbClientFromBackend(newBackend))
+
+	// Running the same rekey again, as after an interruption, changes nothing.
+	numRekeyed, err = NewMediaDbClientFromBackend(backend).Rekey(context.TODO(), newConfig)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if numRekeyed != 0 {
+		tt.Fatalf("want 0 objects rekeyed, got %d", numRekeyed)
+	}
+
+	// Rekeying without a key decrypts every object.
+	numRekeyed, err = client.Rekey(context.TODO(), &config.MediaDbConfig{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if numRekeyed != 4 {
+		tt.Fatalf("want 4 objects rekeyed, got %d", numRekeyed)
+	}
+	checkRead(NewMediaDbClientFromBackend(rawBackend))
+}
+
+func TestRekeyHistory(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("rekeys an in-memory database")
+	}
+
+	keyFile := filepath.Join(tt.TempDir(), "key")
+	err := os.WriteFile(keyFile, []byte("a secret\n"), 0600)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	keyConfig := &config.MediaDbConfig{}
+	err = keyConfig.SetEncryption(keyFile, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	bucket := "media-db-test-bucket"
+	rawBackend, err := newS3BackendFromAPI(newFakeS3Client(bucket), bucket, 0)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	client := NewMediaDbClientFromBackend(rawBackend)
+
+	movie, err := schema.NewMovie("A Plain Title", "A Director", 1999, "2021-09-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Encrypting the database leaves the plaintext version behind.
+	_, err = client.Rekey(context.TODO(), keyConfig)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	updatedMovie := *movie
+	updatedMovie.Title = "A Secret Title"
+	err = client.Update(context.TODO(), movie.ID, updatedMovie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	checkHistory := func(want []schema.Media) []EntryVersion {
+		history, err := client.History(context.TODO(), movie.ID, schema.Movie{})
+		if err != nil {
+			tt.Fatal(err)
+		}
+		if len(history) != len(want) {
+			tt.Fatalf("want %d versions, got %d", len(want), len(history))
+		}
+
+		for i, entryVersion := range history {
+			if want[i] == nil {
+				if !errors.Is(entryVersion.Err, ErrDecryption) {
+					tt.Fatalf("want version %d to be unreadable with %v, got %v", i, ErrDecryption, entryVersion.Err)
+				}
+				continue
+			}
+			if entryVersion.Err != nil || !reflect.DeepEqual(want[i], entryVersion.Media) {
+				tt.Fatalf("want version %d to be %v, got %v (%v)", i, want[i], entryVersion.Media, entryVersion.Err)
+			}
+		}
+
+		return history
+	}
+
+	history := checkHistory([]schema.Media{updatedMovie, *movie, *movie})
+
+	// The plaintext version can still be reverted to.
+	_, err = client.Revert(context.TODO(), movie.ID, schema.Movie{}, history[2].Version)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Decrypting the database leaves the encrypted versions unreadable,
+	// but the rest of the history can still be listed.
+	_, err = client.Rekey(context.TODO(), &config.MediaDbConfig{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	history = checkHistory([]schema.Media{*movie, nil, nil, nil, *movie})
+
+	_, err = client.Revert(context.TODO(), movie.ID, schema.Movie{}, history[2].Version)
+	if !errors.Is(err, ErrDecryption) {
+		tt.Fatalf("want %v reverting to an encrypted version, got %v", ErrDecryption, err)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// notFoundError is matched by errors.Is for ErrNotFound, and
+// describes what was not found without the text of ErrNotFound.
+type notFoundError string
+
+// Error describes what was not found.
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+// Is reports whether target is ErrNotFound.
+func (e notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// newNotFoundError returns an error matching ErrNotFound with a message
+// in the manner of fmt.Sprintf.
+func newNotFoundError(format string, a ...interface{}) error {
+	return notFoundError(fmt.Sprintf(format, a...))
+}
+
+// entryNotFoundError returns an error matching ErrNotFound
+// for the entry with the given id and type.
+func entryNotFoundError(id string, mediaType schema.Media) error {
+	return newNotFoundError("there is no %s entry with id %s", schema.GetMediaTypeName(mediaType), id)
+}
+
+// ErrUnreachable is returned, possibly wrapped, when the database cannot be
+// reached, such as when there is no network connection or its credentials
+// are missing or rejected, rather than when it is not configured correctly.
+var ErrUnreachable = errors.New("the database cannot be reached")
+
+// unreachableError is matched by errors.Is for ErrUnreachable, and
+// wraps the error returned when trying to reach the database.
+type unreachableError struct {
+	err error
+}
+
+// Error returns the text of the wrapped error.
+func (e unreachableError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e unreachableError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is ErrUnreachable.
+func (e unreachableError) Is(target error) bool {
+	return target == ErrUnreachable
+}
+
+// ErrConflict is matched by errors.Is for a *ConflictError.
+var ErrConflict = errors.New("entry was changed by another writer")
+
+// ConflictError is returned when an entry is updated or deleted with an
+// expected version that no longer matches the version in the database, or
+// when a queued change conflicts with a change made in the database.
+type ConflictError struct {
+	// ID is the id of the entry in conflict.
+	ID string
+
+	// ExpectedVersion is the version of the entry the caller expected,
+	// or "" if the change was not based on a particular version.
+	ExpectedVersion string
+
+	// Current is the entry currently in the database,
+	// or nil if the entry has since been deleted.
+	Current schema.Media
+
+	// CurrentVersion is the version of Current.
+	CurrentVersion string
+}
+
+// Error describes the conflict.
+func (e *ConflictError) Error() string {
+	if e.ExpectedVersion == "" {
+		if e.Current == nil {
+			return fmt.Sprintf("entry %s was deleted by another writer", e.ID)
+		}
+		return fmt.Sprintf("entry %s was changed by another writer, the current version is %s", e.ID, e.CurrentVersion)
+	}
+
+	if e.Current == nil {
+		return fmt.Sprintf("entry %s was deleted after version %s was read", e.ID, e.ExpectedVersion)
+	}
+
+	return fmt.Sprintf("entry %s was changed after version %s was read, the current version is %s", e.ID, e.ExpectedVersion, e.CurrentVersion)
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// newConflictError returns a *ConflictError for the entry stored under key,
+// fetching its current value from the backend.
+func (cl *MediaDbClient) newConflictError(ctx context.Context, key, expectedVersion string) error {
+	conflictErr := &ConflictError{
+		ID:              schema.GetIDFromKey(key),
+		ExpectedVersion: expectedVersion,
+	}
+
+	jsonData, currentVersion, err := cl.backend.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return conflictErr
+	} else if err != nil {
+		return err
+	}
+
+	conflictErr.Current, err = decodeMedia(key, jsonData)
+	if err != nil {
+		return err
+	}
+	conflictErr.CurrentVersion = currentVersion
+
+	return conflictErr
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexpcook/media-db/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// newTestMediaDbClient returns a MediaDbClient for testing. It uses the live
+// database from the -config flag if one was given, otherwise it uses an empty
+// in-memory fake S3 bucket.
+func newTestMediaDbClient() (*MediaDbClient, error) {
+	if isLiveTest() {
+		cfg, err := config.LoadMediaDbConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewMediaDbClient(cfg)
+	}
+
+	bucket := "media-db-test-bucket"
+	backend, err := newS3BackendFromAPI(newFakeS3Client(bucket), bucket, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMediaDbClientFromBackend(backend), nil
+}
+
+// fakeS3Object is a version of an object stored in a fakeS3Client bucket.
+type fakeS3Object struct {
+	data         []byte
+	eTag         string
+	lastModified time.Time
+	versionID    string
+	deleteMarker bool
+}
+
+// fakeS3Client is an in-memory stand-in for a single AWS S3 bucket with
+// versioning enabled. It implements the s3API interface with the same
+// semantics as S3 for the operations that the database uses, including
+// the errors returned for missing buckets, keys, and versions.
+type fakeS3Client struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]fakeS3Object
+
+	// versions holds every version of each key, from oldest to newest.
+	versions      map[string][]fakeS3Object
+	lastVersionID int
+
+	// beforeWrite, if it is not nil, is called with the key of every put
+	// or delete before the request is carried out, so that tests can make
+	// a conflicting change after the backend has checked the ETag.
+	beforeWrite func(key string)
+}
+
+// newFakeS3Client returns an empty fakeS3Client for the named bucket.
+func newFakeS3Client(bucket string) *fakeS3Client {
+	return &fakeS3Client{
+		bucket:   bucket,
+		objects:  make(map[string]fakeS3Object),
+		versions: make(map[string][]fakeS3Object),
+	}
+}
+
+// addVersion records obj as the newest version of key and returns it with
+// its version id set. The caller must hold c.mu.
+func (c *fakeS3Client) addVersion(key string, obj fakeS3Object) fakeS3Object {
+	c.lastVersionID++
+	obj.versionID = strconv.Itoa(c.lastVersionID)
+	c.versions[key] = append(c.versions[key], obj)
+	return obj
+}
+
+func (c *fakeS3Client) checkBucket(bucket *string) error {
+	if bucket == nil || *bucket != c.bucket {
+		return &types.NoSuchBucket{Message: bucket}
+	}
+	return nil
+}
+
+func (c *fakeS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// getRequestHeader returns the HTTP headers that optFns add to a request,
+// by running the middleware that they add against an empty request.
+func getRequestHeader(ctx context.Context, optFns ...func(*s3.Options)) (http.Header, error) {
+	options := s3.Options{}
+	for _, optFn := range optFns {
+		optFn(&options)
+	}
+
+	stack := middleware.NewStack("fake", smithyhttp.NewStackRequest)
+	for _, apiOption := range options.APIOptions {
+		err := apiOption(stack)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	header := http.Header{}
+	handler := middleware.HandlerFunc(func(ctx context.Context, input interface{}) (interface{}, middleware.Metadata, error) {
+		header = input.(*smithyhttp.Request).Header
+		return nil, middleware.Metadata{}, nil
+	})
+
+	_, _, err := middleware.DecorateHandler(handler, stack).Handle(ctx, struct{}{})
+	return header, err
+}
+
+// checkConditions returns the S3 error for a failed conditional request if
+// the If-Match or If-None-Match header added by optFns does not hold for
+// key. The caller must hold c.mu.
+func (c *fakeS3Client) checkConditions(ctx context.Context, key string, optFns ...func(*s3.Options)) error {
+	header, err := getRequestHeader(ctx, optFns...)
+	if err != nil {
+		return err
+	}
+
+	obj, ok := c.objects[key]
+	ifMatch, ifNoneMatch := header.Get("If-Match"), header.Get("If-None-Match")
+	if ifMatch != "" && (!ok || ifMatch != obj.eTag) || ifNoneMatch == "*" && ok {
+		return &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+	}
+
+	return nil
+}
+
+func (c *fakeS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.beforeWrite != nil {
+		c.beforeWrite(*params.Key)
+	}
+
+	obj := fakeS3Object{
+		data:         data,
+		eTag:         `"` + computeETag(data) + `"`,
+		lastModified: time.Now().UTC(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err = c.checkConditions(ctx, *params.Key, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	obj = c.addVersion(*params.Key, obj)
+	c.objects[*params.Key] = obj
+
+	return &s3.PutObjectOutput{ETag: &obj.eTag, VersionId: &obj.versionID}, nil
+}
+
+func (c *fakeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.objects[*params.Key]
+	if params.VersionId != nil {
+		ok = false
+		for _, version := range c.versions[*params.Key] {
+			if version.versionID == *params.VersionId {
+				obj, ok = version, true
+			}
+		}
+		if !ok {
+			return nil, &smithy.GenericAPIError{Code: "NoSuchVersion", Message: "The specified version does not exist."}
+		}
+		if obj.deleteMarker {
+			return nil, &smithy.GenericAPIError{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource."}
+		}
+	} else if !ok {
+		return nil, &types.NoSuchKey{Message: params.Key}
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(obj.data)),
+		ContentLength: int64(len(obj.data)),
+		ETag:          &obj.eTag,
+		LastModified:  &obj.lastModified,
+	}, nil
+}
+
+func (c *fakeS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if params.Prefix != nil {
+		prefix = *params.Prefix
+	}
+
+	// Like S3, the continuation token is opaque to callers. Here it
+	// is the last key returned on the previous page.
+	startAfter := ""
+	if params.StartAfter != nil {
+		startAfter = *params.StartAfter
+	}
+	if params.ContinuationToken != nil {
+		startAfter = *params.ContinuationToken
+	}
+
+	maxKeys := params.MaxKeys
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key := range c.objects {
+		if strings.HasPrefix(key, prefix) && key > startAfter {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{
+		Name:              params.Bucket,
+		Prefix:            params.Prefix,
+		ContinuationToken: params.ContinuationToken,
+		MaxKeys:           maxKeys,
+	}
+
+	if int32(len(keys)) > maxKeys {
+		keys = keys[:maxKeys]
+		out.IsTruncated = true
+		out.NextContinuationToken = &keys[len(keys)-1]
+	}
+
+	for i := range keys {
+		obj := c.objects[keys[i]]
+		out.Contents = append(out.Contents, types.Object{
+			Key:          &keys[i],
+			ETag:         &obj.eTag,
+			LastModified: &obj.lastModified,
+			Size:         int64(len(obj.data)),
+		})
+	}
+	out.KeyCount = int32(len(out.Contents))
+
+	return out, nil
+}
+
+func (c *fakeS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj, ok := c.objects[*params.Key]
+	if !ok {
+		// HeadObject responses have no body, so S3 reports a
+		// missing key with a generic error code.
+		return nil, &smithy.GenericAPIError{Code: "NotFound", Message: "Not Found"}
+	}
+
+	return &s3.HeadObjectOutput{
+		ContentLength: int64(len(obj.data)),
+		ETag:          &obj.eTag,
+		LastModified:  &obj.lastModified,
+	}, nil
+}
+
+func (c *fakeS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	if c.beforeWrite != nil {
+		c.beforeWrite(*params.Key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.checkConditions(ctx, *params.Key, optFns...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deleting a key that does not exist succeeds in S3. In a versioned
+	// bucket, the delete is recorded with a delete marker.
+	marker := c.addVersion(*params.Key, fakeS3Object{
+		lastModified: time.Now().UTC(),
+		deleteMarker: true,
+	})
+	delete(c.objects, *params.Key)
+
+	return &s3.DeleteObjectOutput{DeleteMarker: true, VersionId: &marker.versionID}, nil
+}
+
+// ListObjectVersions returns every version of the keys that begin with the
+// prefix in a single page, ordered by key and then from newest to oldest.
+func (c *fakeS3Client) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	if err := c.checkBucket(params.Bucket); err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if params.Prefix != nil {
+		prefix = *params.Prefix
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key := range c.versions {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectVersionsOutput{
+		Name:   params.Bucket,
+		Prefix: params.Prefix,
+	}
+
+	for i := range keys {
+		versions := c.versions[keys[i]]
+		for j := len(versions) - 1; j >= 0; j-- {
+			version := versions[j]
+			isLatest := j == len(versions)-1
+
+			if version.deleteMarker {
+				out.DeleteMarkers = append(out.DeleteMarkers, types.DeleteMarkerEntry{
+					Key:          &keys[i],
+					VersionId:    &version.versionID,
+					LastModified: &version.lastModified,
+					IsLatest:     isLatest,
+				})
+				continue
+			}
+
+			out.Versions = append(out.Versions, types.ObjectVersion{
+				Key:          &keys[i],
+				VersionId:    &version.versionID,
+				ETag:         &version.eTag,
+				LastModified: &version.lastModified,
+				IsLatest:     isLatest,
+				Size:         int64(len(version.data)),
+			})
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alexpcook/media-db/query"
+	"github.com/alexpcook/media-db/schema"
+)
+
+// Filter selects media entries by the values of their fields. The zero
+// value of each field matches every entry, and an entry must match every
+// field that is set. Text fields match when the field contains the text,
+// ignoring case, or when the whole field matches the text as a glob
+// pattern, if the text contains any of the characters *?[.
+type Filter struct {
+	// Title matches the title of an entry.
+	Title string
+
+	// Director matches the director of a movie. Music never matches.
+	Director string
+
+	// Artist matches the artist of music. Movies never match.
+	Artist string
+
+	// Year is the exact year an entry was made.
+	Year int
+
+	// YearMin and YearMax are the earliest and latest years an entry was
+	// made. Music whose year is not known never matches Year, YearMin or
+	// YearMax.
+	YearMin int
+	YearMax int
+
+	// WatchedAfter and WatchedBefore are Unix timestamps of the earliest and
+	// latest dates an entry was watched or listened to, both inclusive.
+	WatchedAfter  int64
+	WatchedBefore int64
+
+	// Where is a query expression that entries must also match, or nil.
+	Where *query.Query
+}
+
+// isGlob returns true if pattern contains any glob metacharacters.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globToRegexp converts a glob pattern to an anchored, case-insensitive
+// regular expression. Unlike path.Match, * and ? also match a slash, since
+// titles and names are not paths.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%q is not a valid pattern, [ is not closed", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a valid pattern", pattern)
+	}
+
+	return re, nil
+}
+
+// textMatcher matches a text field of an entry against a pattern. A glob
+// pattern is compiled once, when the matcher is made, rather than for every
+// entry that is matched.
+type textMatcher struct {
+	pattern string
+	glob    *regexp.Regexp
+}
+
+// newTextMatcher returns a textMatcher for pattern. It returns a non-nil
+// error if pattern is a glob that is not valid.
+func newTextMatcher(pattern string) (textMatcher, error) {
+	if !isGlob(pattern) {
+		return textMatcher{pattern: strings.ToLower(pattern)}, nil
+	}
+
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return textMatcher{}, err
+	}
+
+	return textMatcher{pattern: pattern, glob: re}, nil
+}
+
+// matches returns true if text contains the pattern, ignoring case, or
+// matches the pattern as a whole if the pattern is a glob.
+func (m textMatcher) matches(text string) bool {
+	switch {
+	case m.pattern == "":
+		return true
+	case m.glob != nil:
+		return m.glob.MatchString(text)
+	default:
+		return strings.Contains(strings.ToLower(text), m.pattern)
+	}
+}
+
+// filterMatcher matches entries against a filter whose patterns have
+// been compiled, so that many entries can be matched cheaply.
+type filterMatcher struct {
+	filter   Filter
+	title    textMatcher
+	director textMatcher
+	artist   textMatcher
+}
+
+// compile returns a filterMatcher for the filter. It returns a non-nil
+// error if any field of the filter is not valid, such as a glob pattern
+// that is not closed or a range that is empty.
+func (f Filter) compile() (*filterMatcher, error) {
+	m := &filterMatcher{filter: f}
+
+	for _, field := range []struct {
+		name    string
+		pattern string
+		matcher *textMatcher
+	}{
+		{"title", f.Title, &m.title},
+		{"director", f.Director, &m.director},
+		{"artist", f.Artist, &m.artist},
+	} {
+		matcher, err := newTextMatcher(field.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.name, err)
+		}
+		*field.matcher = matcher
+	}
+
+	if f.YearMin != 0 && f.YearMax != 0 && f.YearMin > f.YearMax {
+		return nil, fmt.Errorf("the earliest year %d is after the latest year %d", f.YearMin, f.YearMax)
+	}
+
+	if f.WatchedAfter != 0 && f.WatchedBefore != 0 && f.WatchedAfter > f.WatchedBefore {
+		return nil, fmt.Errorf("the earliest date watched is after the latest date watched")
+	}
+
+	return m, nil
+}
+
+// Validate returns a non-nil error if any field of the filter is not valid,
+// such as a glob pattern that is not closed or a range that is empty.
+func (f Filter) Validate() error {
+	_, err := f.compile()
+	return err
+}
+
+// Matches returns true if media matches every field of the filter that is
+// set. A filter that is not valid matches nothing. To match many entries,
+// ReadMatching compiles the filter once instead.
+func (f Filter) Matches(media schema.Media) bool {
+	m, err := f.compile()
+	return err == nil && m.matches(media)
+}
+
+// matches returns true if media matches every field of the filter that
+// is set.
+func (m *filterMatcher) matches(media schema.Media) bool {
+	f := m.filter
+
+	var title, director, artist string
+	var year int
+	var date int64
+
+	switch media := media.(type) {
+	case schema.Movie:
+		title, director, year, date = media.Title, media.Director, media.YearMade, media.DateWatched
+		if f.Artist != "" {
+			return false
+		}
+	case schema.Music:
+		title, artist, year, date = media.Title, media.Artist, media.YearMade, media.DateListened
+		if f.Director != "" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	switch {
+	case !m.title.matches(title), !m.director.matches(director), !m.artist.matches(artist):
+		return false
+	case f.Year != 0 && year != f.Year:
+		return false
+	case f.YearMin != 0 && year < f.YearMin, f.YearMax != 0 && year > f.YearMax:
+		return false
+	case year == 0 && (f.Year != 0 || f.YearMin != 0 || f.YearMax != 0):
+		// A year that is not known matches no year, in the same
+		// way that a missing field matches no query comparison.
+		return false
+	case f.WatchedAfter != 0 && date < f.WatchedAfter, f.WatchedBefore != 0 && date > f.WatchedBefore:
+		return false
+	case f.Where != nil && !f.Where.Matches(media):
+		return false
+	}
+
+	return true
+}
+
+// filterMedia returns the entries in media that match the filter of m.
+func filterMedia(media []schema.Media, m *filterMatcher) []schema.Media {
+	if m.filter == (Filter{}) {
+		return media
+	}
+
+	matched := make([]schema.Media, 0, len(media))
+	for _, entry := range media {
+		if m.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexpcook/media-db/query"
+	"github.com/alexpcook/media-db/schema"
+)
+
+func mustParseQuery(tt *testing.T, s string) *query.Query {
+	q, err := query.Parse(s)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	return q
+}
+
+func TestFilterMatches(tt *testing.T) {
+	movie := schema.Movie{Title: "The Dark Knight", Director: "Christopher Nolan", YearMade: 2008, DateWatched: 1609459200}
+	music := schema.Music{Title: "AC/DC Live", Artist: "AC/DC", YearMade: 1992, DateListened: 1640908800}
+	unknownYearMusic := schema.Music{Title: "AC/DC Live", Artist: "AC/DC", DateListened: 1640908800}
+
+	testCases := []struct {
+		name   string
+		filter Filter
+		media  schema.Media
+		want   bool
+	}{
+		{"empty", Filter{}, movie, true},
+		{"title-substring", Filter{Title: "dark"}, movie, true},
+		{"title-no-match", Filter{Title: "light"}, movie, false},
+		{"title-glob", Filter{Title: "the*KNIGHT"}, movie, true},
+		{"title-glob-whole", Filter{Title: "dark*"}, movie, false},
+		{"title-glob-slash", Filter{Title: "ac?dc*"}, music, true},
+		{"title-glob-class", Filter{Title: "[st]he *"}, movie, true},
+		{"title-glob-negated-class", Filter{Title: "[!t]he *"}, movie, false},
+		{"director", Filter{Director: "nolan"}, movie, true},
+		{"director-music", Filter{Director: "nolan"}, music, false},
+		{"artist", Filter{Artist: "ac/dc"}, music, true},
+		{"artist-movie", Filter{Artist: "nolan"}, movie, false},
+		{"year", Filter{Year: 2008}, movie, true},
+		{"year-no-match", Filter{Year: 2009}, movie, false},
+		{"year-range", Filter{YearMin: 2000, YearMax: 2010}, movie, true},
+		{"year-min", Filter{YearMin: 2009}, movie, false},
+		{"year-max", Filter{YearMax: 2007}, movie, false},
+		{"unknown-year", Filter{Year: 1992}, unknownYearMusic, false},
+		{"unknown-year-min", Filter{YearMin: 1900}, unknownYearMusic, false},
+		{"unknown-year-max", Filter{YearMax: 1990}, unknownYearMusic, false},
+		{"unknown-year-no-year-filter", Filter{Artist: "ac/dc"}, unknownYearMusic, true},
+		{"watched-after-inclusive", Filter{WatchedAfter: 1609459200}, movie, true},
+		{"watched-after", Filter{WatchedAfter: 1609545600}, movie, false},
+		{"watched-before-inclusive", Filter{WatchedBefore: 1640908800}, music, true},
+		{"watched-before", Filter{WatchedBefore: 1640822400}, music, false},
+		{"where", Filter{Where: mustParseQuery(tt, `director ~ "nolan" and date in 2021`)}, movie, true},
+		{"where-no-match", Filter{Title: "knight", Where: mustParseQuery(tt, "year < 2000")}, movie, false},
+		{"all-fields", Filter{Title: "knight", Director: "nolan", YearMin: 2000, WatchedBefore: 1640908800}, movie, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			if got := test.filter.Matches(test.media); got != test.want {
+				subtt.Fatalf("want %t, got %t", test.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterValidate(tt *testing.T) {
+	testCases := []struct {
+		name    string
+		filter  Filter
+		isError bool
+	}{
+		{"empty", Filter{}, false},
+		{"glob", Filter{Title: "the [a-z]*"}, false},
+		{"unclosed-class", Filter{Director: "[nolan"}, true},
+		{"year-range", Filter{YearMin: 2000, YearMax: 2000}, false},
+		{"empty-year-range", Filter{YearMin: 2001, YearMax: 2000}, true},
+		{"empty-date-range", Filter{WatchedAfter: 1640908800, WatchedBefore: 1609459200}, true},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			err := test.filter.Validate()
+
+			if test.isError && err == nil {
+				subtt.Fatal("want error, got nil")
+			} else if !test.isError && err != nil {
+				subtt.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReadMatching(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Filtered Title", "A Filtered Director", 1999, "2021-05-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	music, err := schema.NewMusic("A Filtered Song", "A Filtered Artist", 2001, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	for _, media := range []schema.Media{movie, music} {
+		err = client.Create(context.TODO(), media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, media := range []schema.Media{*movie, *music} {
+			err = client.Delete(context.TODO(), schema.GetIDFromKey(media.Key()), media, "")
+			if err != nil {
+				tt.Fatal(err)
+			}
+		}
+	}()
+
+	res, err := client.ReadMatching(context.TODO(), "", nil, Filter{Title: "a filtered *"})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 2 {
+		tt.Fatalf("want 2 entries, got %d", len(res))
+	}
+
+	res, err = client.ReadMatching(context.TODO(), "", nil, Filter{Title: "filtered", YearMin: 2000})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 1 || res[0] != *music {
+		tt.Fatalf("want %v, got %v", *music, res)
+	}
+
+	res, err = client.ReadMatching(context.TODO(), "", schema.Music{}, Filter{Director: "filtered"})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 0 {
+		tt.Fatalf("want no entries, got %v", res)
+	}
+
+	_, err = client.ReadMatching(context.TODO(), "", nil, Filter{YearMin: 2001, YearMax: 2000})
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// EntryVersion is a stored version of a media entry. Media is nil for a
+// version that records the entry being deleted. Err is non-nil, and Media
+// is nil, for a version that cannot be read, such as one encrypted with a
+// key that a rekey has since replaced.
+type EntryVersion struct {
+	Version  string
+	Modified time.Time
+	Current  bool
+	Media    schema.Media
+	Err      error
+}
+
+// versionedBackend returns the backend of cl as a VersionedBackend. It
+// returns ErrVersioningUnsupported if the backend does not keep versions.
+func (cl *MediaDbClient) versionedBackend() (VersionedBackend, error) {
+	backend, ok := cl.backend.(VersionedBackend)
+	if !ok {
+		return nil, ErrVersioningUnsupported
+	}
+
+	return backend, nil
+}
+
+// getVersionData reads the given version of the object stored under
+// objKey in backend. It returns ErrDecryption if the version is encrypted
+// and cannot be decrypted, such as a version written before a rekey, or
+// one written before encryption was turned off.
+func getVersionData(ctx context.Context, backend VersionedBackend, objKey, version string) ([]byte, error) {
+	data, err := backend.GetVersion(ctx, objKey, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, getEncryptionHeader()) {
+		return nil, fmt.Errorf("%w: version %s of %s is encrypted with a key that is no longer used", ErrDecryption, version, objKey)
+	}
+
+	return data, nil
+}
+
+// History retrieves every stored version of the media entry with the given
+// id and type, from the most recent to the oldest. A version that cannot be
+// decrypted is returned with its Err set, rather than failing the whole
+// history. It returns a non-nil
+// error if the history cannot be read, wrapping ErrNotFound if there has
+// never been an entry with that id, or ErrVersioningUnsupported if the
+// database does not keep previous versions.
+func (cl *MediaDbClient) History(ctx context.Context, id string, mediaType schema.Media) ([]EntryVersion, error) {
+	backend, err := cl.versionedBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	objKey := strings.Join([]string{schema.GetBaseKeyFromMediaType(mediaType), id}, "/")
+
+	objVersions, err := backend.ListVersions(ctx, objKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(objVersions) == 0 {
+		return nil, entryNotFoundError(id, mediaType)
+	}
+
+	entryVersions := make([]EntryVersion, len(objVersions))
+
+	err = cl.runConcurrently(ctx, len(objVersions), func(ctx context.Context, i int) error {
+		entryVersions[i] = EntryVersion{
+			Version:  objVersions[i].ID,
+			Modified: objVersions[i].LastModified,
+			Current:  objVersions[i].IsLatest,
+		}
+		if objVersions[i].IsDeleteMarker {
+			return nil
+		}
+
+		jsonData, err := getVersionData(ctx, backend, objKey, objVersions[i].ID)
+		if errors.Is(err, ErrDecryption) {
+			entryVersions[i].Err = err
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		entryVersions[i].Media, err = decodeMedia(objKey, jsonData)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entryVersions, nil
+}
+
+// Revert changes the media entry with the given id and type back to the
+// state it had in the given version, as returned by History, and returns
+// the reverted entry. The revert is itself stored as a new version, so it
+// can also be undone. It returns a non-nil error if the entry cannot be
+// reverted, wrapping ErrNotFound if the version does not exist or the entry
+// is not currently in the database.
+func (cl *MediaDbClient) Revert(ctx context.Context, id string, mediaType schema.Media, version string) (schema.Media, error) {
+	backend, err := cl.versionedBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	objKey := strings.Join([]string{schema.GetBaseKeyFromMediaType(mediaType), id}, "/")
+
+	objVersions, err := backend.ListVersions(ctx, objKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, objVersion := range objVersions {
+		if objVersion.ID != version {
+			continue
+		}
+
+		if objVersion.IsDeleteMarker {
+			return nil, fmt.Errorf("version %s records the deletion of entry %s, so it cannot be reverted to", version, id)
+		}
+
+		jsonData, err := getVersionData(ctx, backend, objKey, version)
+		if err != nil {
+			return nil, err
+		}
+
+		media, err := decodeMedia(objKey, jsonData)
+		if err != nil {
+			return nil, err
+		}
+
+		err = cl.Update(ctx, id, media, "")
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("entry %s is not in the database, restore it from the trash before reverting it: %w", id, err)
+		} else if err != nil {
+			return nil, err
+		}
+
+		return media, nil
+	}
+
+	return nil, newNotFoundError("entry %s has no version %s", id, version)
+}
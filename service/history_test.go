@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestHistory(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("requires an S3 bucket with versioning enabled")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	music, err := schema.NewMusic("A Title", "An Artist", 1977, "2021-08-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), music)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	updatedMusic := *music
+	updatedMusic.Title = "An Updated Title"
+
+	err = client.Update(context.TODO(), music.ID, updatedMusic, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	history, err := client.History(context.TODO(), music.ID, schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(history) != 2 {
+		tt.Fatalf("want 2 versions, got %d", len(history))
+	}
+	if !history[0].Current || history[1].Current {
+		tt.Fatal("want only the most recent version to be current")
+	}
+	if !reflect.DeepEqual(updatedMusic, history[0].Media) {
+		tt.Fatalf("want %v, got %v", updatedMusic, history[0].Media)
+	}
+	if !reflect.DeepEqual(*music, history[1].Media) {
+		tt.Fatalf("want %v, got %v", *music, history[1].Media)
+	}
+
+	reverted, err := client.Revert(context.TODO(), music.ID, schema.Music{}, history[1].Version)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(*music, reverted) {
+		tt.Fatalf("want %v, got %v", *music, reverted)
+	}
+
+	res, err := client.Read(context.TODO(), music.ID, schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 1 || !reflect.DeepEqual(*music, res[0]) {
+		tt.Fatalf("want [%v], got %v", *music, res)
+	}
+
+	_, err = client.Revert(context.TODO(), music.ID, schema.Music{}, "not-a-version")
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	err = client.Delete(context.TODO(), music.ID, schema.Music{}, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	history, err = client.History(context.TODO(), music.ID, schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(history) != 4 {
+		tt.Fatalf("want 4 versions, got %d", len(history))
+	}
+	if history[0].Media != nil {
+		tt.Fatalf("want the deletion to be the most recent version, got %v", history[0].Media)
+	}
+
+	// A deleted entry must be restored from the trash before it is reverted.
+	_, err = client.Revert(context.TODO(), music.ID, schema.Music{}, history[1].Version)
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	_, err = client.Revert(context.TODO(), music.ID, schema.Music{}, history[0].Version)
+	if err == nil {
+		tt.Fatal("want error reverting to a deletion, got nil")
+	}
+
+	_, err = client.History(context.TODO(), "not-an-id", schema.Music{})
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestHistoryUnsupported(tt *testing.T) {
+	cfg, err := config.NewLocalMediaDbConfig(tt.TempDir())
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	client, err := NewMediaDbClient(cfg)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = client.History(context.TODO(), "123", schema.Movie{})
+	if !errors.Is(err, ErrVersioningUnsupported) {
+		tt.Fatalf("want %v, got %v", ErrVersioningUnsupported, err)
+	}
+
+	_, err = client.Revert(context.TODO(), "123", schema.Movie{}, "1")
+	if !errors.Is(err, ErrVersioningUnsupported) {
+		tt.Fatalf("want %v, got %v", ErrVersioningUnsupported, err)
+	}
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// mediaIndex is the index object for a single type of media. It holds the
+// stored JSON of every entry of that type keyed by id, so that reading all
+// entries of the type takes a single request to the backend.
+type mediaIndex struct {
+	Entries map[string]json.RawMessage `json:"entries"`
+}
+
+// newMediaIndex returns an empty mediaIndex.
+func newMediaIndex() *mediaIndex {
+	return &mediaIndex{
+		Entries: make(map[string]json.RawMessage),
+	}
+}
+
+// media decodes the index entries whose id begins with idPrefix, in key order.
+func (idx *mediaIndex) media(mediaType schema.Media, idPrefix string) ([]schema.Media, error) {
+	baseKey := schema.GetBaseKeyFromMediaType(mediaType)
+
+	keys := make([]string, 0, len(idx.Entries))
+	for id := range idx.Entries {
+		if strings.HasPrefix(id, idPrefix) {
+			keys = append(keys, baseKey+"/"+id)
+		}
+	}
+	sort.Strings(keys)
+
+	mediaRes := make([]schema.Media, 0, len(keys))
+	for _, key := range keys {
+		media, err := decodeMedia(key, idx.Entries[schema.GetIDFromKey(key)])
+		if err != nil {
+			return nil, err
+		}
+		mediaRes = append(mediaRes, media)
+	}
+
+	return mediaRes, nil
+}
+
+// loadIndex gets the index object for mediaType from the backend, along
+// with its ETag. It returns ErrNotFound if the index has not been built
+// for that type.
+func (cl *MediaDbClient) loadIndex(ctx context.Context, mediaType schema.Media) (*mediaIndex, string, error) {
+	jsonData, eTag, err := cl.backend.Get(ctx, schema.GetIndexKeyFromMediaType(mediaType))
+	if err != nil {
+		return nil, "", err
+	}
+
+	idx := newMediaIndex()
+	err = json.Unmarshal(jsonData, idx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return idx, eTag, nil
+}
+
+// saveIndex puts the index object for mediaType in the backend. If ifMatch
+// is not the empty string "", the index is only saved if its current ETag
+// is ifMatch.
+func (cl *MediaDbClient) saveIndex(ctx context.Context, mediaType schema.Media, idx *mediaIndex, ifMatch string) error {
+	jsonData, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.backend.Put(ctx, schema.GetIndexKeyFromMediaType(mediaType), jsonData, ifMatch)
+	return err
+}
+
+// buildIndex creates the index for mediaType from the individual entry
+// objects stored in the backend.
+func (cl *MediaDbClient) buildIndex(ctx context.Context, mediaType schema.Media) (*mediaIndex, error) {
+	keys, err := listAllKeys(ctx, cl.backend, schema.GetBaseKeyFromMediaType(mediaType)+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := cl.getMedia(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := newMediaIndex()
+	for i := range media {
+		jsonData, err := schema.MarshalMedia(media[i])
+		if err != nil {
+			return nil, err
+		}
+		idx.Entries[schema.GetIDFromKey(keys[i])] = jsonData
+	}
+
+	return idx, nil
+}
+
+// getMaxIndexUpdateAttempts returns the number of times an index update
+// is attempted when other writers keep changing the index at the same time.
+func getMaxIndexUpdateAttempts() int {
+	return 5
+}
+
+// updateIndex applies change to the index for mediaType and saves it. If
+// the index has not been built yet, it is built first so that it does not
+// omit any existing entries. The index is saved conditionally on its ETag,
+// or on there being no index if it was built, so if another writer changes
+// or creates it in the meantime, the update is retried against the new
+// index rather than overwriting the other change.
+func (cl *MediaDbClient) updateIndex(ctx context.Context, mediaType schema.Media, change func(idx *mediaIndex)) error {
+	var err error
+
+	for attempt := 0; attempt < getMaxIndexUpdateAttempts(); attempt++ {
+		idx, eTag, loadErr := cl.loadIndex(ctx, mediaType)
+		if errors.Is(loadErr, ErrNotFound) {
+			eTag = getNoObjectETag()
+			idx, loadErr = cl.buildIndex(ctx, mediaType)
+		}
+		if loadErr != nil {
+			return indexUpdateError(loadErr)
+		}
+
+		change(idx)
+
+		err = cl.saveIndex(ctx, mediaType, idx, eTag)
+		if !errors.Is(err, ErrPreconditionFailed) {
+			break
+		}
+	}
+	if err != nil {
+		return indexUpdateError(err)
+	}
+
+	return nil
+}
+
+// isIndexKey returns true if key is the key of the index
+// of any type of media, rather than of an entry.
+func isIndexKey(key string) bool {
+	for _, mediaType := range schema.GetAllMediaTypes() {
+		if key == schema.GetIndexKeyFromMediaType(mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexUpdateError annotates err to explain that the entry itself was
+// changed in the database but the index may no longer match it.
+func indexUpdateError(err error) error {
+	return fmt.Errorf("the entry was changed, but the index could not be updated (run 'media-db reindex' to fix it): %w", err)
+}
+
+// Reindex rebuilds the index of every type of media from the individual
+// entry objects in the database. This repairs an index that has drifted
+// from the entries, for example after an interrupted write or concurrent
+// writes from two machines. The index is saved conditionally on the ETag it
+// had before it was rebuilt, so if an entry is written in the meantime, the
+// index is rebuilt again rather than losing the entry. It returns the number
+// of entries indexed and a non-nil error if any index cannot be rebuilt.
+func (cl *MediaDbClient) Reindex(ctx context.Context) (int, error) {
+	numEntries := 0
+
+	for _, mediaType := range schema.GetAllMediaTypes() {
+		var idx *mediaIndex
+		var err error
+
+		for attempt := 0; attempt < getMaxIndexUpdateAttempts(); attempt++ {
+			var eTag string
+			eTag, err = cl.backend.Head(ctx, schema.GetIndexKeyFromMediaType(mediaType))
+			if errors.Is(err, ErrNotFound) {
+				eTag = getNoObjectETag()
+			} else if err != nil {
+				return numEntries, err
+			}
+
+			idx, err = cl.buildIndex(ctx, mediaType)
+			if err != nil {
+				return numEntries, err
+			}
+
+			err = cl.saveIndex(ctx, mediaType, idx, eTag)
+			if !errors.Is(err, ErrPreconditionFailed) {
+				break
+			}
+		}
+		if err != nil {
+			return numEntries, err
+		}
+
+		numEntries += len(idx.Entries)
+	}
+
+	return numEntries, nil
+}
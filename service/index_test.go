@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestIndex(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("An Indexed Title", "An Indexed Director", 1999, "2021-05-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err = client.Delete(context.TODO(), movie.ID, *movie, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	idx, _, err := client.loadIndex(context.TODO(), schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if _, ok := idx.Entries[movie.ID]; !ok {
+		tt.Fatalf("want movie %s in index, got %v", movie.ID, idx.Entries)
+	}
+
+	// Reading every movie is a single request when the index exists.
+	tracker := &trackingBackend{Backend: client.backend}
+	trackedClient := NewMediaDbClientFromBackend(tracker)
+	tracker.failKey = movie.Key()
+
+	res, err := trackedClient.Read(context.TODO(), "", schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if len(res) != 1 {
+		tt.Fatalf("want 1 entry, got %d", len(res))
+	}
+
+	// Simulate drift by writing an entry object without updating the index.
+	driftMovie, err := schema.NewMovie("A Drifted Title", "A Drifted Director", 2001, "2021-05-02")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	jsonData, err := json.Marshal(driftMovie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = client.backend.Put(context.TODO(), driftMovie.Key(), jsonData, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err = client.Delete(context.TODO(), driftMovie.ID, *driftMovie, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	res, err = client.Read(context.TODO(), "", schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if len(res) != 1 {
+		tt.Fatalf("want 1 entry before reindex, got %d", len(res))
+	}
+
+	numEntries, err := client.Reindex(context.TODO())
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if numEntries != 2 {
+		tt.Fatalf("want 2 entries reindexed, got %d", numEntries)
+	}
+
+	res, err = client.Read(context.TODO(), "", schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if len(res) != 2 {
+		tt.Fatalf("want 2 entries after reindex, got %d", len(res))
+	}
+
+	// Filtering on an id reads from the index as well.
+	res, err = client.Read(context.TODO(), driftMovie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if len(res) != 1 || res[0].Key() != driftMovie.Key() {
+		tt.Fatalf("want only entry %s, got %v", driftMovie.Key(), res)
+	}
+}
+
+func TestIndexConcurrentWrite(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("makes a conflicting change in an in-memory database")
+	}
+
+	testCases := []struct {
+		name   string
+		before func(client *MediaDbClient) error
+		write  func(client *MediaDbClient, movie *schema.Movie) error
+	}{
+		{"create-index", nil, func(client *MediaDbClient, movie *schema.Movie) error {
+			return client.Create(context.TODO(), movie)
+		}},
+		{"reindex", func(client *MediaDbClient) error {
+			_, err := client.Reindex(context.TODO())
+			return err
+		}, func(client *MediaDbClient, movie *schema.Movie) error {
+			jsonData, err := json.Marshal(movie)
+			if err != nil {
+				return err
+			}
+			_, err = client.backend.Put(context.TODO(), movie.Key(), jsonData, "")
+			if err != nil {
+				return err
+			}
+			_, err = client.Reindex(context.TODO())
+			return err
+		}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			bucket := "media-db-test-bucket"
+			s3Client := newFakeS3Client(bucket)
+			backend, err := newS3BackendFromAPI(s3Client, bucket, 0)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			client := NewMediaDbClientFromBackend(backend)
+
+			if test.before != nil {
+				err = test.before(client)
+				if err != nil {
+					subtt.Fatal(err)
+				}
+			}
+
+			movie, err := schema.NewMovie("My Title", "My Director", 1999, "2021-05-01")
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			otherMovie, err := schema.NewMovie("Their Title", "Their Director", 2001, "2021-05-02")
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			// Another writer creates an entry just before the index is saved.
+			indexKey := schema.GetIndexKeyFromMediaType(schema.Movie{})
+			s3Client.beforeWrite = func(key string) {
+				if key != indexKey {
+					return
+				}
+				s3Client.beforeWrite = nil
+
+				err := NewMediaDbClientFromBackend(backend).Create(context.TODO(), otherMovie)
+				if err != nil {
+					subtt.Fatal(err)
+				}
+			}
+
+			err = test.write(client, movie)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			res, err := client.Read(context.TODO(), "", schema.Movie{})
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			if len(res) != 2 {
+				subtt.Fatalf("want both entries in the index, got %v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/alexpcook/media-db/config"
+)
+
+// localBackend is a Backend that stores objects as files under a directory
+// on the local filesystem. The key of an object is its slash-separated path
+// relative to that directory. The ETag of an object is the MD5 hash of its
+// contents, the same as S3 uses for objects uploaded in a single request.
+type localBackend struct {
+	dir string
+
+	// mu makes conditional requests atomic within this process. The local
+	// backend is not intended to be shared by processes writing at once.
+	mu sync.Mutex
+}
+
+// newLocalBackend creates a localBackend from the directory in the given
+// MediaDbConfig. The directory is created if it does not already exist.
+func newLocalBackend(mediaDbConfig *cfg.MediaDbConfig) (*localBackend, error) {
+	err := os.MkdirAll(mediaDbConfig.LocalDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localBackend{
+		dir: mediaDbConfig.LocalDir,
+	}, nil
+}
+
+// path returns the file path for key. It returns a non-nil error if
+// the key would resolve to a file outside of the backend directory.
+func (b *localBackend) path(key string) (string, error) {
+	cleanKey := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleanKey) || cleanKey == ".." || strings.HasPrefix(cleanKey, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %q is not a valid object key", key)
+	}
+
+	return filepath.Join(b.dir, cleanKey), nil
+}
+
+// Put writes data to the file for key. The data is written to a temporary
+// file first so that a partially written object is never visible.
+func (b *localBackend) Put(ctx context.Context, key string, data []byte, ifMatch string) (string, error) {
+	objPath, err := b.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ifMatch != "" {
+		err = checkETag(ctx, b, key, ifMatch)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	objDir := filepath.Dir(objPath)
+	err = os.MkdirAll(objDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	tempFile, err := os.CreateTemp(objDir, ".media_db_object")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tempFile.Name(), objPath)
+	if err != nil {
+		return "", err
+	}
+
+	return computeETag(data), nil
+}
+
+// Get reads the file for key.
+func (b *localBackend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	objPath, err := b.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(objPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotFound, key)
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	return data, computeETag(data), nil
+}
+
+// List returns a page of keys of the files under the backend directory
+// that begin with prefix. The token is the last key of the previous page.
+// Only the directory that holds the keys with the prefix is walked, in the
+// lexical order of the keys, and the walk stops once the page is full.
+func (b *localBackend) List(ctx context.Context, prefix, token string, maxKeys int) ([]string, string, error) {
+	// Every key that begins with prefix is under the directory
+	// named by the prefix up to its last slash.
+	dirKey := prefix[:strings.LastIndex(prefix, "/")+1]
+
+	dir := b.dir
+	if dirKey != "" {
+		var err error
+		dir, err = b.path(dirKey)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// One key more than the page is listed to tell if there are more keys.
+	keys := make([]string, 0)
+	err := listDir(dir, dirKey, prefix, token, maxKeys+1, &keys)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		return keys, keys[len(keys)-1], nil
+	}
+
+	return keys, "", nil
+}
+
+// listDir appends to keys, in lexical order, the keys of the files under
+// dir that begin with prefix and come after token, where the keys of the
+// files in dir begin with dirKey. It stops once there are limit keys.
+func listDir(dir, dirKey, prefix, token string, limit int, keys *[]string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// A directory is ordered by the keys under it, which
+	// continue with a slash, rather than by its name alone.
+	entryKeys := make([]string, 0, len(entries))
+	isDir := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		// Temporary files from in-progress writes are hidden.
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		key := dirKey + entry.Name()
+		if entry.IsDir() {
+			key += "/"
+			isDir[key] = true
+		}
+		entryKeys = append(entryKeys, key)
+	}
+	sort.Strings(entryKeys)
+
+	for _, key := range entryKeys {
+		if len(*keys) >= limit {
+			return nil
+		}
+
+		if !isDir[key] {
+			if strings.HasPrefix(key, prefix) && key > token {
+				*keys = append(*keys, key)
+			}
+			continue
+		}
+
+		// Skip a directory whose keys cannot begin with prefix, or
+		// whose keys all come before token.
+		if !strings.HasPrefix(key, prefix) && !strings.HasPrefix(prefix, key) {
+			continue
+		}
+		if key < token && !strings.HasPrefix(token, key) {
+			continue
+		}
+
+		err = listDir(filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(key, dirKey))), key, prefix, token, limit, keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Head returns the ETag of the file for key.
+func (b *localBackend) Head(ctx context.Context, key string) (string, error) {
+	objPath, err := b.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	fileInfo, err := os.Stat(objPath)
+	if errors.Is(err, os.ErrNotExist) || err == nil && fileInfo.IsDir() {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, key)
+	} else if err != nil {
+		return "", err
+	}
+
+	_, eTag, err := b.Get(ctx, key)
+	return eTag, err
+}
+
+// LastModified returns the modification time of the file for key.
+func (b *localBackend) LastModified(ctx context.Context, key string) (time.Time, error) {
+	objPath, err := b.path(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	fileInfo, err := os.Stat(objPath)
+	if errors.Is(err, os.ErrNotExist) || err == nil && fileInfo.IsDir() {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	return fileInfo.ModTime(), nil
+}
+
+// Delete removes the file for key. Like S3, deleting a key
+// that does not exist is not an error unless it is conditional.
+func (b *localBackend) Delete(ctx context.Context, key string, ifMatch string) error {
+	objPath, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ifMatch != "" {
+		err = checkETag(ctx, b, key, ifMatch)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Remove(objPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
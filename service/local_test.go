@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/config"
+)
+
+func TestLocalBackend(tt *testing.T) {
+	cfg, err := config.NewLocalMediaDbConfig(tt.TempDir())
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	backend, err := newLocalBackend(cfg)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	ctx := context.TODO()
+	key := "media/movie/123"
+
+	_, err = backend.Head(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	putETag, err := backend.Put(ctx, key, []byte(`{"id": "123"}`), "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = backend.Put(ctx, "media/music/456", []byte(`{"id": "456"}`), "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	headETag, err := backend.Head(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if putETag != headETag {
+		tt.Fatalf("want ETag %s, got %s", putETag, headETag)
+	}
+
+	lastModified, err := backend.LastModified(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if since := time.Since(lastModified); since < 0 || since > time.Minute {
+		tt.Fatalf("want a last modified time of about now, got %v", lastModified)
+	}
+
+	data, getETag, err := backend.Get(ctx, key)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := `{"id": "123"}`; want != string(data) {
+		tt.Fatalf("want %s, got %s", want, data)
+	}
+	if putETag != getETag {
+		tt.Fatalf("want ETag %s, got %s", putETag, getETag)
+	}
+
+	keys, token, err := backend.List(ctx, "media/movie", "", getMaxPageSize())
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []string{key}; !reflect.DeepEqual(want, keys) {
+		tt.Fatalf("want %v, got %v", want, keys)
+	}
+	if token != "" {
+		tt.Fatalf("want empty token, got %q", token)
+	}
+
+	// List the keys one page at a time.
+	keys, token, err = backend.List(ctx, "", "", 1)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []string{key}; !reflect.DeepEqual(want, keys) {
+		tt.Fatalf("want %v, got %v", want, keys)
+	}
+
+	keys, token, err = backend.List(ctx, "", token, 1)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []string{"media/music/456"}; !reflect.DeepEqual(want, keys) {
+		tt.Fatalf("want %v, got %v", want, keys)
+	}
+	if token != "" {
+		tt.Fatalf("want empty token, got %q", token)
+	}
+
+	// A conditional put succeeds only against the current ETag.
+	newETag, err := backend.Put(ctx, key, []byte(`{"id": "123", "title": "new"}`), putETag)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if newETag == putETag {
+		tt.Fatal("want ETag to change after put")
+	}
+
+	_, err = backend.Put(ctx, key, []byte(`{"id": "123"}`), putETag)
+	if !errors.Is(err, ErrPreconditionFailed) {
+		tt.Fatalf("want %v, got %v", ErrPreconditionFailed, err)
+	}
+
+	// A put that creates an object only succeeds if there is none.
+	_, err = backend.Put(ctx, key, []byte(`{"id": "123"}`), getNoObjectETag())
+	if !errors.Is(err, ErrPreconditionFailed) {
+		tt.Fatalf("want %v, got %v", ErrPreconditionFailed, err)
+	}
+
+	// The same applies to a conditional delete.
+	err = backend.Delete(ctx, key, putETag)
+	if !errors.Is(err, ErrPreconditionFailed) {
+		tt.Fatalf("want %v, got %v", ErrPreconditionFailed, err)
+	}
+
+	err = backend.Delete(ctx, key, newETag)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Deleting a key that does not exist is not an error.
+	err = backend.Delete(ctx, key, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, _, err = backend.Get(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	_, err = backend.LastModified(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	// Keys must not escape the backend directory.
+	_, err = backend.Put(ctx, "../outside", []byte("{}"), "")
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
+
+func TestLocalBackendList(tt *testing.T) {
+	cfg, err := config.NewLocalMediaDbConfig(tt.TempDir())
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	backend, err := newLocalBackend(cfg)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// A directory is listed by the keys under it, so media/movie/ comes
+	// after media/movie-old and media/movie.json, which sort before a slash.
+	allKeys := []string{
+		"media/movie/1", "media/movie/2", "media/movie/3", "media/movie-old", "media/movie.json",
+		"media/movies/1", "media/music/1", "media/index/movie", "trash/movie/1", "top",
+	}
+	for _, key := range allKeys {
+		_, err = backend.Put(context.TODO(), key, []byte("{}"), "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		prefix  string
+		maxKeys int
+		want    []string
+	}{
+		{"all", "", 3, []string{"media/index/movie", "media/movie-old", "media/movie.json", "media/movie/1", "media/movie/2", "media/movie/3", "media/movies/1", "media/music/1", "top", "trash/movie/1"}},
+		{"name-prefix", "media/movie", 2, []string{"media/movie-old", "media/movie.json", "media/movie/1", "media/movie/2", "media/movie/3", "media/movies/1"}},
+		{"directory", "media/movie/", 2, []string{"media/movie/1", "media/movie/2", "media/movie/3"}},
+		{"one-page", "media/movie/", 3, []string{"media/movie/1", "media/movie/2", "media/movie/3"}},
+		{"missing-directory", "media/book/", 2, []string{}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			got := make([]string, 0)
+			token := ""
+
+			for {
+				keys, nextToken, err := backend.List(context.TODO(), test.prefix, token, test.maxKeys)
+				if err != nil {
+					subtt.Fatal(err)
+				}
+				if len(keys) > test.maxKeys {
+					subtt.Fatalf("want at most %d keys, got %v", test.maxKeys, keys)
+				}
+				got = append(got, keys...)
+
+				if nextToken == "" {
+					break
+				}
+				token = nextToken
+			}
+
+			if !reflect.DeepEqual(test.want, got) {
+				subtt.Fatalf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// MigrateResult counts the objects checked by Migrate, and the objects
+// that were stored in an older version of the document format.
+type MigrateResult struct {
+	Checked  int
+	Outdated int
+}
+
+// isOutdatedDocument returns true if the stored JSON document in jsonData
+// is in an older version of the document format than the current one. It
+// returns a non-nil error if the document was written by a newer release.
+func isOutdatedDocument(jsonData []byte) (bool, error) {
+	version, err := schema.GetDocumentVersion(jsonData)
+	if err != nil {
+		return false, err
+	}
+
+	if version > schema.GetSchemaVersion() {
+		return false, fmt.Errorf("document version %d is newer than the latest version %d, upgrade media-db to migrate it", version, schema.GetSchemaVersion())
+	}
+
+	return version < schema.GetSchemaVersion(), nil
+}
+
+// migrateTrashObject returns the trash object in trashData with its entry
+// upgraded to the current version of the document format, or nil if the
+// entry is already the current version.
+func migrateTrashObject(mediaType schema.Media, trashData []byte) ([]byte, error) {
+	trashObj := trashObject{}
+	err := json.Unmarshal(trashData, &trashObj)
+	if err != nil {
+		return nil, err
+	}
+
+	isOutdated, err := isOutdatedDocument(trashObj.Entry)
+	if err != nil || !isOutdated {
+		return nil, err
+	}
+
+	trashObj.Entry, err = schema.UpgradeDocument(mediaType, trashObj.Entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(trashObj)
+}
+
+// isOutdatedIndex returns true if any entry in the index
+// in indexData is in an older version of the document format.
+func isOutdatedIndex(indexData []byte) (bool, error) {
+	idx := newMediaIndex()
+	err := json.Unmarshal(indexData, idx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, jsonData := range idx.Entries {
+		isOutdated, err := isOutdatedDocument(jsonData)
+		if err != nil || isOutdated {
+			return isOutdated, err
+		}
+	}
+
+	return false, nil
+}
+
+// migrateObject returns the object stored under key, whose data is data,
+// upgraded to the current version of the document format, or nil if it is
+// already the current version. An outdated index is not upgraded, since it
+// is rebuilt instead, so isOutdated is also returned.
+func migrateObject(key string, data []byte) (newData []byte, isOutdated bool, err error) {
+	for _, mediaType := range schema.GetAllMediaTypes() {
+		switch {
+		case key == schema.GetIndexKeyFromMediaType(mediaType):
+			isOutdated, err = isOutdatedIndex(data)
+			return nil, isOutdated, err
+		case strings.HasPrefix(key, schema.GetTrashKeyFromMediaType(mediaType)+"/"):
+			newData, err = migrateTrashObject(mediaType, data)
+			return newData, newData != nil, err
+		case strings.HasPrefix(key, schema.GetBaseKeyFromMediaType(mediaType)+"/"):
+			isOutdated, err = isOutdatedDocument(data)
+			if err != nil || !isOutdated {
+				return nil, false, err
+			}
+			newData, err = schema.UpgradeDocument(mediaType, data)
+			return newData, true, err
+		}
+	}
+
+	return nil, false, nil
+}
+
+// Migrate rewrites every entry in the database, including the deleted
+// entries in the trash, that is stored in an older version of the document
+// format in the current version, and rebuilds any index that holds such
+// an entry. Entries are upgraded whenever they are read in any case, so
+// migrating only saves doing this on every read. If dryRun is true, the
+// outdated objects are counted but not changed. Each object is only
+// rewritten if it has not been changed since it was checked. It returns
+// the objects checked and a non-nil error if any object cannot be read,
+// upgraded, or written, including an object written by a newer release.
+func (cl *MediaDbClient) Migrate(ctx context.Context, dryRun bool) (MigrateResult, error) {
+	result := MigrateResult{}
+
+	keys, err := listAllKeys(ctx, cl.backend, schema.GetRootKey()+"/")
+	if err != nil {
+		return result, err
+	}
+
+	isOutdated := make([]bool, len(keys))
+	err = cl.runConcurrently(ctx, len(keys), func(ctx context.Context, i int) error {
+		data, eTag, err := cl.backend.Get(ctx, keys[i])
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		newData, outdated, err := migrateObject(keys[i], data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", keys[i], err)
+		}
+		isOutdated[i] = outdated
+
+		if dryRun || newData == nil {
+			return nil
+		}
+
+		_, err = cl.backend.Put(ctx, keys[i], newData, eTag)
+		return err
+	})
+
+	result.Checked = len(keys)
+	for _, outdated := range isOutdated {
+		if outdated {
+			result.Outdated++
+		}
+	}
+	if err != nil || dryRun || result.Outdated == 0 {
+		return result, err
+	}
+
+	_, err = cl.Reindex(ctx)
+	return result, err
+}
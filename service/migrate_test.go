@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestMigrate(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("migrate rewrites every object in the database")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("An Old Title", "An Old Director", 1999, "2021-05-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	deletedMusic, err := schema.NewMusic("An Old Song", "An Old Artist", 1985, "2021-05-02")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	newMovie, err := schema.NewMovie("A New Title", "A New Director", 2020, "2021-05-03")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Entries written before the document format had versions.
+	for _, media := range []schema.Media{*movie, *deletedMusic} {
+		jsonData, err := json.Marshal(media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		_, err = client.backend.Put(context.TODO(), media.Key(), jsonData, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	err = client.Delete(context.TODO(), deletedMusic.ID, *deletedMusic, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), newMovie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// An index written before the document format had versions.
+	oldMovieData, err := json.Marshal(movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.updateIndex(context.TODO(), schema.Movie{}, func(idx *mediaIndex) {
+		idx.Entries[movie.ID] = oldMovieData
+	})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// The old movie, the trash object, and the movie index are outdated,
+	// but the new movie and the empty music index are not.
+	want := MigrateResult{Checked: 5, Outdated: 3}
+
+	res, err := client.Migrate(context.TODO(), true)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want != res {
+		tt.Fatalf("want %+v, got %+v", want, res)
+	}
+
+	jsonData, _, err := client.backend.Get(context.TODO(), movie.Key())
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if version, _ := schema.GetDocumentVersion(jsonData); version != 0 {
+		tt.Fatalf("want dry run to leave version 0, got %d", version)
+	}
+
+	res, err = client.Migrate(context.TODO(), false)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want != res {
+		tt.Fatalf("want %+v, got %+v", want, res)
+	}
+
+	res, err = client.Migrate(context.TODO(), true)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := (MigrateResult{Checked: 5}); want != res {
+		tt.Fatalf("want nothing outdated after migrating, got %+v", res)
+	}
+
+	readMovie, _, err := client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if *movie != readMovie {
+		tt.Fatalf("want %v, got %v", *movie, readMovie)
+	}
+
+	restored, err := client.Restore(context.TODO(), deletedMusic.ID, schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if *deletedMusic != restored {
+		tt.Fatalf("want %v, got %v", *deletedMusic, restored)
+	}
+
+	// A document written by a newer release cannot be migrated.
+	_, err = client.backend.Put(context.TODO(), movie.Key(), []byte(`{"schema":1000,"id":"123"}`), "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = client.Migrate(context.TODO(), false)
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
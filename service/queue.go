@@ -0,0 +1,343 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// QueuedOp is the kind of change recorded by a QueuedOperation.
+type QueuedOp string
+
+const (
+	// QueuedCreate is a queued Create.
+	QueuedCreate QueuedOp = "create"
+
+	// QueuedUpdate is a queued Update.
+	QueuedUpdate QueuedOp = "update"
+
+	// QueuedDelete is a queued Delete.
+	QueuedDelete QueuedOp = "delete"
+)
+
+// QueuedOperation is a change to a single entry that was made while the
+// database could not be reached. Entry is the stored data of the entry for
+// a create or an update. Version is the version of the entry the change is
+// based on, if one was given. Keep names the fields of an update that keep
+// their stored values, as for UpdateKeeping. Queued is a Unix timestamp.
+type QueuedOperation struct {
+	Op      QueuedOp        `json:"op"`
+	Key     string          `json:"key"`
+	Entry   json.RawMessage `json:"entry,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Keep    []string        `json:"keep,omitempty"`
+	Queued  int64           `json:"queued"`
+}
+
+// NewQueuedOperation returns a QueuedOperation for the entry stored under
+// key. The media is the new value of the entry for a create or an update,
+// and is ignored for a delete. It returns a non-nil error if op is not a
+// valid operation or the media cannot be encoded.
+func NewQueuedOperation(op QueuedOp, key string, media schema.Media, version string) (QueuedOperation, error) {
+	queuedOp := QueuedOperation{
+		Op:      op,
+		Key:     key,
+		Version: version,
+		Queued:  time.Now().Unix(),
+	}
+
+	switch op {
+	case QueuedCreate, QueuedUpdate:
+		jsonData, err := schema.MarshalMedia(media)
+		if err != nil {
+			return queuedOp, err
+		}
+		queuedOp.Entry = jsonData
+	case QueuedDelete:
+	default:
+		return queuedOp, fmt.Errorf("%q is not a valid queued operation", op)
+	}
+
+	_, err := schema.GetMediaTypeFromKey(key)
+	return queuedOp, err
+}
+
+// Queue is a journal of the changes made while the database could not be
+// reached, kept in a local file with one JSON operation per line. The
+// changes are made to the database, in the order they were queued, by Push.
+type Queue struct {
+	file string
+}
+
+// NewQueue returns a pointer to a Queue kept in the given file.
+// The file is created when the first operation is appended.
+func NewQueue(file string) *Queue {
+	return &Queue{
+		file: file,
+	}
+}
+
+// Append adds op to the end of the queue. It returns
+// a non-nil error if the queue file cannot be written.
+func (q *Queue) Append(op QueuedOperation) error {
+	jsonData, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(q.file), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(q.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(jsonData, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Read returns the operations in the queue, from the first queued. An
+// empty queue has no file. It returns a non-nil error if the queue file
+// cannot be read or any operation in it cannot be parsed.
+func (q *Queue) Read() ([]QueuedOperation, error) {
+	ops := make([]QueuedOperation, 0)
+
+	file, err := os.Open(q.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return ops, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		op := QueuedOperation{}
+		err = json.Unmarshal(scanner.Bytes(), &op)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", q.file, line, err)
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, scanner.Err()
+}
+
+// write replaces the operations in the queue with ops. The queue file is
+// replaced in a single step, so that an interrupted write never loses
+// queued changes, and is removed once the queue is empty.
+func (q *Queue) write(ops []QueuedOperation) error {
+	if len(ops) == 0 {
+		err := os.Remove(q.file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	queueFileNew, err := os.CreateTemp(filepath.Dir(q.file), filepath.Base(q.file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(queueFileNew.Name())
+
+	writer := bufio.NewWriter(queueFileNew)
+	for _, op := range ops {
+		jsonData, err := json.Marshal(op)
+		if err != nil {
+			queueFileNew.Close()
+			return err
+		}
+		writer.Write(append(jsonData, '\n'))
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		queueFileNew.Close()
+		return err
+	}
+
+	err = queueFileNew.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(queueFileNew.Name(), q.file)
+}
+
+// PushOptions controls how Push handles a queued change to an entry that
+// has also been changed in the database since the change was queued. If
+// Force is true, the queued change replaces the one in the database. If
+// SkipConflicts is true, the queued change is dropped instead. Otherwise,
+// Push stops at the first conflict.
+type PushOptions struct {
+	Force         bool
+	SkipConflicts bool
+}
+
+// PushResult counts the queued operations made by Push. Conflicts holds a
+// *ConflictError for each operation dropped because of SkipConflicts.
+type PushResult struct {
+	Pushed    int
+	Remaining int
+	Conflicts []error
+}
+
+// queuedVersion returns the version of the entry that the queued update or
+// delete is based on. If the operation was queued without a version, it is
+// based on the current version of the entry, as long as the entry has not
+// changed since the operation was queued. A *ConflictError is returned if
+// it has changed or it no longer exists. If an earlier queued operation
+// for the entry was made by the same push, isPushed is true and the
+// operation is based on the current version, which that one made.
+func (cl *MediaDbClient) queuedVersion(ctx context.Context, op QueuedOperation, isPushed bool) (string, error) {
+	if op.Version != "" && !isPushed {
+		return op.Version, nil
+	}
+
+	version, err := cl.backend.Head(ctx, op.Key)
+	if errors.Is(err, ErrNotFound) {
+		return "", &ConflictError{ID: schema.GetIDFromKey(op.Key)}
+	} else if err != nil {
+		return "", err
+	}
+
+	lastModified, err := cl.backend.LastModified(ctx, op.Key)
+	if err != nil {
+		return "", err
+	}
+
+	if !isPushed && lastModified.After(time.Unix(op.Queued, 0)) {
+		return "", cl.newConflictError(ctx, op.Key, "")
+	}
+
+	return version, nil
+}
+
+// replay makes the queued operation in the database. If force is true, the
+// operation is made whatever the current version of the entry. The isPushed
+// parameter is passed on to queuedVersion.
+func (cl *MediaDbClient) replay(ctx context.Context, op QueuedOperation, force, isPushed bool) error {
+	var media schema.Media
+	var err error
+
+	if op.Op != QueuedDelete {
+		media, err = decodeMedia(op.Key, op.Entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	id := schema.GetIDFromKey(op.Key)
+	version := ""
+
+	switch op.Op {
+	case QueuedCreate:
+		return cl.Create(ctx, media)
+	case QueuedUpdate:
+		if !force {
+			version, err = cl.queuedVersion(ctx, op, isPushed)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = cl.UpdateKeeping(ctx, id, media, version, op.Keep)
+		if force && errors.Is(err, ErrNotFound) {
+			// The entry was deleted, and the queued update brings it back.
+			return cl.Create(ctx, media)
+		}
+	case QueuedDelete:
+		var mediaType schema.Media
+		mediaType, err = schema.GetMediaTypeFromKey(op.Key)
+		if err != nil {
+			return err
+		}
+
+		if !force {
+			version, err = cl.queuedVersion(ctx, op, isPushed)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = cl.Delete(ctx, id, mediaType, version)
+		if force && errors.Is(err, ErrNotFound) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("%q is not a valid queued operation", op.Op)
+	}
+
+	if errors.Is(err, ErrNotFound) {
+		return &ConflictError{ID: id, ExpectedVersion: version}
+	}
+
+	return err
+}
+
+// Push makes the changes in the queue to the database, in the order they
+// were queued, and removes each one from the queue once it is made. A
+// queued update or delete conflicts with a change made to the entry in
+// the database after it was queued, or after the version it is based on,
+// and this is handled as given by opts. It returns the operations made and
+// a non-nil error, wrapping a *ConflictError for a conflict, if the queue
+// cannot be read or written or an operation cannot be made. The operation
+// that failed and any after it are left in the queue.
+func (cl *MediaDbClient) Push(ctx context.Context, queue *Queue, opts PushOptions) (PushResult, error) {
+	result := PushResult{
+		Conflicts: make([]error, 0),
+	}
+
+	ops, err := queue.Read()
+	if err != nil {
+		return result, err
+	}
+
+	pushedKeys := make(map[string]bool)
+	for len(ops) > 0 {
+		err = cl.replay(ctx, ops[0], opts.Force, pushedKeys[ops[0].Key])
+		if err != nil {
+			err = fmt.Errorf("queued %s of %s: %w", ops[0].Op, ops[0].Key, err)
+		}
+
+		if errors.Is(err, ErrConflict) && opts.SkipConflicts {
+			result.Conflicts = append(result.Conflicts, err)
+		} else if err != nil {
+			result.Remaining = len(ops)
+			return result, err
+		} else {
+			result.Pushed++
+			pushedKeys[ops[0].Key] = true
+		}
+
+		ops = ops[1:]
+		err = queue.write(ops)
+		if err != nil {
+			result.Remaining = len(ops)
+			return result, err
+		}
+	}
+
+	return result, nil
+}
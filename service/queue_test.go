@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestQueue(tt *testing.T) {
+	queue := NewQueue(filepath.Join(tt.TempDir(), "mediadb", "queue"))
+
+	ops, err := queue.Read()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(ops) != 0 {
+		tt.Fatalf("want an empty queue, got %v", ops)
+	}
+
+	movie, err := schema.NewMovie("A Queued Title", "A Director", 1999, "2021-08-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	createOp, err := NewQueuedOperation(QueuedCreate, movie.Key(), movie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	deleteOp, err := NewQueuedOperation(QueuedDelete, movie.Key(), nil, "123")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = NewQueuedOperation(QueuedOp("rename"), movie.Key(), movie, "")
+	if err == nil {
+		tt.Fatal("want error for an invalid operation, got nil")
+	}
+
+	_, err = NewQueuedOperation(QueuedDelete, "media/invalid/123", nil, "")
+	if err == nil {
+		tt.Fatal("want error for an invalid key, got nil")
+	}
+
+	for _, op := range []QueuedOperation{createOp, deleteOp} {
+		err = queue.Append(op)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	ops, err = queue.Read()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []QueuedOperation{createOp, deleteOp}; !reflect.DeepEqual(want, ops) {
+		tt.Fatalf("want %v, got %v", want, ops)
+	}
+
+	err = queue.write(ops[1:])
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	ops, err = queue.Read()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []QueuedOperation{deleteOp}; !reflect.DeepEqual(want, ops) {
+		tt.Fatalf("want %v, got %v", want, ops)
+	}
+
+	// The queue file is removed once it is empty.
+	err = queue.write(nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = os.Stat(queue.file)
+	if !errors.Is(err, os.ErrNotExist) {
+		tt.Fatalf("want %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestPush(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("queues changes to entries that are made in the test")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	newMovie := func(title string) *schema.Movie {
+		movie, err := schema.NewMovie(title, "A Director", 2000, "2021-08-01")
+		if err != nil {
+			tt.Fatal(err)
+		}
+		return movie
+	}
+
+	updatedMovie := newMovie("A Title To Update")
+	deletedMovie := newMovie("A Title To Delete")
+	conflictMovie := newMovie("A Title Changed Remotely")
+
+	for _, media := range []schema.Media{updatedMovie, deletedMovie, conflictMovie} {
+		err = client.Create(context.TODO(), media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	queue := NewQueue(filepath.Join(tt.TempDir(), "queue"))
+	appendOp := func(op QueuedOp, media schema.Media, key string, queued time.Time) {
+		queuedOp, err := NewQueuedOperation(op, key, media, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+		queuedOp.Queued = queued.Unix()
+
+		err = queue.Append(queuedOp)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	// A queued change is in conflict with a change made in the
+	// database after it, such as creating the entry above.
+	now := time.Now().Add(time.Second)
+	earlier := now.Add(-time.Hour)
+
+	createdMovie := newMovie("A Queued Title")
+	appendOp(QueuedCreate, createdMovie, createdMovie.Key(), now)
+
+	updatedCreatedMovie := *createdMovie
+	updatedCreatedMovie.Title = "An Updated Queued Title"
+	appendOp(QueuedUpdate, updatedCreatedMovie, createdMovie.Key(), now)
+
+	newUpdatedMovie := *updatedMovie
+	newUpdatedMovie.Title = "An Updated Title"
+	appendOp(QueuedUpdate, newUpdatedMovie, updatedMovie.Key(), now)
+	appendOp(QueuedDelete, nil, deletedMovie.Key(), now)
+
+	newConflictMovie := *conflictMovie
+	newConflictMovie.Title = "A Title Changed Locally"
+	appendOp(QueuedUpdate, newConflictMovie, conflictMovie.Key(), earlier)
+	appendOp(QueuedDelete, nil, conflictMovie.Key(), now)
+
+	result, err := client.Push(context.TODO(), queue, PushOptions{})
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		tt.Fatalf("want %v, got %v", ErrConflict, err)
+	}
+	if !reflect.DeepEqual(*conflictMovie, conflictErr.Current) {
+		tt.Fatalf("want the current entry %v, got %v", *conflictMovie, conflictErr.Current)
+	}
+	if result.Pushed != 4 || result.Remaining != 2 {
+		tt.Fatalf("want 4 pushed and 2 remaining, got %+v", result)
+	}
+
+	ops, err := queue.Read()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].Key != conflictMovie.Key() {
+		tt.Fatalf("want the conflict and the operation after it to stay queued, got %v", ops)
+	}
+
+	res, err := client.Read(context.TODO(), "", schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []schema.Media{*conflictMovie, updatedCreatedMovie, newUpdatedMovie}; len(res) != len(want) {
+		tt.Fatalf("want %v, got %v", want, res)
+	}
+	for _, want := range []schema.Media{*conflictMovie, updatedCreatedMovie, newUpdatedMovie} {
+		found := false
+		for _, media := range res {
+			found = found || reflect.DeepEqual(want, media)
+		}
+		if !found {
+			tt.Fatalf("want %v in %v", want, res)
+		}
+	}
+
+	// Skipping the conflict drops it, and the delete after it is pushed.
+	result, err = client.Push(context.TODO(), queue, PushOptions{SkipConflicts: true})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if result.Pushed != 1 || len(result.Conflicts) != 1 || !errors.Is(result.Conflicts[0], ErrConflict) {
+		tt.Fatalf("want 1 pushed and 1 conflict, got %+v", result)
+	}
+
+	ops, err = queue.Read()
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(ops) != 0 {
+		tt.Fatalf("want an empty queue, got %v", ops)
+	}
+
+	// Forcing the conflict brings back the deleted entry.
+	appendOp(QueuedUpdate, newConflictMovie, conflictMovie.Key(), earlier)
+
+	result, err = client.Push(context.TODO(), queue, PushOptions{Force: true})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if result.Pushed != 1 {
+		tt.Fatalf("want 1 pushed, got %+v", result)
+	}
+
+	res, err = client.Read(context.TODO(), conflictMovie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []schema.Media{newConflictMovie}; !reflect.DeepEqual(want, res) {
+		tt.Fatalf("want %v, got %v", want, res)
+	}
+}
@@ -3,12 +3,11 @@ package service
 import (
 	"context"
 	"encoding/json"
-	"io"
-	"log"
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/alexpcook/media-db/schema"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 func getReadFilter(id string, mediaType schema.Media) string {
@@ -24,67 +23,205 @@ func getReadFilter(id string, mediaType schema.Media) string {
 	return baseKey
 }
 
-// Read retrieves the media entries from the database that match the
-// specified filters. If id is the empty string "" and mediaType is nil,
-// there is no filtering applied. If id is not the empty string, mediaType
-// should match the type of media corresponding to that id. If id is the empty
-// string and mediaType is not nil, all media of that type will be returned.
-// It returns a slice of media entries upon success and a non-nil error upon failure.
-func (cl *MediaDbClient) Read(id string, mediaType schema.Media) ([]schema.Media, error) {
-	filter := getReadFilter(id, mediaType)
+// decodeMedia unmarshals the JSON data stored under key into the
+// concrete media type that the key corresponds to. Data stored in an
+// older version of the document format is upgraded first.
+func decodeMedia(key string, jsonData []byte) (schema.Media, error) {
+	media, err := schema.GetMediaTypeFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err = schema.UpgradeDocument(media, jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	switch media.(type) {
+	case schema.Movie:
+		movie := schema.Movie{}
+		err = json.Unmarshal(jsonData, &movie)
+		if err != nil {
+			return nil, err
+		}
+		return movie, nil
+	case schema.Music:
+		music := schema.Music{}
+		err = json.Unmarshal(jsonData, &music)
+		if err != nil {
+			return nil, err
+		}
+		return music, nil
+	}
+
+	return nil, fmt.Errorf("key %s does not correspond to a valid media type", key)
+}
 
-	listObjsRes, err := cl.s3Client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{
-		Bucket: &cl.s3Bucket,
-		Prefix: &filter,
+// getMedia fetches and decodes the media entries stored under keys. Up to
+// cl.concurrency entries are fetched at once, and the returned entries are in
+// the same order as keys. The first error encountered cancels any remaining
+// fetches and is returned.
+func (cl *MediaDbClient) getMedia(ctx context.Context, keys []string) ([]schema.Media, error) {
+	media := make([]schema.Media, len(keys))
+
+	err := cl.runConcurrently(ctx, len(keys), func(ctx context.Context, i int) error {
+		jsonData, _, err := cl.backend.Get(ctx, keys[i])
+		if err != nil {
+			return err
+		}
+
+		media[i], err = decodeMedia(keys[i], jsonData)
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	return media, nil
+}
+
+// ReadEntry retrieves the single media entry with the given id and type from
+// the database, along with its current version. The version can be passed to
+// Update or Delete to detect changes made to the entry after it was read. It
+// returns a non-nil error if the entry cannot be read, wrapping ErrNotFound
+// if there is no such entry.
+func (cl *MediaDbClient) ReadEntry(ctx context.Context, id string, mediaType schema.Media) (schema.Media, string, error) {
+	key := strings.Join([]string{schema.GetBaseKeyFromMediaType(mediaType), id}, "/")
+
+	jsonData, version, err := cl.backend.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, "", entryNotFoundError(id, mediaType)
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	media, err := decodeMedia(key, jsonData)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return media, version, nil
+}
+
+// ReadPage is a single page of media entries returned by ReadPage.
+type ReadPage struct {
+	// Media contains the entries on this page.
+	Media []schema.Media
+
+	// NextToken resumes reading after the last entry on this page.
+	// It is the empty string "" when there are no more entries.
+	NextToken string
+}
+
+// ReadPage retrieves a single page of the media entries from the database
+// that match the specified filters, which behave the same way as for Read.
+// At most pageSize entries are returned, and a pageSize that is not positive
+// or is greater than the backend maximum is treated as the backend maximum.
+// The empty token "" starts from the first entry, and the NextToken of the
+// returned page resumes from where that page ended. It returns a non-nil
+// error upon failure.
+func (cl *MediaDbClient) ReadPage(ctx context.Context, id string, mediaType schema.Media, pageSize int, token string) (*ReadPage, error) {
+	if pageSize <= 0 || pageSize > getMaxPageSize() {
+		pageSize = getMaxPageSize()
+	}
+
+	filter := getReadFilter(id, mediaType)
+
+	keys, nextToken, err := cl.backend.List(ctx, filter, token, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		// Skip objects in the bucket that are not media entries, such as indexes.
+		if _, err := schema.GetMediaTypeFromKey(key); err != nil {
+			continue
+		}
+		mediaKeys = append(mediaKeys, key)
+	}
+
+	media, err := cl.getMedia(ctx, mediaKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ReadPage{
+		Media:     media,
+		NextToken: nextToken,
+	}
+
+	return page, nil
+}
+
+// readPages reads every page of the media entries that match the
+// specified filters, fetching each entry object individually.
+func (cl *MediaDbClient) readPages(ctx context.Context, id string, mediaType schema.Media) ([]schema.Media, error) {
 	mediaRes := make([]schema.Media, 0)
+	token := ""
 
-	for _, obj := range listObjsRes.Contents {
-		getObjsRes, err := cl.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
-			Bucket: &cl.s3Bucket,
-			Key:    obj.Key,
-		})
+	for {
+		page, err := cl.ReadPage(ctx, id, mediaType, getMaxPageSize(), token)
 		if err != nil {
 			return nil, err
 		}
+		mediaRes = append(mediaRes, page.Media...)
 
-		b := make([]byte, 8)
-		jsonData := make([]byte, 0)
-		for {
-			n, err := getObjsRes.Body.Read(b)
-			jsonData = append(jsonData, b[:n]...)
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return nil, err
-			}
+		if page.NextToken == "" {
+			return mediaRes, nil
 		}
+		token = page.NextToken
+	}
+}
 
-		media, err := schema.GetMediaTypeFromKey(*obj.Key)
-		if err != nil {
-			log.Println(err)
-		}
+// Read retrieves the media entries from the database that match the
+// specified filters. If id is the empty string "" and mediaType is nil,
+// there is no filtering applied. If id is not the empty string, mediaType
+// should match the type of media corresponding to that id. If id is the empty
+// string and mediaType is not nil, all media of that type will be returned.
+// Entries are read from the index of each media type, which takes a single
+// request per type. A type that has not been indexed yet is read entry by
+// entry instead. Use ReadPage to read the database incrementally. It returns
+// a slice of media entries upon success and a non-nil error upon failure.
+func (cl *MediaDbClient) Read(ctx context.Context, id string, mediaType schema.Media) ([]schema.Media, error) {
+	return cl.ReadMatching(ctx, id, mediaType, Filter{})
+}
 
-		switch media.(type) {
-		case schema.Movie:
-			movie := schema.Movie{}
-			err = json.Unmarshal(jsonData, &movie)
-			if err != nil {
-				return nil, err
-			}
-			mediaRes = append(mediaRes, movie)
-		case schema.Music:
-			music := schema.Music{}
-			err = json.Unmarshal(jsonData, &music)
+// ReadMatching retrieves the media entries from the database that match
+// the specified filters in the same way as Read, and that also match every
+// field of filter that is set. It returns a non-nil error if filter is not
+// valid or upon failure.
+func (cl *MediaDbClient) ReadMatching(ctx context.Context, id string, mediaType schema.Media, filter Filter) ([]schema.Media, error) {
+	matcher, err := filter.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	mediaTypes := schema.GetAllMediaTypes()
+	if mediaType != nil {
+		mediaTypes = []schema.Media{mediaType}
+	}
+
+	mediaRes := make([]schema.Media, 0)
+
+	for _, mediaType := range mediaTypes {
+		idx, _, err := cl.loadIndex(ctx, mediaType)
+		if errors.Is(err, ErrNotFound) {
+			media, err := cl.readPages(ctx, id, mediaType)
 			if err != nil {
 				return nil, err
 			}
-			mediaRes = append(mediaRes, music)
+			mediaRes = append(mediaRes, filterMedia(media, matcher)...)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		media, err := idx.media(mediaType, id)
+		if err != nil {
+			return nil, err
 		}
+		mediaRes = append(mediaRes, filterMedia(media, matcher)...)
 	}
 
 	return mediaRes, nil
@@ -1,19 +1,18 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/alexpcook/media-db/config"
 	"github.com/alexpcook/media-db/schema"
 )
 
 func TestRead(tt *testing.T) {
-	cfg, err := config.LoadMediaDbConfig()
-	if err != nil {
-		tt.Fatal(err)
-	}
-
-	client, err := NewMediaDbClient(cfg)
+	client, err := newTestMediaDbClient()
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -23,27 +22,27 @@ func TestRead(tt *testing.T) {
 		tt.Fatal(err)
 	}
 
-	err = client.Create(movie)
+	err = client.Create(context.TODO(), movie)
 	if err != nil {
 		tt.Fatal(err)
 	}
 	defer func() {
-		err = client.Delete(movie.ID, *movie)
+		err = client.Delete(context.TODO(), movie.ID, *movie, "")
 		if err != nil {
 			tt.Fatal(err)
 		}
 	}()
 
 	// Simulate a failed list bucket call.
-	originalBucket := client.s3Bucket
-	client.s3Bucket = "this-is-an-invalid-bucket-name"
-	_, err = client.Read("", nil)
+	originalBucket := client.backend.(*s3Backend).bucket
+	client.backend.(*s3Backend).bucket = "this-is-an-invalid-bucket-name"
+	_, err = client.Read(context.TODO(), "", nil)
 	if err == nil {
 		tt.Fatal("want error, got nil")
 	}
-	client.s3Bucket = originalBucket
+	client.backend.(*s3Backend).bucket = originalBucket
 
-	res, err := client.Read("", nil)
+	res, err := client.Read(context.TODO(), "", nil)
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -53,7 +52,7 @@ func TestRead(tt *testing.T) {
 	}
 
 	// Test filtering everything in the bucket (since there's only one movie).
-	res, err = client.Read("", schema.Music{})
+	res, err = client.Read(context.TODO(), "", schema.Music{})
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -67,19 +66,19 @@ func TestRead(tt *testing.T) {
 		tt.Fatal(err)
 	}
 
-	err = client.Create(music)
+	err = client.Create(context.TODO(), music)
 	if err != nil {
 		tt.Fatal(err)
 	}
 	defer func() {
-		err = client.Delete(music.ID, *music)
+		err = client.Delete(context.TODO(), music.ID, *music, "")
 		if err != nil {
 			tt.Fatal(err)
 		}
 	}()
 
 	// There should now be one piece of music in the bucket.
-	res, err = client.Read("", schema.Music{})
+	res, err = client.Read(context.TODO(), "", schema.Music{})
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -89,7 +88,7 @@ func TestRead(tt *testing.T) {
 	}
 
 	// Filter on the exact ID of the piece of music.
-	res, err = client.Read(music.ID, schema.Music{})
+	res, err = client.Read(context.TODO(), music.ID, schema.Music{})
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -98,3 +97,207 @@ func TestRead(tt *testing.T) {
 		tt.Fatalf("expected one entry in response, got %d", len(res))
 	}
 }
+
+func TestReadPage(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	numMovies := 5
+	for i := 0; i < numMovies; i++ {
+		movie, err := schema.NewMovie("A Paged Title", "A Paged Director", 2000+i, "2021-01-01")
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		err = client.Create(context.TODO(), movie)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		defer func() {
+			err = client.Delete(context.TODO(), movie.ID, *movie, "")
+			if err != nil {
+				tt.Fatal(err)
+			}
+		}()
+	}
+
+	seen := make(map[string]bool)
+	numPages := 0
+	token := ""
+
+	for {
+		page, err := client.ReadPage(context.TODO(), "", schema.Movie{}, 2, token)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		numPages++
+
+		if len(page.Media) > 2 {
+			tt.Fatalf("want at most 2 entries in page, got %d", len(page.Media))
+		}
+
+		for _, media := range page.Media {
+			key := media.Key()
+			if seen[key] {
+				tt.Fatalf("entry %s returned more than once", key)
+			}
+			seen[key] = true
+		}
+
+		if page.NextToken == "" {
+			break
+		}
+		token = page.NextToken
+	}
+
+	if len(seen) != numMovies {
+		tt.Fatalf("want %d entries, got %d", numMovies, len(seen))
+	}
+
+	if numPages != 3 {
+		tt.Fatalf("want 3 pages, got %d", numPages)
+	}
+}
+
+func TestReadMultiplePages(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("creates more entries than is reasonable for a live database")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Create more entries than fit in a single backend list call.
+	numMusic := getMaxPageSize() + 5
+	for i := 0; i < numMusic; i++ {
+		music, err := schema.NewMusic("A Song", "An Artist", 1990, "2021-01-01")
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		err = client.Create(context.TODO(), music)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	// Remove the index so that Read has to list the entries page by page.
+	err = client.backend.Delete(context.TODO(), schema.GetIndexKeyFromMediaType(schema.Music{}), "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	res, err := client.Read(context.TODO(), "", nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if len(res) != numMusic {
+		tt.Fatalf("want %d entries, got %d", numMusic, len(res))
+	}
+}
+
+// trackingBackend wraps a Backend to record the largest number of Get
+// calls in flight at once and to fail Get calls for a particular key.
+type trackingBackend struct {
+	Backend
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	failKey     string
+}
+
+func (b *trackingBackend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	b.mu.Lock()
+	b.inFlight++
+	if b.inFlight > b.maxInFlight {
+		b.maxInFlight = b.inFlight
+	}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.inFlight--
+		b.mu.Unlock()
+	}()
+
+	// Hold the call open long enough for other workers to overlap with it.
+	time.Sleep(5 * time.Millisecond)
+
+	if key == b.failKey {
+		return nil, "", errors.New("simulated get failure")
+	}
+
+	return b.Backend.Get(ctx, key)
+}
+
+func TestReadConcurrent(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	numMovies := 20
+	wantKeys := make([]string, 0, numMovies)
+	for i := 0; i < numMovies; i++ {
+		movie, err := schema.NewMovie("A Concurrent Title", "A Concurrent Director", 2000, "2021-01-01")
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		err = client.Create(context.TODO(), movie)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		defer func() {
+			err = client.Delete(context.TODO(), movie.ID, *movie, "")
+			if err != nil {
+				tt.Fatal(err)
+			}
+		}()
+
+		wantKeys = append(wantKeys, movie.Key())
+	}
+	sort.Strings(wantKeys)
+
+	tracker := &trackingBackend{Backend: client.backend}
+	trackedClient := NewMediaDbClientFromBackend(tracker)
+	trackedClient.SetConcurrency(4)
+
+	// Read a page so that each entry is fetched individually rather than from the index.
+	page, err := trackedClient.ReadPage(context.TODO(), "", schema.Movie{}, 0, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	res := page.Media
+	if len(res) != numMovies {
+		tt.Fatalf("want %d entries, got %d", numMovies, len(res))
+	}
+
+	// Entries are returned in key order regardless of which fetch finished first.
+	for i, media := range res {
+		if gotKey := media.Key(); wantKeys[i] != gotKey {
+			tt.Fatalf("entry %d: want key %s, got %s", i, wantKeys[i], gotKey)
+		}
+	}
+
+	if tracker.maxInFlight > 4 {
+		tt.Fatalf("want at most 4 fetches at once, got %d", tracker.maxInFlight)
+	}
+
+	if tracker.maxInFlight < 2 {
+		tt.Fatalf("want fetches to run concurrently, got %d at once", tracker.maxInFlight)
+	}
+
+	// A failure fetching any entry fails the whole read.
+	tracker.failKey = wantKeys[numMovies/2]
+	_, err = trackedClient.ReadPage(context.TODO(), "", schema.Movie{}, 0, "")
+	if err == nil {
+		tt.Fatal("want error, got nil")
+	}
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	cfg "github.com/alexpcook/media-db/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// s3API is the subset of the AWS S3 client API used by s3Backend. It is
+// satisfied by *s3.Client and by in-process stand-ins for testing.
+type s3API interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+}
+
+// s3Backend is a Backend that stores objects in an AWS S3 bucket. Each
+// call to the backend, including any retries, is limited to timeout.
+type s3Backend struct {
+	client  s3API
+	bucket  string
+	timeout time.Duration
+}
+
+// getDefaultTimeout returns the longest that a single call to the S3
+// backend may take unless configured.
+func getDefaultTimeout() time.Duration {
+	return 30 * time.Second
+}
+
+// newS3Backend creates an s3Backend from the AWS settings in the given
+// MediaDbConfig. Any problem loading the AWS credentials, configuration,
+// or accessing the S3 bucket will return a non-nil error.
+func newS3Backend(mediaDbConfig *cfg.MediaDbConfig) (*s3Backend, error) {
+	timeout, err := mediaDbConfig.GetTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithSharedConfigProfile(mediaDbConfig.AWSProfile),
+		config.WithRegion(mediaDbConfig.AWSRegion))
+	if err != nil {
+		return nil, err
+	}
+
+	return newS3BackendFromAPI(s3.NewFromConfig(awsConfig), mediaDbConfig.S3Bucket, timeout)
+}
+
+// newS3BackendFromAPI creates an s3Backend that uses the given S3 API client,
+// where a timeout of zero means the default. It returns a non-nil error if
+// the S3 bucket cannot be accessed, which matches ErrUnreachable unless the
+// bucket does not exist.
+func newS3BackendFromAPI(client s3API, bucket string, timeout time.Duration) (*s3Backend, error) {
+	if timeout == 0 {
+		timeout = getDefaultTimeout()
+	}
+
+	backend := s3Backend{
+		client:  client,
+		bucket:  bucket,
+		timeout: timeout,
+	}
+
+	// Validate access to the S3 bucket.
+	ctx, cancel := backend.withTimeout(context.Background())
+	defer cancel()
+
+	_, err := backend.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: &backend.bucket,
+	})
+
+	// Any other error, such as a network error or missing or rejected
+	// credentials, means that the bucket cannot be reached right now.
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchBucket") {
+		return nil, fmt.Errorf("the S3 bucket %s does not exist: %w", bucket, err)
+	} else if err != nil {
+		return nil, unreachableError{err}
+	}
+
+	return &backend, nil
+}
+
+// withTimeout returns a copy of ctx that is cancelled once the timeout of
+// the backend has passed, along with the function that releases it.
+func (b *s3Backend) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, b.timeout)
+}
+
+// wrapS3Error converts the S3 errors for a missing key or version into ErrNotFound and
+// the S3 errors for a failed conditional request into ErrPreconditionFailed.
+// HeadObject responses have no body, so S3 reports a missing key with the
+// generic NotFound error code rather than a NoSuchKey error.
+func wrapS3Error(key string, err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchVersion", "NotFound":
+			return fmt.Errorf("%w: %s", ErrNotFound, key)
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			return fmt.Errorf("%w: %s", ErrPreconditionFailed, key)
+		}
+	}
+
+	return err
+}
+
+// withIfMatch adds an If-Match header to an S3 request so that S3 only
+// carries out the request if the object has the given ETag. For the ETag
+// getNoObjectETag(), it adds an If-None-Match: * header instead, so that S3
+// only carries out the request if there is no object.
+func withIfMatch(eTag string) func(*s3.Options) {
+	header, value := "If-Match", `"`+eTag+`"`
+	if eTag == getNoObjectETag() {
+		header, value = "If-None-Match", eTag
+	}
+
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue(header, value))
+	}
+}
+
+// Put uploads data to the S3 bucket under key. For a conditional put, the
+// ETag is checked before uploading and the upload is sent with an If-Match
+// or If-None-Match header. The header makes the check atomic on S3, while
+// the separate check covers S3-compatible stores that ignore the header.
+func (b *s3Backend) Put(ctx context.Context, key string, data []byte, ifMatch string) (string, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	optFns := make([]func(*s3.Options), 0, 1)
+	if ifMatch != "" {
+		err := checkETag(ctx, b, key, ifMatch)
+		if err != nil {
+			return "", err
+		}
+		optFns = append(optFns, withIfMatch(ifMatch))
+	}
+
+	res, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+		Body:   bytes.NewReader(data),
+	}, optFns...)
+	if err != nil {
+		return "", wrapS3Error(key, err)
+	}
+
+	return unquoteETag(aws.ToString(res.ETag)), nil
+}
+
+// Get downloads the object stored in the S3 bucket under key.
+func (b *s3Backend) Get(ctx context.Context, key string) ([]byte, string, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	res, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, "", wrapS3Error(key, err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, unquoteETag(aws.ToString(res.ETag)), nil
+}
+
+// List returns a page of keys in the S3 bucket that begin with prefix.
+// The token is an S3 continuation token.
+func (b *s3Backend) List(ctx context.Context, prefix, token string, maxKeys int) ([]string, string, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  &b.bucket,
+		Prefix:  &prefix,
+		MaxKeys: int32(maxKeys),
+	}
+	if token != "" {
+		input.ContinuationToken = &token
+	}
+
+	res, err := b.client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys := make([]string, 0, len(res.Contents))
+	for _, obj := range res.Contents {
+		keys = append(keys, *obj.Key)
+	}
+
+	nextToken := ""
+	if res.IsTruncated && res.NextContinuationToken != nil {
+		nextToken = *res.NextContinuationToken
+	}
+
+	return keys, nextToken, nil
+}
+
+// Head returns the ETag of the object stored in the S3 bucket under key.
+func (b *s3Backend) Head(ctx context.Context, key string) (string, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	res, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return "", wrapS3Error(key, err)
+	}
+
+	return unquoteETag(aws.ToString(res.ETag)), nil
+}
+
+// LastModified returns the time that the object stored in the S3
+// bucket under key was last written.
+func (b *s3Backend) LastModified(ctx context.Context, key string) (time.Time, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	res, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return time.Time{}, wrapS3Error(key, err)
+	}
+
+	return aws.ToTime(res.LastModified), nil
+}
+
+// Delete removes the object stored in the S3 bucket under key. A conditional
+// delete is checked in the same way as a conditional put.
+func (b *s3Backend) Delete(ctx context.Context, key string, ifMatch string) error {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	optFns := make([]func(*s3.Options), 0, 1)
+	if ifMatch != "" {
+		err := checkETag(ctx, b, key, ifMatch)
+		if err != nil {
+			return err
+		}
+		optFns = append(optFns, withIfMatch(ifMatch))
+	}
+
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &b.bucket,
+		Key:    &key,
+	}, optFns...)
+	return wrapS3Error(key, err)
+}
+
+// ListVersions returns every version of the object stored in the S3 bucket
+// under key. If versioning has never been enabled on the bucket, S3 keeps
+// only the current version, which has the version id "null".
+func (b *s3Backend) ListVersions(ctx context.Context, key string) ([]ObjectVersion, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	versions := make([]ObjectVersion, 0)
+	input := &s3.ListObjectVersionsInput{
+		Bucket: &b.bucket,
+		Prefix: &key,
+	}
+
+	for {
+		res, err := b.client.ListObjectVersions(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		// The prefix also matches longer keys, which are skipped.
+		for _, version := range res.Versions {
+			if aws.ToString(version.Key) == key {
+				versions = append(versions, ObjectVersion{
+					ID:           aws.ToString(version.VersionId),
+					LastModified: aws.ToTime(version.LastModified),
+					IsLatest:     version.IsLatest,
+				})
+			}
+		}
+		for _, marker := range res.DeleteMarkers {
+			if aws.ToString(marker.Key) == key {
+				versions = append(versions, ObjectVersion{
+					ID:             aws.ToString(marker.VersionId),
+					LastModified:   aws.ToTime(marker.LastModified),
+					IsLatest:       marker.IsLatest,
+					IsDeleteMarker: true,
+				})
+			}
+		}
+
+		if !res.IsTruncated {
+			break
+		}
+		input.KeyMarker = res.NextKeyMarker
+		input.VersionIdMarker = res.NextVersionIdMarker
+	}
+
+	// S3 lists versions and delete markers separately.
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+
+	return versions, nil
+}
+
+// GetVersion downloads the given version of the object stored
+// in the S3 bucket under key.
+func (b *s3Backend) GetVersion(ctx context.Context, key, versionID string) ([]byte, error) {
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	res, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    &b.bucket,
+		Key:       &key,
+		VersionId: &versionID,
+	})
+	if err != nil {
+		return nil, wrapS3Error(key, err)
+	}
+	defer res.Body.Close()
+
+	return io.ReadAll(res.Body)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+func TestS3ConditionalWrite(tt *testing.T) {
+	bucket := "media-db-test-bucket"
+	key := "media/movie/123"
+
+	testCases := []struct {
+		name   string
+		exists bool
+		write  func(backend *s3Backend, eTag string) error
+	}{
+		{"put", true, func(backend *s3Backend, eTag string) error {
+			_, err := backend.Put(context.TODO(), key, []byte(`{"title": "mine"}`), eTag)
+			return err
+		}},
+		{"delete", true, func(backend *s3Backend, eTag string) error {
+			return backend.Delete(context.TODO(), key, eTag)
+		}},
+		{"create", false, func(backend *s3Backend, eTag string) error {
+			_, err := backend.Put(context.TODO(), key, []byte(`{"title": "mine"}`), getNoObjectETag())
+			return err
+		}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			client := newFakeS3Client(bucket)
+			backend, err := newS3BackendFromAPI(client, bucket, 0)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+
+			eTag := ""
+			if test.exists {
+				eTag, err = backend.Put(context.TODO(), key, []byte(`{"title": "old"}`), "")
+				if err != nil {
+					subtt.Fatal(err)
+				}
+			}
+
+			// Another writer changes the object after the backend has
+			// checked its ETag, but before the write reaches S3.
+			client.beforeWrite = func(string) {
+				client.beforeWrite = nil
+				_, err := client.PutObject(context.TODO(), &s3.PutObjectInput{
+					Bucket: &bucket,
+					Key:    &key,
+					Body:   strings.NewReader(`{"title": "theirs"}`),
+				})
+				if err != nil {
+					subtt.Fatal(err)
+				}
+			}
+
+			err = test.write(backend, eTag)
+			if !errors.Is(err, ErrPreconditionFailed) {
+				subtt.Fatalf("want %v, got %v", ErrPreconditionFailed, err)
+			}
+
+			data, _, err := backend.Get(context.TODO(), key)
+			if err != nil {
+				subtt.Fatal(err)
+			}
+			if want := `{"title": "theirs"}`; string(data) != want {
+				subtt.Fatalf("want %s, got %s", want, data)
+			}
+		})
+	}
+}
+
+// unreachableS3Client is a fakeS3Client whose HeadBucket requests fail
+// with err, as if the bucket could not be reached.
+type unreachableS3Client struct {
+	*fakeS3Client
+	err error
+}
+
+func (c unreachableS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return nil, c.err
+}
+
+func TestNewS3BackendUnreachable(tt *testing.T) {
+	bucket := "media-db-test-bucket"
+
+	testCases := []struct {
+		name          string
+		client        s3API
+		isUnreachable bool
+	}{
+		{"network", unreachableS3Client{newFakeS3Client(bucket), errors.New("dial tcp: lookup s3.amazonaws.com: no such host")}, true},
+		{"forbidden", unreachableS3Client{newFakeS3Client(bucket), &smithy.GenericAPIError{Code: "Forbidden", Message: "Forbidden"}}, true},
+		{"no-such-bucket", newFakeS3Client("another-bucket"), false},
+		{"not-found", unreachableS3Client{newFakeS3Client(bucket), &smithy.GenericAPIError{Code: "NotFound", Message: "Not Found"}}, false},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			_, err := newS3BackendFromAPI(test.client, bucket, 0)
+			if err == nil {
+				subtt.Fatal("want error, got nil")
+			}
+			if isUnreachable := errors.Is(err, ErrUnreachable); isUnreachable != test.isUnreachable {
+				subtt.Fatalf("want unreachable %t, got %t (%v)", test.isUnreachable, isUnreachable, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// GetDefaultTopCount returns the number of directors and
+// artists that are ranked in Stats when none is given.
+func GetDefaultTopCount() int {
+	return 10
+}
+
+// Count is the number of entries that share a value, such as a year.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats summarizes a set of media entries. The counts per year, month,
+// and decade are in chronological order, and the top directors and
+// artists are in order of the most entries, then by name.
+type Stats struct {
+	// Total is the number of entries, and Types is the number of each type.
+	Total int     `json:"total"`
+	Types []Count `json:"types"`
+
+	// Years and Months are the number of entries watched
+	// or listened to in each year and month, such as 2021-05.
+	Years  []Count `json:"years"`
+	Months []Count `json:"months"`
+
+	// TopDirectors and TopArtists are the directors and
+	// artists with the most entries.
+	TopDirectors []Count `json:"top_directors"`
+	TopArtists   []Count `json:"top_artists"`
+
+	// Decades is the number of entries made in each decade, such as 1990s,
+	// and UnknownYear is the number of entries whose year is not known, such
+	// as music imported from a listening history.
+	Decades     []Count `json:"decades"`
+	UnknownYear int     `json:"unknown_year"`
+
+	// AverageYearsToWatch is the average number of years between the year
+	// an entry was made and the year it was watched or listened to, or zero
+	// if there are no entries. Entries whose year is not known are not
+	// counted.
+	AverageYearsToWatch float64 `json:"average_years_to_watch"`
+}
+
+// counter counts entries by name.
+type counter map[string]int
+
+// sortedByName returns the counts in order of name.
+func (c counter) sortedByName() []Count {
+	counts := make([]Count, 0, len(c))
+	for name, count := range c {
+		counts = append(counts, Count{Name: name, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Name < counts[j].Name
+	})
+
+	return counts
+}
+
+// top returns at most n counts in order of the highest count, then by name.
+func (c counter) top(n int) []Count {
+	counts := c.sortedByName()
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+
+	if n < len(counts) {
+		counts = counts[:n]
+	}
+
+	return counts
+}
+
+// ComputeStats summarizes media. At most top directors and artists are
+// ranked, or the default number if top is not positive.
+func ComputeStats(media []schema.Media, top int) Stats {
+	if top <= 0 {
+		top = GetDefaultTopCount()
+	}
+
+	types, years, months, directors, artists, decades := counter{}, counter{}, counter{}, counter{}, counter{}, counter{}
+	totalYearsToWatch, numUnknownYear := 0, 0
+
+	for _, m := range media {
+		var yearMade int
+		var date int64
+
+		switch m := m.(type) {
+		case schema.Movie:
+			yearMade, date = m.YearMade, m.DateWatched
+			directors[m.Director]++
+		case schema.Music:
+			yearMade, date = m.YearMade, m.DateListened
+			artists[m.Artist]++
+		default:
+			continue
+		}
+
+		watched := time.Unix(date, 0).UTC()
+		types[schema.GetMediaTypeName(m)]++
+		years[strconv.Itoa(watched.Year())]++
+		months[watched.Format("2006-01")]++
+
+		if yearMade == 0 {
+			numUnknownYear++
+			continue
+		}
+		decades[strconv.Itoa(yearMade-yearMade%10)+"s"]++
+		totalYearsToWatch += watched.Year() - yearMade
+	}
+
+	stats := Stats{
+		Types:        types.sortedByName(),
+		Years:        years.sortedByName(),
+		Months:       months.sortedByName(),
+		TopDirectors: directors.top(top),
+		TopArtists:   artists.top(top),
+		Decades:      decades.sortedByName(),
+		UnknownYear:  numUnknownYear,
+	}
+
+	for _, count := range types {
+		stats.Total += count
+	}
+	if numKnownYear := stats.Total - numUnknownYear; numKnownYear != 0 {
+		stats.AverageYearsToWatch = float64(totalYearsToWatch) / float64(numKnownYear)
+	}
+
+	return stats
+}
+
+// Stats summarizes the media entries in the database that match the
+// specified filters, in the same way as ReadMatching. At most top
+// directors and artists are ranked, or the default number if top is not
+// positive. It returns a non-nil error if the entries cannot be read.
+func (cl *MediaDbClient) Stats(ctx context.Context, mediaType schema.Media, filter Filter, top int) (Stats, error) {
+	media, err := cl.ReadMatching(ctx, "", mediaType, filter)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	return ComputeStats(media, top), nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestComputeStats(tt *testing.T) {
+	newMovie := func(director string, yearMade int, date string) schema.Movie {
+		movie, err := schema.NewMovie("A Title", director, yearMade, date)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		return *movie
+	}
+
+	newMusic := func(artist string, yearMade int, date string) schema.Music {
+		music, err := schema.NewMusic("A Song", artist, yearMade, date)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		return *music
+	}
+
+	media := []schema.Media{
+		newMovie("Christopher Nolan", 2008, "2021-05-14"),
+		newMovie("Michael Mann", 1995, "2021-05-01"),
+		newMovie("Christopher Nolan", 2020, "2020-12-25"),
+		newMusic("AC/DC", 1980, "2021-01-07"),
+	}
+
+	streamed, err := schema.NewMusicWithUnknownYear("A Streamed Song", "AC/DC", "2021-02-03")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		media []schema.Media
+		top   int
+		want  Stats
+	}{
+		{
+			"empty",
+			[]schema.Media{},
+			0,
+			Stats{Types: []Count{}, Years: []Count{}, Months: []Count{}, TopDirectors: []Count{}, TopArtists: []Count{}, Decades: []Count{}},
+		},
+		{
+			"all",
+			media,
+			0,
+			Stats{
+				Total:               4,
+				Types:               []Count{{"movie", 3}, {"music", 1}},
+				Years:               []Count{{"2020", 1}, {"2021", 3}},
+				Months:              []Count{{"2020-12", 1}, {"2021-01", 1}, {"2021-05", 2}},
+				TopDirectors:        []Count{{"Christopher Nolan", 2}, {"Michael Mann", 1}},
+				TopArtists:          []Count{{"AC/DC", 1}},
+				Decades:             []Count{{"1980s", 1}, {"1990s", 1}, {"2000s", 1}, {"2020s", 1}},
+				AverageYearsToWatch: float64(13+26+0+41) / 4,
+			},
+		},
+		{
+			"unknown-year",
+			append(media[3:], *streamed),
+			0,
+			Stats{
+				Total:               2,
+				Types:               []Count{{"music", 2}},
+				Years:               []Count{{"2021", 2}},
+				Months:              []Count{{"2021-01", 1}, {"2021-02", 1}},
+				TopDirectors:        []Count{},
+				TopArtists:          []Count{{"AC/DC", 2}},
+				Decades:             []Count{{"1980s", 1}},
+				UnknownYear:         1,
+				AverageYearsToWatch: 41,
+			},
+		},
+		{
+			"top",
+			media[:3],
+			1,
+			Stats{
+				Total:               3,
+				Types:               []Count{{"movie", 3}},
+				Years:               []Count{{"2020", 1}, {"2021", 2}},
+				Months:              []Count{{"2020-12", 1}, {"2021-05", 2}},
+				TopDirectors:        []Count{{"Christopher Nolan", 2}},
+				TopArtists:          []Count{},
+				Decades:             []Count{{"1990s", 1}, {"2000s", 1}, {"2020s", 1}},
+				AverageYearsToWatch: float64(13+26+0) / 3,
+			},
+		},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			got := ComputeStats(test.media, test.top)
+			if !reflect.DeepEqual(test.want, got) {
+				subtt.Fatalf("want %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestStats(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	for _, date := range []string{"2020-12-25", "2021-05-14"} {
+		movie, err := schema.NewMovie("A Counted Title", "A Counted Director", 2000, date)
+		if err != nil {
+			tt.Fatal(err)
+		}
+
+		err = client.Create(context.TODO(), movie)
+		if err != nil {
+			tt.Fatal(err)
+		}
+		defer func() {
+			err = client.Delete(context.TODO(), movie.ID, *movie, "")
+			if err != nil {
+				tt.Fatal(err)
+			}
+		}()
+	}
+
+	start, err := schema.StringToUnixTime("2021-01-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	stats, err := client.Stats(context.TODO(), schema.Movie{}, Filter{Director: "a counted director", WatchedAfter: start}, 0)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if want := []Count{{"2021", 1}}; stats.Total != 1 || !reflect.DeepEqual(want, stats.Years) {
+		tt.Fatalf("want one entry watched in 2021, got %+v", stats)
+	}
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// SyncAction is a change that Sync makes to a single object.
+type SyncAction int
+
+const (
+	// SyncCreate copies an object that is missing from one database.
+	SyncCreate SyncAction = iota
+
+	// SyncUpdate replaces an object with the different
+	// object stored under the same key in the other database.
+	SyncUpdate
+
+	// SyncDelete removes an object that is no longer
+	// in the other database.
+	SyncDelete
+)
+
+// String returns the name of the SyncAction.
+func (a SyncAction) String() string {
+	switch a {
+	case SyncCreate:
+		return "create"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncChange is a change that Sync makes, or would make, to the object
+// stored under Key. ToSource is true for a change made to the source
+// database by a bidirectional sync, rather than to the destination.
+type SyncChange struct {
+	Key      string
+	Action   SyncAction
+	ToSource bool
+}
+
+// SyncOptions controls how Sync brings two databases in line.
+// If Bidirectional is false, the destination is made a mirror of the
+// source. If DryRun is true, the changes are worked out but not made.
+type SyncOptions struct {
+	Bidirectional bool
+	DryRun        bool
+}
+
+// syncPlan is a change that Sync will make, along with
+// the data to store for a create or an update.
+type syncPlan struct {
+	change SyncChange
+	data   []byte
+}
+
+// listSyncKeys returns the set of keys in the database that are
+// synced. Indexes are not synced, since they are rebuilt instead.
+func (cl *MediaDbClient) listSyncKeys(ctx context.Context) (map[string]bool, error) {
+	keys, err := listAllKeys(ctx, cl.backend, schema.GetRootKey()+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !isIndexKey(key) {
+			keySet[key] = true
+		}
+	}
+
+	return keySet, nil
+}
+
+// getPairedKey returns the key of the trash object for the entry with
+// the given key, or the key of the entry for the trash object with the
+// given key. It returns "" if key is neither.
+func getPairedKey(key string) string {
+	for _, mediaType := range schema.GetAllMediaTypes() {
+		if id := strings.TrimPrefix(key, schema.GetBaseKeyFromMediaType(mediaType)+"/"); id != key {
+			return getTrashObjKey(id, mediaType)
+		}
+		if id := strings.TrimPrefix(key, schema.GetTrashKeyFromMediaType(mediaType)+"/"); id != key {
+			return strings.Join([]string{schema.GetBaseKeyFromMediaType(mediaType), id}, "/")
+		}
+	}
+	return ""
+}
+
+// planCopy returns the change for an object that is stored under key in
+// from but not in to, whose keys are toKeys. The object is copied to the
+// other database, unless the sync is bidirectional and the other database
+// has since moved the entry to the trash, or restored it from the trash.
+// The later of the two changes wins, and the object is deleted instead.
+func planCopy(ctx context.Context, from, to *MediaDbClient, key string, toKeys map[string]bool, bidirectional, toSource bool) (*syncPlan, error) {
+	if pairedKey := getPairedKey(key); bidirectional && pairedKey != "" && toKeys[pairedKey] {
+		lastModified, err := from.backend.LastModified(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		pairedLastModified, err := to.backend.LastModified(ctx, pairedKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if pairedLastModified.After(lastModified) {
+			return &syncPlan{change: SyncChange{Key: key, Action: SyncDelete, ToSource: !toSource}}, nil
+		}
+	}
+
+	data, _, err := from.backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncPlan{change: SyncChange{Key: key, Action: SyncCreate, ToSource: toSource}, data: data}, nil
+}
+
+// planSync returns the change needed to bring the object stored under key
+// in line between the source database cl and dst, or nil if it is already
+// the same in both.
+func (cl *MediaDbClient) planSync(ctx context.Context, dst *MediaDbClient, key string, srcKeys, dstKeys map[string]bool, bidirectional bool) (*syncPlan, error) {
+	switch {
+	case srcKeys[key] && dstKeys[key]:
+		srcData, _, err := cl.backend.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		dstData, _, err := dst.backend.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(srcData, dstData) {
+			return nil, nil
+		}
+
+		if bidirectional {
+			srcLastModified, err := cl.backend.LastModified(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			dstLastModified, err := dst.backend.LastModified(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+
+			if dstLastModified.After(srcLastModified) {
+				return &syncPlan{change: SyncChange{Key: key, Action: SyncUpdate, ToSource: true}, data: dstData}, nil
+			}
+		}
+
+		return &syncPlan{change: SyncChange{Key: key, Action: SyncUpdate}, data: srcData}, nil
+	case srcKeys[key]:
+		return planCopy(ctx, cl, dst, key, dstKeys, bidirectional, false)
+	case bidirectional:
+		return planCopy(ctx, dst, cl, key, srcKeys, bidirectional, true)
+	default:
+		return &syncPlan{change: SyncChange{Key: key, Action: SyncDelete}}, nil
+	}
+}
+
+// Sync compares every entry, including the deleted entries in the trash,
+// between the database and dst, and changes dst to match. If the sync is
+// bidirectional, changes are copied both ways instead, and when an object
+// differs between the two databases, the one written last wins. Deleting
+// an entry, or restoring it from the trash, in either database is copied
+// to the other in the same way. Purging the trash is only copied by a
+// sync that is not bidirectional. The index of each changed database is
+// rebuilt afterwards. It returns the changes, ordered by key, and a
+// non-nil error if either database cannot be read or changed. If a change
+// cannot be made, the changes that were made are returned with the error.
+func (cl *MediaDbClient) Sync(ctx context.Context, dst *MediaDbClient, opts SyncOptions) ([]SyncChange, error) {
+	srcKeys, err := cl.listSyncKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dstKeys, err := dst.listSyncKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(srcKeys)+len(dstKeys))
+	for key := range srcKeys {
+		keys = append(keys, key)
+	}
+	for key := range dstKeys {
+		if !srcKeys[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	plans := make([]*syncPlan, len(keys))
+	err = cl.runConcurrently(ctx, len(keys), func(ctx context.Context, i int) error {
+		plan, err := cl.planSync(ctx, dst, keys[i], srcKeys, dstKeys, opts.Bidirectional)
+		plans[i] = plan
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	changedPlans := make([]*syncPlan, 0)
+	for _, plan := range plans {
+		if plan != nil {
+			changedPlans = append(changedPlans, plan)
+		}
+	}
+
+	changes := make([]SyncChange, len(changedPlans))
+	for i, plan := range changedPlans {
+		changes[i] = plan.change
+	}
+
+	if opts.DryRun || len(changes) == 0 {
+		return changes, nil
+	}
+
+	isApplied := make([]bool, len(changedPlans))
+	applyErr := cl.runConcurrently(ctx, len(changedPlans), func(ctx context.Context, i int) error {
+		change := changedPlans[i].change
+
+		backend := dst.backend
+		if change.ToSource {
+			backend = cl.backend
+		}
+
+		var err error
+		if change.Action == SyncDelete {
+			err = backend.Delete(ctx, change.Key, "")
+		} else {
+			_, err = backend.Put(ctx, change.Key, changedPlans[i].data, "")
+		}
+		isApplied[i] = err == nil
+		return err
+	})
+
+	appliedChanges := make([]SyncChange, 0, len(changes))
+	srcChanged, dstChanged := false, false
+	for i, change := range changes {
+		if !isApplied[i] {
+			continue
+		}
+		appliedChanges = append(appliedChanges, change)
+
+		if change.ToSource {
+			srcChanged = true
+		} else {
+			dstChanged = true
+		}
+	}
+
+	// The indexes are rebuilt for the changes that were made,
+	// even if the sync failed or ctx was cancelled.
+	if dstChanged {
+		_, err = dst.Reindex(detach(ctx))
+		if err != nil {
+			return appliedChanges, indexUpdateError(err)
+		}
+	}
+	if srcChanged {
+		_, err = cl.Reindex(detach(ctx))
+		if err != nil {
+			return appliedChanges, indexUpdateError(err)
+		}
+	}
+
+	return appliedChanges, applyErr
+}
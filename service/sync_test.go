@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// checkSynced fails the test if the entries or the
+// trash of the two databases are not the same.
+func checkSynced(tt *testing.T, src, dst *MediaDbClient) {
+	tt.Helper()
+
+	srcEntries, err := src.Read(context.TODO(), "", nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	dstEntries, err := dst.Read(context.TODO(), "", nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(srcEntries, dstEntries) {
+		tt.Fatalf("want the same entries, got %v and %v", srcEntries, dstEntries)
+	}
+
+	srcTrash, err := src.ReadTrash(context.TODO(), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	dstTrash, err := dst.ReadTrash(context.TODO(), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(srcTrash, dstTrash) {
+		tt.Fatalf("want the same trash, got %v and %v", srcTrash, dstTrash)
+	}
+}
+
+func TestSync(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("syncs between two in-memory databases")
+	}
+
+	src, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	dst, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	newMovie := func(title string) *schema.Movie {
+		movie, err := schema.NewMovie(title, "A Director", 2000, "2021-07-01")
+		if err != nil {
+			tt.Fatal(err)
+		}
+		return movie
+	}
+
+	changedMovie := newMovie("A Changed Title")
+	newerMovie := newMovie("A Title Only In The Source")
+	olderMovie := newMovie("A Title Only In The Destination")
+
+	for _, media := range []schema.Media{changedMovie, newerMovie} {
+		err = src.Create(context.TODO(), media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	staleMovie := *changedMovie
+	staleMovie.Title = "A Stale Title"
+	for _, media := range []schema.Media{&staleMovie, olderMovie} {
+		err = dst.Create(context.TODO(), media)
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}
+
+	wantChanges := []SyncChange{
+		{Key: changedMovie.Key(), Action: SyncUpdate},
+		{Key: newerMovie.Key(), Action: SyncCreate},
+		{Key: olderMovie.Key(), Action: SyncDelete},
+	}
+	sort.Slice(wantChanges, func(i, j int) bool {
+		return wantChanges[i].Key < wantChanges[j].Key
+	})
+
+	changes, err := src.Sync(context.TODO(), dst, SyncOptions{DryRun: true})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantChanges, changes) {
+		tt.Fatalf("want %v, got %v", wantChanges, changes)
+	}
+
+	res, err := dst.Read(context.TODO(), olderMovie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 1 {
+		tt.Fatalf("want a dry run to leave the destination unchanged, got %v", res)
+	}
+
+	changes, err = src.Sync(context.TODO(), dst, SyncOptions{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantChanges, changes) {
+		tt.Fatalf("want %v, got %v", wantChanges, changes)
+	}
+	checkSynced(tt, src, dst)
+
+	changes, err = src.Sync(context.TODO(), dst, SyncOptions{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(changes) != 0 {
+		tt.Fatalf("want no changes once synced, got %v", changes)
+	}
+
+	// Make a change of each kind in both databases, then sync both ways.
+	srcMovie := newMovie("A New Title In The Source")
+	err = src.Create(context.TODO(), srcMovie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	dstMovie := newMovie("A New Title In The Destination")
+	err = dst.Create(context.TODO(), dstMovie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = dst.Delete(context.TODO(), newerMovie.ID, schema.Movie{}, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	updatedMovie := *changedMovie
+	updatedMovie.Title = "An Updated Title"
+	err = src.Update(context.TODO(), changedMovie.ID, staleMovie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	err = dst.Update(context.TODO(), changedMovie.ID, updatedMovie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	changes, err = src.Sync(context.TODO(), dst, SyncOptions{Bidirectional: true})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(changes) != 5 {
+		tt.Fatalf("want 5 changes, got %v", changes)
+	}
+	checkSynced(tt, src, dst)
+
+	res, err = src.Read(context.TODO(), "", schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if want := []schema.Media{updatedMovie, *srcMovie, *dstMovie}; len(res) != len(want) {
+		tt.Fatalf("want %v, got %v", want, res)
+	}
+	for _, media := range res {
+		if media.(schema.Movie).ID == changedMovie.ID && !reflect.DeepEqual(updatedMovie, media) {
+			tt.Fatalf("want the last update %v to win, got %v", updatedMovie, media)
+		}
+	}
+
+	// Restoring the entry from the trash is synced the same way, whichever
+	// database is the source.
+	_, err = src.Restore(context.TODO(), newerMovie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	changes, err = dst.Sync(context.TODO(), src, SyncOptions{Bidirectional: true})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	wantChanges = []SyncChange{
+		{Key: newerMovie.Key(), Action: SyncCreate, ToSource: true},
+		{Key: getTrashObjKey(newerMovie.ID, schema.Movie{}), Action: SyncDelete, ToSource: true},
+	}
+	if !reflect.DeepEqual(wantChanges, changes) {
+		tt.Fatalf("want %v, got %v", wantChanges, changes)
+	}
+	checkSynced(tt, src, dst)
+}
@@ -10,14 +10,15 @@ import (
 )
 
 var (
-	testConfigFile *string = flag.String("config", "", "The media db configuration file to use for testing")
+	testConfigFile *string = flag.String("config", "", "The media db configuration file to use for testing against a live database (default: an in-memory fake S3 bucket)")
 )
 
 func preTestSetup() {
 	flag.Parse()
 
 	if *testConfigFile == "" {
-		log.Fatalf("must specify a media db configuration file for testing, got %q", *testConfigFile)
+		log.Println("no media db configuration file given, testing against an in-memory fake S3 bucket")
+		return
 	}
 
 	err := os.Remove(config.GetDefaultConfigFile())
@@ -33,3 +34,9 @@ func preTestSetup() {
 		log.Fatal(err)
 	}
 }
+
+// isLiveTest reports whether the tests are running against the
+// live database given by the -config flag.
+func isLiveTest() bool {
+	return *testConfigFile != ""
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+// trashObject is the object stored in the trash for a deleted entry.
+// DeletedAt is a Unix timestamp.
+type trashObject struct {
+	DeletedAt int64           `json:"deleted"`
+	Entry     json.RawMessage `json:"entry"`
+}
+
+// TrashEntry is a deleted media entry that can still be restored.
+type TrashEntry struct {
+	Media     schema.Media
+	DeletedAt time.Time
+}
+
+// getTrashObjKey returns the key of the trash object for the entry
+// with the given id and type.
+func getTrashObjKey(id string, mediaType schema.Media) string {
+	return strings.Join([]string{schema.GetTrashKeyFromMediaType(mediaType), id}, "/")
+}
+
+// moveToTrash stores jsonData, the stored data of the entry with the given
+// id and type, in the trash along with the current time.
+func (cl *MediaDbClient) moveToTrash(ctx context.Context, id string, mediaType schema.Media, jsonData []byte) error {
+	trashData, err := json.Marshal(trashObject{
+		DeletedAt: time.Now().Unix(),
+		Entry:     jsonData,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.backend.Put(ctx, getTrashObjKey(id, mediaType), trashData, "")
+	return err
+}
+
+// ReadTrash retrieves the deleted entries in the trash, ordered from the
+// earliest deleted to the most recently deleted. If mediaType is not nil,
+// only deleted entries of that type are returned. It returns a non-nil
+// error if the trash cannot be read.
+func (cl *MediaDbClient) ReadTrash(ctx context.Context, mediaType schema.Media) ([]TrashEntry, error) {
+	mediaTypes := schema.GetAllMediaTypes()
+	if mediaType != nil {
+		mediaTypes = []schema.Media{mediaType}
+	}
+
+	keys := make([]string, 0)
+	keyTypes := make([]schema.Media, 0)
+	for _, mediaType := range mediaTypes {
+		typeKeys, err := listAllKeys(ctx, cl.backend, schema.GetTrashKeyFromMediaType(mediaType)+"/")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range typeKeys {
+			keys = append(keys, key)
+			keyTypes = append(keyTypes, mediaType)
+		}
+	}
+
+	trashEntries := make([]TrashEntry, len(keys))
+
+	err := cl.runConcurrently(ctx, len(keys), func(ctx context.Context, i int) error {
+		trashData, _, err := cl.backend.Get(ctx, keys[i])
+		if err != nil {
+			return err
+		}
+
+		trashObj := trashObject{}
+		err = json.Unmarshal(trashData, &trashObj)
+		if err != nil {
+			return err
+		}
+
+		// The entry is decoded as if it were still stored under its original key.
+		entryKey := strings.Join([]string{schema.GetBaseKeyFromMediaType(keyTypes[i]), schema.GetIDFromKey(keys[i])}, "/")
+		media, err := decodeMedia(entryKey, trashObj.Entry)
+		if err != nil {
+			return err
+		}
+
+		trashEntries[i] = TrashEntry{
+			Media:     media,
+			DeletedAt: time.Unix(trashObj.DeletedAt, 0),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(trashEntries, func(i, j int) bool {
+		return trashEntries[i].DeletedAt.Before(trashEntries[j].DeletedAt)
+	})
+
+	return trashEntries, nil
+}
+
+// Restore moves the deleted entry with the given id out of the trash and back
+// into the database, and returns the restored entry. If mediaType is nil, the
+// trash of every media type is searched for the id. It returns a non-nil error
+// if the entry cannot be restored, wrapping ErrNotFound if there is no deleted
+// entry with that id. An entry is not restored over an existing entry.
+func (cl *MediaDbClient) Restore(ctx context.Context, id string, mediaType schema.Media) (schema.Media, error) {
+	mediaTypes := schema.GetAllMediaTypes()
+	if mediaType != nil {
+		mediaTypes = []schema.Media{mediaType}
+	}
+
+	for _, mediaType := range mediaTypes {
+		trashKey := getTrashObjKey(id, mediaType)
+
+		trashData, _, err := cl.backend.Get(ctx, trashKey)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		trashObj := trashObject{}
+		err = json.Unmarshal(trashData, &trashObj)
+		if err != nil {
+			return nil, err
+		}
+
+		entryKey := strings.Join([]string{schema.GetBaseKeyFromMediaType(mediaType), id}, "/")
+		media, err := decodeMedia(entryKey, trashObj.Entry)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = cl.backend.Head(ctx, entryKey)
+		if err == nil {
+			return nil, fmt.Errorf("entry %s already exists in the database, so it cannot be restored", id)
+		} else if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		// The entry may have been deleted before the document format changed.
+		entryData, err := schema.UpgradeDocument(mediaType, trashObj.Entry)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = cl.backend.Put(ctx, entryKey, entryData, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// The entry is back, so the rest of the restore is
+		// finished even if ctx is cancelled.
+		ctx = detach(ctx)
+
+		err = cl.backend.Delete(ctx, trashKey, "")
+		if err != nil {
+			return nil, err
+		}
+
+		err = cl.updateIndex(ctx, mediaType, func(idx *mediaIndex) {
+			idx.Entries[id] = entryData
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return media, nil
+	}
+
+	return nil, newNotFoundError("there is no deleted entry with id %s", id)
+}
+
+// PurgeTrash permanently removes the entries in the trash that were deleted
+// at least olderThan ago. It returns the number of entries purged and a
+// non-nil error if the trash cannot be purged.
+func (cl *MediaDbClient) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	trashEntries, err := cl.ReadTrash(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	numPurged := 0
+
+	for _, trashEntry := range trashEntries {
+		if trashEntry.DeletedAt.After(cutoff) {
+			continue
+		}
+
+		key := trashEntry.Media.Key()
+		mediaType, err := schema.GetMediaTypeFromKey(key)
+		if err != nil {
+			return numPurged, err
+		}
+
+		err = cl.backend.Delete(ctx, getTrashObjKey(schema.GetIDFromKey(key), mediaType), "")
+		if err != nil {
+			return numPurged, err
+		}
+		numPurged++
+	}
+
+	return numPurged, nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alexpcook/media-db/schema"
+)
+
+func TestTrash(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Trashed Title", "A Trashed Director", 1988, "2021-07-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Delete(context.TODO(), movie.ID, *movie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// Deleted entries are not read.
+	res, err := client.Read(context.TODO(), "", nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 0 {
+		tt.Fatalf("want 0 entries, got %d", len(res))
+	}
+
+	page, err := client.ReadPage(context.TODO(), "", nil, 0, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(page.Media) != 0 {
+		tt.Fatalf("want 0 entries in page, got %d", len(page.Media))
+	}
+
+	// Deleting an entry that does not exist fails.
+	err = client.Delete(context.TODO(), movie.ID, *movie, "")
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	trashEntries, err := client.ReadTrash(context.TODO(), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(trashEntries) != 1 {
+		tt.Fatalf("want 1 entry in trash, got %d", len(trashEntries))
+	}
+	if !reflect.DeepEqual(*movie, trashEntries[0].Media) {
+		tt.Fatalf("want %v, got %v", *movie, trashEntries[0].Media)
+	}
+
+	trashEntries, err = client.ReadTrash(context.TODO(), schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(trashEntries) != 0 {
+		tt.Fatalf("want 0 music entries in trash, got %d", len(trashEntries))
+	}
+
+	restored, err := client.Restore(context.TODO(), movie.ID, nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if !reflect.DeepEqual(*movie, restored) {
+		tt.Fatalf("want %v, got %v", *movie, restored)
+	}
+
+	res, err = client.Read(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(res) != 1 {
+		tt.Fatalf("want 1 entry after restore, got %d", len(res))
+	}
+
+	// The entry is no longer in the trash, so it cannot be restored twice.
+	_, err = client.Restore(context.TODO(), movie.ID, schema.Movie{})
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+
+	err = client.Delete(context.TODO(), movie.ID, *movie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// The entry was only just deleted, so it is not old enough to purge.
+	numPurged, err := client.PurgeTrash(context.TODO(), time.Hour)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if numPurged != 0 {
+		tt.Fatalf("want 0 entries purged, got %d", numPurged)
+	}
+
+	numPurged, err = client.PurgeTrash(context.TODO(), 0)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if numPurged != 1 {
+		tt.Fatalf("want 1 entry purged, got %d", numPurged)
+	}
+
+	trashEntries, err = client.ReadTrash(context.TODO(), nil)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if len(trashEntries) != 0 {
+		tt.Fatalf("want 0 entries in trash, got %d", len(trashEntries))
+	}
+}
+
+func TestRestoreUpgradesIndex(tt *testing.T) {
+	if isLiveTest() {
+		tt.Skip("writes an entry in an old document format")
+	}
+
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("An Old Trashed Title", "An Old Trashed Director", 1979, "2021-07-02")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// An entry written before the document format had versions.
+	jsonData, err := json.Marshal(movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = client.backend.Put(context.TODO(), movie.Key(), jsonData, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Delete(context.TODO(), movie.ID, *movie, "")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, err = client.Restore(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	idx, _, err := client.loadIndex(context.TODO(), schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if version, _ := schema.GetDocumentVersion(idx.Entries[movie.ID]); version != schema.GetSchemaVersion() {
+		tt.Fatalf("want index entry version %d, got %d", schema.GetSchemaVersion(), version)
+	}
+}
@@ -1,42 +1,81 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"strings"
 
 	"github.com/alexpcook/media-db/schema"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// Update changes a single existing media object in the database.
-// It returns a non-nil error if the object cannot be updated.
-func (cl *MediaDbClient) Update(id string, newMedia schema.Media) error {
+// Update changes a single existing media object in the database and in the
+// index for its type. If expectedVersion is not the empty string "", the
+// object is only changed if its current version is expectedVersion, and
+// a *ConflictError is returned if it is not. Versions are returned by
+// ReadEntry. It returns a non-nil error if the object cannot be updated,
+// wrapping ErrNotFound if there is no such entry.
+func (cl *MediaDbClient) Update(ctx context.Context, id string, newMedia schema.Media, expectedVersion string) error {
 	objKey := strings.Join([]string{schema.GetBaseKeyFromMediaType(newMedia), id}, "/")
 
-	// Validate that the object exists (don't create it if it doesn't).
-	_, err := cl.s3Client.HeadObject(context.TODO(), &s3.HeadObjectInput{
-		Bucket: &cl.s3Bucket,
-		Key:    &objKey,
-	})
+	mediaType, err := schema.GetMediaTypeFromKey(objKey)
 	if err != nil {
 		return err
 	}
 
-	jsonData, err := json.Marshal(newMedia)
+	// Validate that the object exists (don't create it if it doesn't).
+	// A conditional put does this check itself.
+	if expectedVersion == "" {
+		_, err = cl.backend.Head(ctx, objKey)
+		if errors.Is(err, ErrNotFound) {
+			return entryNotFoundError(id, mediaType)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	jsonData, err := schema.MarshalMedia(newMedia)
 	if err != nil {
 		return err
 	}
 
-	_, err = cl.s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: &cl.s3Bucket,
-		Key:    &objKey,
-		Body:   bytes.NewReader(jsonData),
+	_, err = cl.backend.Put(ctx, objKey, jsonData, expectedVersion)
+	if errors.Is(err, ErrPreconditionFailed) {
+		return cl.newConflictError(ctx, objKey, expectedVersion)
+	} else if errors.Is(err, ErrNotFound) {
+		return entryNotFoundError(id, mediaType)
+	} else if err != nil {
+		return err
+	}
+
+	return cl.updateIndex(detach(ctx), mediaType, func(idx *mediaIndex) {
+		idx.Entries[id] = jsonData
 	})
+}
+
+// UpdateKeeping changes a single existing media object in the same way as
+// Update, except that the named fields keep their stored values, as given
+// by schema.KeepFields. The stored entry is read first, and the update is
+// only made if the entry has not changed since then, so that the kept
+// fields are never stale. It returns a non-nil error if the object cannot
+// be read or updated.
+func (cl *MediaDbClient) UpdateKeeping(ctx context.Context, id string, newMedia schema.Media, expectedVersion string, keep []string) error {
+	if len(keep) == 0 {
+		return cl.Update(ctx, id, newMedia, expectedVersion)
+	}
+
+	stored, version, err := cl.ReadEntry(ctx, id, newMedia)
+	if err != nil {
+		return err
+	}
+
+	if expectedVersion != "" && expectedVersion != version {
+		return cl.newConflictError(ctx, strings.Join([]string{schema.GetBaseKeyFromMediaType(newMedia), id}, "/"), expectedVersion)
+	}
+
+	newMedia, err = schema.KeepFields(newMedia, stored, keep)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return cl.Update(ctx, id, newMedia, version)
 }
@@ -1,19 +1,19 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/alexpcook/media-db/config"
+	"github.com/alexpcook/media-db/mediafile"
 	"github.com/alexpcook/media-db/schema"
 )
 
 func TestUpdate(tt *testing.T) {
-	cfg, err := config.LoadMediaDbConfig()
-	if err != nil {
-		tt.Fatal(err)
-	}
-
-	client, err := NewMediaDbClient(cfg)
+	client, err := newTestMediaDbClient()
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -24,13 +24,13 @@ func TestUpdate(tt *testing.T) {
 	}
 
 	// Try to update the movie before it exists to force an error.
-	err = client.Update(movie.ID, *movie)
+	err = client.Update(context.TODO(), movie.ID, *movie, "")
 	if err == nil {
 		tt.Fatal("want error, got nil")
 	}
 
 	// Ensure that the database is empty.
-	entries, err := client.Read("", nil)
+	entries, err := client.Read(context.TODO(), "", nil)
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -38,12 +38,12 @@ func TestUpdate(tt *testing.T) {
 		tt.Fatalf("want 0 entries in database, got %d", len(entries))
 	}
 
-	err = client.Create(movie)
+	err = client.Create(context.TODO(), movie)
 	if err != nil {
 		tt.Fatal(err)
 	}
 	defer func() {
-		err = client.Delete(movie.ID, *movie)
+		err = client.Delete(context.TODO(), movie.ID, *movie, "")
 		if err != nil {
 			tt.Fatal(err)
 		}
@@ -51,13 +51,13 @@ func TestUpdate(tt *testing.T) {
 
 	// Update the year and sync it to the database.
 	movie.YearMade = 2020
-	err = client.Update(movie.ID, *movie)
+	err = client.Update(context.TODO(), movie.ID, *movie, "")
 	if err != nil {
 		tt.Fatal(err)
 	}
 
 	// Validate that one film is now in the database.
-	entries, err = client.Read("", nil)
+	entries, err = client.Read(context.TODO(), "", nil)
 	if err != nil {
 		tt.Fatal(err)
 	}
@@ -74,3 +74,230 @@ func TestUpdate(tt *testing.T) {
 		}
 	}
 }
+
+func TestUpdateConflict(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Contested Title", "A Contested Director", 1977, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, firstVersion, err := client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// The first writer updates the movie from the version it read.
+	movie.YearMade = 1978
+	err = client.Update(context.TODO(), movie.ID, *movie, firstVersion)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// The second writer read the same version, so its update is a conflict.
+	staleMovie := *movie
+	staleMovie.YearMade = 1979
+	err = client.Update(context.TODO(), movie.ID, staleMovie, firstVersion)
+	if !errors.Is(err, ErrConflict) {
+		tt.Fatalf("want %v, got %v", ErrConflict, err)
+	}
+
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		tt.Fatalf("want *ConflictError, got %T", err)
+	}
+
+	if !reflect.DeepEqual(*movie, conflictErr.Current) {
+		tt.Fatalf("want current value %v, got %v", *movie, conflictErr.Current)
+	}
+
+	_, currentVersion, err := client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	if currentVersion != conflictErr.CurrentVersion {
+		tt.Fatalf("want current version %s, got %s", currentVersion, conflictErr.CurrentVersion)
+	}
+
+	// Deleting from the stale version is also a conflict.
+	err = client.Delete(context.TODO(), movie.ID, *movie, firstVersion)
+	if !errors.Is(err, ErrConflict) {
+		tt.Fatalf("want %v, got %v", ErrConflict, err)
+	}
+
+	err = client.Delete(context.TODO(), movie.ID, *movie, currentVersion)
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	_, _, err = client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+	if !errors.Is(err, ErrNotFound) {
+		tt.Fatalf("want %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestUpdateKeeping(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Rated Title", "A Rated Director", 1984, "2021-06-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	movie.Rating = 4.5
+	movie.Rewatch = true
+
+	err = client.Create(context.TODO(), movie)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err = client.Delete(context.TODO(), movie.ID, *movie, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	_, firstVersion, err := client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	// An update without a rating or rewatch keeps the stored ones.
+	updated := *movie
+	updated.Title = "A New Rated Title"
+	updated.Rating = 0
+	updated.Rewatch = false
+	err = client.UpdateKeeping(context.TODO(), movie.ID, updated, "", []string{"rating", "rewatch"})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	got, _, err := client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	want := *movie
+	want.Title = updated.Title
+	if !reflect.DeepEqual(want, got) {
+		tt.Fatalf("want %v, got %v", want, got)
+	}
+
+	// An update from a stale version is a conflict.
+	err = client.UpdateKeeping(context.TODO(), movie.ID, updated, firstVersion, []string{"rating"})
+	if !errors.Is(err, ErrConflict) {
+		tt.Fatalf("want %v, got %v", ErrConflict, err)
+	}
+}
+
+func TestUpdateKeepingImported(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	plays := []mediafile.Play{
+		{Title: "An Imported Song", Artist: "An Imported Artist", Time: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{Title: "An Imported Song", Artist: "An Imported Artist", Time: time.Date(2021, 3, 9, 12, 0, 0, 0, time.UTC)},
+	}
+	rows := mediafile.AggregatePlays(plays, mediafile.GetDefaultMinPlayDuration())
+	if len(rows) != 1 || rows[0].Err != nil {
+		tt.Fatalf("want 1 imported entry, got %v", rows)
+	}
+	imported := rows[0].Media.(schema.Music)
+	imported.YearMade = 1999
+
+	err = client.Create(context.TODO(), &imported)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	defer func() {
+		err = client.Delete(context.TODO(), imported.ID, imported, "")
+		if err != nil {
+			tt.Fatal(err)
+		}
+	}()
+
+	// Update the title as 'media-db update music' does without -plays or -last-listened.
+	updated, err := schema.NewMusic("A Corrected Song", imported.Artist, imported.YearMade, "2021-03-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	updated.ID = imported.ID
+
+	err = client.UpdateKeeping(context.TODO(), imported.ID, *updated, "", []string{"plays", "last"})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	got, _, err := client.ReadEntry(context.TODO(), imported.ID, schema.Music{})
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	want := imported
+	want.Title = updated.Title
+	if !reflect.DeepEqual(want, got) {
+		tt.Fatalf("want %v, got %v", want, got)
+	}
+	if want.Plays != 2 || want.LastListened != time.Date(2021, 3, 9, 0, 0, 0, 0, time.UTC).Unix() {
+		tt.Fatalf("want 2 plays last listened on 2021-03-09, got %v", want)
+	}
+}
+
+func TestEntryNotFound(tt *testing.T) {
+	client, err := newTestMediaDbClient()
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	movie, err := schema.NewMovie("A Missing Title", "A Missing Director", 1999, "2021-05-01")
+	if err != nil {
+		tt.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		call func() error
+	}{
+		{"read", func() error {
+			_, _, err := client.ReadEntry(context.TODO(), movie.ID, schema.Movie{})
+			return err
+		}},
+		{"update", func() error {
+			return client.Update(context.TODO(), movie.ID, *movie, "")
+		}},
+		{"update-version", func() error {
+			return client.Update(context.TODO(), movie.ID, *movie, "a-version")
+		}},
+		{"delete", func() error {
+			return client.Delete(context.TODO(), movie.ID, *movie, "")
+		}},
+	}
+
+	for _, test := range testCases {
+		tt.Run(test.name, func(subtt *testing.T) {
+			err := test.call()
+			if !errors.Is(err, ErrNotFound) {
+				subtt.Fatalf("want %v, got %v", ErrNotFound, err)
+			}
+
+			if want := "there is no movie entry with id " + movie.ID; !strings.Contains(err.Error(), want) {
+				subtt.Fatalf("want error containing %q, got %q", want, err)
+			}
+		})
+	}
+}